@@ -0,0 +1,337 @@
+package arithmetic
+
+import (
+	"errors"
+	binreader "jpeg/decoder/binReader"
+)
+
+// Арифметическое декодирование QM-кодером (ITU T.81, приложения D, F.2.4, G.2)
+
+const NumTables = 4         //Количество таблиц условного кодирования
+const NumDCStats = 64       //Количество состояний для DC таблицы
+const maxSpectral = 63      //Последний индекс коэффициента в блоке
+const NumACStats = 256      //Количество состояний для AC таблицы
+const fixedState = 113      //Состояние с фиксированной вероятностью 0.5 (знак AC и refinement)
+const dcMagnitude = 20      //Начало состояний категории DC (X1 в таблице F.4)
+const acLowMagnitude = 189  //Начало состояний категории AC для k <= Kx (X2)
+const acHighMagnitude = 217 //Начало состояний категории AC для k > Kx
+const maxMagnitude = 0x8000 //Граница категории, после которой значение некорректно
+
+// Значения по умолчанию для условного кодирования (при отсутствии DAC)
+const (
+	DefaultL  byte = 0
+	DefaultU  byte = 1
+	DefaultKx byte = 5
+)
+
+// Таблица D.2: Qe << 16 | Next_Index_MPS << 8 | Switch_MPS << 7 | Next_Index_LPS
+var qeTable = [...]uint32{
+	0x5a1d0181, 0x2586020e, 0x11140310, 0x080b0412, 0x03d80514, 0x01da0617, 0x00e50719, 0x006f081c,
+	0x0036091e, 0x001a0a21, 0x000d0b23, 0x00060c09, 0x00030d0a, 0x00010d0c, 0x5a7f0f8f, 0x3f251024,
+	0x2cf21126, 0x207c1227, 0x17b91328, 0x1182142a, 0x0cef152b, 0x09a1162d, 0x072f172e, 0x055c1830,
+	0x04061931, 0x03031a33, 0x02401b34, 0x01b11c36, 0x01441d38, 0x00f51e39, 0x00b71f3b, 0x008a203c,
+	0x0068213e, 0x004e223f, 0x003b2320, 0x002c0921, 0x5ae125a5, 0x484c2640, 0x3a0d2741, 0x2ef12843,
+	0x261f2944, 0x1f332a45, 0x19a82b46, 0x15182c48, 0x11772d49, 0x0e742e4a, 0x0bfb2f4b, 0x09f8304d,
+	0x0861314e, 0x0706324f, 0x05cd3330, 0x04de3432, 0x040f3532, 0x03633633, 0x02d43734, 0x025c3835,
+	0x01f83936, 0x01a43a37, 0x01603b38, 0x01253c39, 0x00f63d3a, 0x00cb3e3b, 0x00ab3f3d, 0x008f203d,
+	0x5b1241c1, 0x4d044250, 0x412c4351, 0x37d84452, 0x2fe84553, 0x293c4654, 0x23794756, 0x1edf4857,
+	0x1aa94957, 0x174e4a48, 0x14244b48, 0x119c4c4a, 0x0f6b4d4a, 0x0d514e4b, 0x0bb64f4d, 0x0a40304d,
+	0x583251d0, 0x4d1c5258, 0x438e5359, 0x3bdd545a, 0x34ee555b, 0x2eae565c, 0x299a575d, 0x25164756,
+	0x557059d8, 0x4ca95a5f, 0x44d95b60, 0x3e225c61, 0x38245d63, 0x32b45e63, 0x2e17565d, 0x56a860df,
+	0x4f466165, 0x47e56266, 0x41cf6367, 0x3c3d6468, 0x375e5d63, 0x52316669, 0x4c0f676a, 0x4639686b,
+	0x415e6367, 0x56276ae9, 0x50e76b6c, 0x4b85676d, 0x55976d6e, 0x504f6b6f, 0x5a106fee, 0x55226d70,
+	0x59eb6ff0, 0x5a1d7171,
+}
+
+// Состояния вероятностей для DC таблицы: индекс в qeTable и MPS в старшем бите
+type DCStats [NumDCStats]byte
+
+// Состояния вероятностей для AC таблицы
+type ACStats [NumACStats]byte
+
+// Структура арифметического декодера
+type Decoder struct {
+	c       int64              //Регистр кода
+	a       int64              //Регистр интервала
+	ct      int                //Счетчик бит до чтения следующего байта
+	marker  bool               //Флаг достижения маркера, далее подставляются нули
+	fixed   byte               //Состояние с фиксированной вероятностью
+	dcStats [NumTables]DCStats //Состояния для DC таблиц
+	acStats [NumTables]ACStats //Состояния для AC таблиц
+	dcL     [NumTables]byte    //Нижняя граница категории малых разностей DC
+	dcU     [NumTables]byte    //Верхняя граница категории малых разностей DC
+	acKx    [NumTables]byte    //Граница spectral selection для состояний категории AC
+}
+
+// Создание декодера с параметрами условного кодирования по умолчанию
+func NewDecoder() *Decoder {
+	var d Decoder
+	for i := range NumTables {
+		d.dcL[i] = DefaultL
+		d.dcU[i] = DefaultU
+		d.acKx[i] = DefaultKx
+	}
+	return &d
+}
+
+// Установка параметров условного кодирования DC таблицы tb
+func (d *Decoder) SetDCConditioning(tb byte, l byte, u byte) error {
+	if tb >= NumTables || l > u {
+		return errors.New("Segment reading error: arithmetic conditioning invalid DC table")
+	}
+	d.dcL[tb], d.dcU[tb] = l, u
+	return nil
+}
+
+// Установка параметров условного кодирования AC таблицы tb
+func (d *Decoder) SetACConditioning(tb byte, kx byte) error {
+	if tb >= NumTables || kx < 1 || kx > maxSpectral {
+		return errors.New("Segment reading error: arithmetic conditioning invalid AC table")
+	}
+	d.acKx[tb] = kx
+	return nil
+}
+
+// Инициализация декодера в начале скана или после перезапуска
+func (d *Decoder) Reset() {
+	d.c = 0
+	d.a = 0
+	d.ct = -16 //Перед первым декодированием читаются 2 байта
+	d.marker = false
+	d.fixed = fixedState
+}
+
+// Сброс состояний DC таблицы tb
+func (d *Decoder) ResetDC(tb byte) {
+	clear(d.dcStats[tb][:])
+}
+
+// Сброс состояний AC таблицы tb
+func (d *Decoder) ResetAC(tb byte) {
+	clear(d.acStats[tb][:])
+}
+
+// Чтение следующего байта кода с пропуском заполнения 0xFF 0x00
+func (d *Decoder) nextByte(reader *binreader.BinReader) int64 {
+	for !d.marker {
+		word := reader.GetNextWord()
+		if word>>8 != 0xFF {
+			return int64(reader.GetByte())
+		}
+		switch byte(word) {
+		case 0x00:
+			reader.GetWord()
+			return 0xFF
+		case 0xFF:
+			reader.GetByte()
+		default:
+			//Маркер внутри данных допустим, он остается непрочитанным
+			d.marker = true
+		}
+	}
+	return 0
+}
+
+// Декодирование одного бита с состоянием st (D.2.4 - D.2.6)
+func (d *Decoder) decodeBit(reader *binreader.BinReader, st *byte) byte {
+	//Ренормализация и чтение данных
+	for d.a < 0x8000 {
+		d.ct--
+		if d.ct < 0 {
+			d.c = d.c<<8 | d.nextByte(reader)
+			d.ct += 8
+			if d.ct < 0 {
+				d.ct++
+				if d.ct == 0 {
+					d.a = 0x8000
+				}
+			}
+		}
+		d.a <<= 1
+	}
+
+	sv := *st
+	qe := qeTable[sv&0x7F]
+	nextLPS := byte(qe)
+	nextMPS := byte(qe >> 8)
+	prob := int64(qe >> 16)
+
+	d.a -= prob
+	temp := d.a << d.ct
+	if d.c >= temp {
+		d.c -= temp
+		//Условный обмен LPS
+		if d.a < prob {
+			*st = sv&0x80 ^ nextMPS
+		} else {
+			*st = sv&0x80 ^ nextLPS
+			sv ^= 0x80
+		}
+		d.a = prob
+	} else if d.a < 0x8000 {
+		//Условный обмен MPS
+		if d.a < prob {
+			*st = sv&0x80 ^ nextLPS
+			sv ^= 0x80
+		} else {
+			*st = sv&0x80 ^ nextMPS
+		}
+	}
+	return sv >> 7
+}
+
+// Декодирование бита с фиксированной вероятностью (refinement DC)
+func (d *Decoder) DecodeFixed(reader *binreader.BinReader) byte {
+	return d.decodeBit(reader, &d.fixed)
+}
+
+// Декодирование младших бит значения с категорией m (F.24), возвращает модуль значения
+func (d *Decoder) decodeBits(reader *binreader.BinReader, stats []byte, st int, m int) int {
+	v := m
+	for m >>= 1; m != 0; m >>= 1 {
+		if d.decodeBit(reader, &stats[st]) != 0 {
+			v |= m
+		}
+	}
+	return v + 1
+}
+
+// Декодирование категории и бит значения (F.21 - F.24)
+// stats - состояния, st - индекс первого состояния категории, magnitude - индекс состояний продолжения категории
+func (d *Decoder) decodeMagnitude(reader *binreader.BinReader, stats []byte, st int, magnitude int) (int, error) {
+	m := int(d.decodeBit(reader, &stats[st]))
+	if m != 0 && d.decodeBit(reader, &stats[st]) != 0 {
+		m <<= 1
+		st = magnitude
+		for d.decodeBit(reader, &stats[st]) != 0 {
+			m <<= 1
+			if m == maxMagnitude {
+				return 0, errors.New("Arithmetic decoding error: magnitude overflow")
+			}
+			st++
+		}
+	}
+
+	return d.decodeBits(reader, stats, st+14, m), nil
+}
+
+// Декодирование разности DC (F.2.4.1)
+// context - категория условного кодирования предыдущей разности компоненты, обновляется
+func (d *Decoder) DecodeDC(reader *binreader.BinReader, tb byte, context *byte) (int16, error) {
+	stats := &d.dcStats[tb]
+	st := int(*context)
+	if d.decodeBit(reader, &stats[st]) == 0 {
+		*context = 0
+		return 0, nil
+	}
+
+	sign := int(d.decodeBit(reader, &stats[st+1]))
+	st += 2 + sign
+
+	//Категория разности: первое состояние без продолжения, затем цепочка с X1
+	m := int(d.decodeBit(reader, &stats[st]))
+	if m != 0 {
+		st = dcMagnitude
+		for d.decodeBit(reader, &stats[st]) != 0 {
+			m <<= 1
+			if m == maxMagnitude {
+				return 0, errors.New("Arithmetic decoding error: magnitude overflow")
+			}
+			st++
+		}
+	}
+
+	//Категория условного кодирования для следующей разности
+	switch {
+	case m < (1<<d.dcL[tb])>>1:
+		*context = 0
+	case m > (1<<d.dcU[tb])>>1:
+		*context = byte(12 + sign*4)
+	default:
+		*context = byte(4 + sign*4)
+	}
+
+	v := d.decodeBits(reader, stats[:], st+14, m)
+	if sign != 0 {
+		v = -v
+	}
+	return int16(v), nil
+}
+
+// Декодирование AC коэффициентов unit[start:end+1] таблицы tb с точностью al (F.2.4.2, G.2)
+func (d *Decoder) DecodeAC(reader *binreader.BinReader, tb byte, unit []int16, start byte, end byte, al byte) error {
+	stats := &d.acStats[tb]
+	for k := int(start); k <= int(end); k++ {
+		st := 3 * (k - 1)
+		if d.decodeBit(reader, &stats[st]) != 0 { //EOB
+			return nil
+		}
+		for d.decodeBit(reader, &stats[st+1]) == 0 {
+			st += 3
+			k++
+			if k > int(end) {
+				return errors.New("Arithmetic decoding error: AC reading failed")
+			}
+		}
+
+		sign := d.DecodeFixed(reader)
+		magnitude := acLowMagnitude
+		if k > int(d.acKx[tb]) {
+			magnitude = acHighMagnitude
+		}
+		v, err := d.decodeMagnitude(reader, stats[:], st+2, magnitude)
+		if err != nil {
+			return err
+		}
+		if sign != 0 {
+			v = -v
+		}
+		unit[k] = int16(v) << al
+	}
+	return nil
+}
+
+// Уточнение AC коэффициентов unit[start:end+1] таблицы tb битом al (G.2)
+func (d *Decoder) DecodeACRefine(reader *binreader.BinReader, tb byte, unit []int16, start byte, end byte, al byte) error {
+	stats := &d.acStats[tb]
+	positive := int16(1) << al
+	negative := int16(-1) << al
+
+	//Конец блока на предыдущем этапе
+	eob := int(end)
+	for ; eob > 0 && unit[eob] == 0; eob-- {
+	}
+
+	for k := int(start); k <= int(end); k++ {
+		st := 3 * (k - 1)
+		if k > eob && d.decodeBit(reader, &stats[st]) != 0 { //EOB
+			return nil
+		}
+		for {
+			if unit[k] != 0 { //Уточнение ненулевого коэффициента
+				if d.decodeBit(reader, &stats[st+2]) != 0 {
+					if unit[k] < 0 {
+						unit[k] += negative
+					} else {
+						unit[k] += positive
+					}
+				}
+				break
+			}
+			if d.decodeBit(reader, &stats[st+1]) != 0 { //Новый ненулевой коэффициент
+				if d.DecodeFixed(reader) != 0 {
+					unit[k] = negative
+				} else {
+					unit[k] = positive
+				}
+				break
+			}
+			st += 3
+			k++
+			if k > int(end) {
+				return errors.New("Arithmetic decoding error: AC refinement failed")
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package decoder
+
+import (
+	"bytes"
+	"os"
+	"testing"
+)
+
+// Арифметически закодированные файлы и те же коэффициенты в кодировании Хаффмана
+var arithmeticPics = [][2]string{
+	{"pics/Arithmetic/Sequential.jpg", "pics/Arithmetic/SequentialHuffman.jpg"},
+	{"pics/Arithmetic/Restart.jpg", "pics/Arithmetic/RestartHuffman.jpg"},
+	{"pics/Arithmetic/Progressive.jpg", "pics/Arithmetic/ProgressiveHuffman.jpg"},
+	{"pics/Arithmetic/ProgressiveRestart.jpg", "pics/Arithmetic/ProgressiveRestartHuffman.jpg"},
+}
+
+func TestDecodeArithmetic(t *testing.T) {
+	for _, pair := range arithmeticPics {
+		arith, err := os.ReadFile(pair[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		huff, err := os.ReadFile(pair[1])
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		got, err := Decode(bytes.NewReader(arith))
+		if err != nil {
+			t.Fatal(pair[0], "Decode -> error", err.Error())
+		}
+		want, err := Decode(bytes.NewReader(huff))
+		if err != nil {
+			t.Fatal(pair[1], "Decode -> error", err.Error())
+		}
+
+		//Энтропийное кодирование без потерь: результат совпадает точно
+		compareImages(t, pair[0], got, want, 0, 0)
+		compareImages(t, pair[1], want, decodeStd(t, huff), 16, 1)
+	}
+}
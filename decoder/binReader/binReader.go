@@ -2,6 +2,7 @@ package binreader
 
 import (
 	"bufio"
+	"bytes"
 	"os"
 )
 
@@ -13,13 +14,20 @@ const (
 	LITTLE
 )
 
+const bufferBits = 64 //Размер битового буфера
+
 type BinReader struct {
 	src          *bufio.Reader //Источник для чтения
 	curFile      *os.File
 	end          Endian //Endianness
 	isHuffStream bool   //Флаг вычисления битового потока (для пропуска нулей в 0xFF-0x00)
 	curByte      byte   //Текущее значение байта для побитового чтения
-	bitCount     byte   //Счетчик бит в текущем байте
+	bitCount     byte   //Счетчик бит в текущем байте (для LITTLE)
+	bits         uint64 //Битовый буфер BIG, непрочитанные биты в младших bitsLeft разрядах
+	bitsLeft     uint   //Количество непрочитанных бит в буфере
+	padBits      uint   //Количество нулевых бит дополнения в конце буфера после маркера
+	wasMarker    bool   //Битовый поток Хаффмана дошел до маркера
+	eof          bool   //Данные источника закончились раньше, чем требовалось
 }
 
 // Инициализация объекта BinReader на расположение source
@@ -46,6 +54,7 @@ func (b *BinReader) SetEndian(end Endian) {
 // Запуск чтения битового потока Хаффмана
 func (b *BinReader) HuffStreamStart() {
 	b.bitCount = 0
+	b.resetBits()
 	b.isHuffStream = true
 }
 
@@ -54,18 +63,111 @@ func (b *BinReader) HuffStreamEnd() {
 	b.isHuffStream = false
 }
 
-// Чтение одного байта
-func (b *BinReader) GetByte() byte {
-	ans, _ := b.src.ReadByte()
+// Проверка, что при чтении данные источника закончились раньше, чем требовалось
+func (b *BinReader) EOF() bool {
+	return b.eof
+}
+
+// Очистка битового буфера
+func (b *BinReader) resetBits() {
+	b.bits = 0
+	b.bitsLeft = 0
+	b.padBits = 0
+	b.wasMarker = false
+}
+
+// Пропуск непрочитанных бит неполного байта в буфере, дополнение после маркера отбрасывается
+// Возвращает количество оставшихся в буфере целых байт
+func (b *BinReader) alignBits() uint {
+	whole := b.bitsLeft - b.padBits
+	whole -= whole % 8
+	if whole == 0 {
+		b.resetBits()
+		return 0
+	}
+	b.bitsLeft = whole + b.padBits
+	return whole / 8
+}
+
+// Извлечение следующего целого байта из битового буфера
+func (b *BinReader) bufferedByte() byte {
+	b.bitsLeft -= 8
+	b.curByte = byte(b.bits >> b.bitsLeft)
+	return b.curByte
+}
 
-	if b.isHuffStream && b.curByte == 0xFF && ans == 0x00 {
-		ans, _ = b.src.ReadByte()
+// Чтение байта из источника, в потоке Хаффмана с пропуском 0x00 после 0xFF
+func (b *BinReader) readByte() byte {
+	ans, err := b.src.ReadByte()
+
+	if err == nil && b.isHuffStream && b.curByte == 0xFF && ans == 0x00 {
+		ans, err = b.src.ReadByte()
+	}
+	if err != nil {
+		b.eof = true
 	}
 
 	b.curByte = ans
 	return ans
 }
 
+// Дополнение битового буфера до n бит
+// В потоке Хаффмана чтение останавливается перед маркером, недостающие биты заполняются нулями
+func (b *BinReader) fill(n uint) {
+	if !b.isHuffStream {
+		for b.bitsLeft <= bufferBits-8 {
+			next, _ := b.src.ReadByte()
+			b.bits = b.bits<<8 | uint64(next)
+			b.bitsLeft += 8
+		}
+		return
+	}
+	for b.bitsLeft < n && !b.wasMarker && b.bitsLeft <= bufferBits-8 {
+		//Байты разбираются прямо в буфере источника, 0xFF в конце может быть началом маркера
+		data, _ := b.src.Peek(min(max(b.src.Buffered(), 2), int(bufferBits-b.bitsLeft)/8+1))
+		if len(data) == 0 {
+			b.wasMarker = true
+			b.eof = true
+		}
+		pos := 0
+		for b.bitsLeft <= bufferBits-8 && pos < len(data) {
+			next := data[pos]
+			if next == 0xFF {
+				if pos+1 == len(data) && pos != 0 {
+					break
+				}
+				if pos+1 == len(data) || data[pos+1] != 0x00 {
+					//Запрашивается не меньше 2 байт, одиночный 0xFF - конец данных
+					if pos+1 == len(data) {
+						b.eof = true
+					}
+					b.wasMarker = true
+					break
+				}
+				pos++
+			}
+			pos++
+			b.bits = b.bits<<8 | uint64(next)
+			b.bitsLeft += 8
+		}
+		b.src.Discard(pos)
+	}
+	//Нулевое дополнение после маркера или конца данных
+	for b.wasMarker && b.bitsLeft < n {
+		b.bits = b.bits << 8
+		b.bitsLeft += 8
+		b.padBits += 8
+	}
+}
+
+// Чтение одного байта
+func (b *BinReader) GetByte() byte {
+	if b.bitsLeft != 0 && b.alignBits() != 0 {
+		return b.bufferedByte()
+	}
+	return b.readByte()
+}
+
 // Чтение двух байт
 func (b *BinReader) GetWord() uint16 {
 
@@ -81,12 +183,97 @@ func (b *BinReader) GetWord() uint16 {
 	return ans
 }
 
-// Получение следующего байта без смещения указателя
+// Чтение четырех байт
+func (b *BinReader) GetDWord() uint32 {
+	first, second := uint32(b.GetWord()), uint32(b.GetWord())
+	if b.end == BIG {
+		return first<<16 | second
+	}
+	return second<<16 | first
+}
+
+// Получение следующего байта без смещения указателя, 0 если данных не осталось
 func (b *BinReader) GetNextByte() byte {
-	ans, _ := b.src.Peek(1)
+	if b.bitsLeft != 0 && b.alignBits() != 0 {
+		return byte(b.bits >> (b.bitsLeft - 8))
+	}
+	ans, err := b.src.Peek(1)
+	if err != nil {
+		b.eof = true
+		return 0
+	}
 	return ans[0]
 }
 
+// Получение следующих двух байт без смещения указателя, 0 если данных не осталось
+func (b *BinReader) GetNextWord() uint16 {
+	if b.bitsLeft != 0 {
+		switch b.alignBits() {
+		case 0:
+		case 1:
+			ans, err := b.src.Peek(1)
+			if err != nil {
+				b.eof = true
+				return 0
+			}
+			return uint16(b.bits>>(b.bitsLeft-8))<<8 | uint16(ans[0])
+		default:
+			return uint16(b.bits >> (b.bitsLeft - 16))
+		}
+	}
+	ans, err := b.src.Peek(2)
+	if err != nil {
+		b.eof = true
+		return 0
+	}
+	return uint16(ans[0])<<8 | uint16(ans[1])
+}
+
+// Пропуск байт до следующего маркера (0xFF, за которым следует не 0x00 и не 0xFF)
+// Байты в битовом буфере предшествуют маркеру и отбрасываются
+func (b *BinReader) SkipToMarker() {
+	b.resetBits()
+	for {
+		word := b.GetNextWord()
+		if word == 0 || (word>>8 == 0xFF && word&0xFF != 0x00 && word&0xFF != 0xFF) {
+			return
+		}
+		b.src.ReadByte()
+	}
+}
+
+// Чтение байт энтропийного сегмента до следующего маркера без удаления байт-стаффинга
+// Маркер остается непрочитанным
+func (b *BinReader) ReadToMarker() []byte {
+	b.resetBits()
+	var res []byte
+	for {
+		data, _ := b.src.Peek(max(b.src.Buffered(), 1))
+		if len(data) == 0 {
+			b.eof = true
+			return res
+		}
+		pos := bytes.IndexByte(data, 0xFF)
+		if pos < 0 {
+			res = append(res, data...)
+			b.src.Discard(len(data))
+			continue
+		}
+		res = append(res, data[:pos]...)
+		b.src.Discard(pos)
+		next, err := b.src.Peek(2)
+		if err != nil {
+			b.eof = true
+			return res
+		}
+		if next[1] != 0x00 {
+			return res
+		}
+		res = append(res, 0xFF, 0x00)
+		b.src.Discard(2)
+	}
+}
+
 // Чтение байта по 4бита
 func (b *BinReader) Get4Bit() (byte, byte) {
 	temp := b.GetByte()
@@ -96,13 +283,7 @@ func (b *BinReader) Get4Bit() (byte, byte) {
 // Чтение одного бита
 func (b *BinReader) GetBit() byte {
 	if b.end == BIG {
-		if b.bitCount == 0 {
-			b.GetByte()
-			b.bitCount = 8
-		}
-		b.bitCount--
-		temp := b.curByte >> b.bitCount
-		return temp & 1
+		return byte(b.GetBits(1))
 	} else {
 		if b.bitCount == 8 {
 			b.GetByte()
@@ -114,11 +295,36 @@ func (b *BinReader) GetBit() byte {
 	}
 }
 
-// Чтение n бит
+// Получение следующих n бит (n <= 16) без смещения указателя
+func (b *BinReader) PeekBits(n byte) uint16 {
+	if n > 16 {
+		panic("binreader: PeekBits supports at most 16 bits")
+	}
+	if b.bitsLeft < uint(n) {
+		b.fill(uint(n))
+	}
+	return uint16(b.bits>>(b.bitsLeft-uint(n))) & (1<<n - 1)
+}
+
+// Пропуск n бит, ранее полученных PeekBits
+func (b *BinReader) SkipBits(n byte) {
+	b.bitsLeft -= uint(n)
+	b.padBits = min(b.padBits, b.bitsLeft)
+}
+
+// Чтение n бит (n <= 16)
 func (b *BinReader) GetBits(n byte) uint16 {
+	if n > 16 {
+		panic("binreader: GetBits supports at most 16 bits")
+	}
 	if n == 0 {
 		return 0
 	}
+	if b.end == BIG {
+		ans := b.PeekBits(n)
+		b.SkipBits(n)
+		return ans
+	}
 	var ans uint16
 	for range n {
 		ans = ans << 1
@@ -129,12 +335,12 @@ func (b *BinReader) GetBits(n byte) uint16 {
 
 // Пропуск оставшихся бит в байте
 func (b *BinReader) BitsAlign() {
-	b.GetByte()
 	if b.end == BIG {
-		b.bitCount = 8
-	} else {
-		b.bitCount = 0
+		b.alignBits()
+		return
 	}
+	b.GetByte()
+	b.bitCount = 0
 }
 
 // Чтение n байт
@@ -1,11 +1,28 @@
 package binreader
 
-import "testing"
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
 
-const source = "../pics/Aqours.jpg" //Файл с данными, по которому делается тест
+const source = "../pics/Baseline/Aqours.jpg" //Файл с данными, по которому делается тест
+
+// Открытие файла path и создание BinReader с порядком байт end
+func openReader(path string, end Endian) (*BinReader, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	reader := BinReaderInit(bufio.NewReader(file))
+	reader.SetEndian(end)
+	return reader, nil
+}
 
 func TestGetByte(t *testing.T) {
-	reader, err := BinReaderInit(source, BIG)
+	reader, err := openReader(source, BIG)
 	if err != nil {
 		t.Fatal("BinReaderInit -> error", err.Error())
 	}
@@ -18,14 +35,14 @@ func TestGetByte(t *testing.T) {
 }
 
 func TestGetWord(t *testing.T) {
-	reader, err := BinReaderInit(source, BIG)
+	reader, err := openReader(source, BIG)
 	if err != nil {
 		t.Fatal("BinReaderInit -> error", err.Error())
 	}
 	if temp := reader.GetWord(); temp != 0xFFD8 {
 		t.Fatal("Read:", temp, "Expect:", 0xFFD8)
 	}
-	reader, err = BinReaderInit(source, LITTLE)
+	reader, err = openReader(source, LITTLE)
 	if err != nil {
 		t.Fatal("BinReaderInit -> error", err.Error())
 	}
@@ -34,8 +51,25 @@ func TestGetWord(t *testing.T) {
 	}
 }
 
+func TestGetDWord(t *testing.T) {
+	reader, err := openReader(source, BIG)
+	if err != nil {
+		t.Fatal("BinReaderInit -> error", err.Error())
+	}
+	if temp := reader.GetDWord(); temp != 0xFFD8FFE0 {
+		t.Fatal("Read:", temp, "Expect:", 0xFFD8FFE0)
+	}
+	reader, err = openReader(source, LITTLE)
+	if err != nil {
+		t.Fatal("BinReaderInit -> error", err.Error())
+	}
+	if temp := reader.GetDWord(); temp != 0xE0FFD8FF {
+		t.Fatal("Read:", temp, "Expect:", 0xE0FFD8FF)
+	}
+}
+
 func TestGetArray(t *testing.T) {
-	reader, err := BinReaderInit(source, BIG)
+	reader, err := openReader(source, BIG)
 	if err != nil {
 		t.Fatal("BinReaderInit -> error", err.Error())
 	}
@@ -49,7 +83,7 @@ func TestGetArray(t *testing.T) {
 }
 
 func TestGet4Bit(t *testing.T) {
-	reader, err := BinReaderInit(source, BIG)
+	reader, err := openReader(source, BIG)
 	if err != nil {
 		t.Fatal("BinReaderInit -> error", err.Error())
 	}
@@ -60,7 +94,7 @@ func TestGet4Bit(t *testing.T) {
 }
 
 func TestGetBit(t *testing.T) {
-	reader, err := BinReaderInit(source, BIG)
+	reader, err := openReader(source, BIG)
 	if err != nil {
 		t.Fatal("BinReaderInit -> error", err.Error())
 	}
@@ -82,7 +116,7 @@ func TestGetBit(t *testing.T) {
 }
 
 func TestGetBits(t *testing.T) {
-	reader, err := BinReaderInit(source, BIG)
+	reader, err := openReader(source, BIG)
 	if err != nil {
 		t.Fatal("BinReaderInit -> error", err.Error())
 	}
@@ -98,7 +132,7 @@ func TestGetBits(t *testing.T) {
 }
 
 func TestBitsAlign(t *testing.T) {
-	reader, err := BinReaderInit(source, BIG)
+	reader, err := openReader(source, BIG)
 	if err != nil {
 		t.Fatal("BinReaderInit -> error", err.Error())
 	}
@@ -110,7 +144,7 @@ func TestBitsAlign(t *testing.T) {
 }
 
 func TestGetNextByte(t *testing.T) {
-	reader, err := BinReaderInit(source, BIG)
+	reader, err := openReader(source, BIG)
 	if err != nil {
 		t.Fatal("BinReaderInit -> error", err.Error())
 	}
@@ -119,3 +153,55 @@ func TestGetNextByte(t *testing.T) {
 		t.Fatal("Read:", temp, "Expect:", 0xD8)
 	}
 }
+
+func TestGetNextByteEOF(t *testing.T) {
+	reader := BinReaderInit(bufio.NewReader(bytes.NewReader([]byte{0x12})))
+	reader.GetByte()
+	if reader.EOF() {
+		t.Fatal("EOF -> expect false before end of data")
+	}
+	if temp := reader.GetNextByte(); temp != 0 || !reader.EOF() {
+		t.Fatal("Read:", temp, reader.EOF(), "Expect:", 0, true)
+	}
+}
+
+func TestReadToMarker(t *testing.T) {
+	data := []byte{0x12, 0xFF, 0x00, 0x34, 0xFF, 0xD0, 0x56}
+	reader := BinReaderInit(bufio.NewReader(bytes.NewReader(data)))
+	segment := reader.ReadToMarker()
+	if !bytes.Equal(segment, data[:4]) {
+		t.Fatal("Read:", segment, "Expect:", data[:4])
+	}
+	if temp := reader.GetWord(); temp != 0xFFD0 {
+		t.Fatal("Read:", temp, "Expect:", 0xFFD0)
+	}
+	if segment := reader.ReadToMarker(); !bytes.Equal(segment, data[6:]) {
+		t.Fatal("Read:", segment, "Expect:", data[6:])
+	}
+}
+
+func TestGetBitsTooLong(t *testing.T) {
+	data := bytes.Repeat([]byte{0x55}, 32)
+	reader := BinReaderInit(bufio.NewReader(bytes.NewReader(data)))
+	reader.HuffStreamStart()
+	//Заполненный буфер не должен приводить к зацикливанию
+	reader.GetBits(12)
+	if temp := reader.PeekBits(16); temp != 0x5555 {
+		t.Fatal("Read:", temp, "Expect:", 0x5555)
+	}
+
+	//Больше 16 бит за раз читать нельзя: вызов завершается паникой, а не зацикливанием
+	done := make(chan any, 1)
+	go func() {
+		defer func() { done <- recover() }()
+		reader.GetBits(69)
+	}()
+	select {
+	case res := <-done:
+		if res == nil {
+			t.Fatal("GetBits(69) -> expect panic")
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("GetBits(69) -> hang")
+	}
+}
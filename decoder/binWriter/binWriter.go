@@ -5,34 +5,41 @@ import (
 	"os"
 )
 
-var writer *bufio.Writer
+type BinWriter struct {
+	file   *os.File      //Файл для записи
+	writer *bufio.Writer //Буфер записи в файл
+}
 
-func BinwriterInit(fileName string) error {
+// Создание файла fileName и объекта BinWriter для записи в него
+func BinWriterInit(fileName string) (*BinWriter, error) {
 	file, err := os.Create(fileName)
 	if err != nil {
-		return err
+		return nil, err
 	}
-	writer = bufio.NewWriter(file)
-	return nil
+	return &BinWriter{file: file, writer: bufio.NewWriter(file)}, nil
 }
 
-func Close() error {
-	err := writer.Flush()
+// Запись буфера и закрытие файла
+func (b *BinWriter) Close() error {
+	err := b.writer.Flush()
+	if closeErr := b.file.Close(); err == nil {
+		err = closeErr
+	}
 	return err
 }
 
-func PutInt(num uint) {
-	writer.WriteByte(byte(num >> 0))
-	writer.WriteByte(byte(num >> 8))
-	writer.WriteByte(byte(num >> 16))
-	writer.WriteByte(byte(num >> 24))
+func (b *BinWriter) PutInt(num uint) {
+	b.writer.WriteByte(byte(num >> 0))
+	b.writer.WriteByte(byte(num >> 8))
+	b.writer.WriteByte(byte(num >> 16))
+	b.writer.WriteByte(byte(num >> 24))
 }
 
-func PutShort(num uint) {
-	writer.WriteByte(byte(num >> 0))
-	writer.WriteByte(byte(num >> 8))
+func (b *BinWriter) PutShort(num uint) {
+	b.writer.WriteByte(byte(num >> 0))
+	b.writer.WriteByte(byte(num >> 8))
 }
 
-func PutChar(num byte) {
-	writer.WriteByte(num)
+func (b *BinWriter) PutChar(num byte) {
+	b.writer.WriteByte(num)
 }
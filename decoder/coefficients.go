@@ -0,0 +1,159 @@
+package decoder
+
+import "errors"
+
+// Сегмент приложения APPn
+type AppSegment struct {
+	Marker uint16 //Маркер сегмента APP0 - APP15
+	Data   []byte //Данные сегмента без маркера и длины
+}
+
+// Параметры скана
+type ScanInfo struct {
+	Comps []int //Номера компонент в кадре
+	Ss    byte  //Начало spectral selection
+	Se    byte  //Конец spectral selection
+	Ah    byte  //Предыдущий бит successive approximation
+	Al    byte  //Текущий бит successive approximation
+}
+
+// Порядок коэффициентов в блоке
+type CoefOrder byte
+
+const (
+	ZigZagOrder  CoefOrder = iota //Порядок зиг-зага, как в потоке
+	NaturalOrder                  //Построчный порядок матрицы 8x8
+)
+
+// Квантованные коэффициенты ДКП одной компоненты
+type CompCoefficients struct {
+	ID           byte        //Идентификатор компоненты из заголовка фрейма
+	H            byte        //Горизонтальный фактор
+	V            byte        //Вертикальный фактор
+	QuantTableID byte        //Номер таблицы квантования
+	BlocksHeight int         //Количество блоков, покрывающих компоненту по высоте
+	BlocksWidth  int         //Количество блоков, покрывающих компоненту по ширине
+	Blocks       [][][]int16 //Блоки, дополненные до целого количества MCU
+}
+
+// Квантованные коэффициенты ДКП изображения и параметры для их повторной записи
+type Coefficients struct {
+	ImageHeight     uint16                //Высота изображения
+	ImageWidth      uint16                //Ширина изображения
+	SamplePrecision byte                  //Глубина цвета в битах на отсчет
+	IsProgressive   bool                  //Флаг прогрессивного изображения
+	Order           CoefOrder             //Порядок коэффициентов в блоках и таблицах квантования
+	QuantTables     [numOfTables][]uint16 //Таблицы квантования, nil для незаданных
+	Comps           []CompCoefficients    //Коэффициенты компонент
+	Scans           []ScanInfo            //Параметры сканов в порядке чтения
+	Apps            []AppSegment          //Сегменты приложений в порядке чтения
+}
+
+// Параметры текущего скана
+func (jpeg *JPEG) scanInfo() ScanInfo {
+	res := ScanInfo{Ss: jpeg.startSpectral, Se: jpeg.endSpectral, Ah: jpeg.saHigh, Al: jpeg.saLow}
+	for i := range jpeg.numOfComps {
+		if jpeg.comps[i].used {
+			res.Comps = append(res.Comps, int(i))
+		}
+	}
+	return res
+}
+
+// Перестановка блока data из порядка from в порядок to
+func reorder[T int16 | uint16](data []T, from CoefOrder, to CoefOrder) []T {
+	if data == nil || from == to {
+		return data
+	}
+	res := make([]T, len(data))
+	for i := range unitRowCount {
+		for j := range unitColCount {
+			natural, zigZag := i*unitColCount+j, int(zigZagTable[i][j])
+			if to == NaturalOrder {
+				res[natural] = data[zigZag]
+			} else {
+				res[zigZag] = data[natural]
+			}
+		}
+	}
+	return res
+}
+
+// Коэффициенты в порядке order, при совпадении порядка возвращаются без копирования
+func (c *Coefficients) InOrder(order CoefOrder) *Coefficients {
+	if c.Order == order {
+		return c
+	}
+	res := *c
+	res.Order = order
+	for i, table := range c.QuantTables {
+		res.QuantTables[i] = reorder(table, c.Order, order)
+	}
+	res.Comps = make([]CompCoefficients, len(c.Comps))
+	for i, comp := range c.Comps {
+		blocks := make([][][]int16, len(comp.Blocks))
+		for row := range blocks {
+			blocks[row] = make([][]int16, len(comp.Blocks[row]))
+			for col, unit := range comp.Blocks[row] {
+				blocks[row][col] = reorder(unit, c.Order, order)
+			}
+		}
+		comp.Blocks = blocks
+		res.Comps[i] = comp
+	}
+	return &res
+}
+
+// Чтение всех сканов изображения в квантованные коэффициенты ДКП без вычисления пикселей
+// Коэффициенты и таблицы квантования возвращаются в порядке order
+func (jpeg *JPEG) ReadCoefficients(order CoefOrder) (*Coefficients, error) {
+	if order != ZigZagOrder && order != NaturalOrder {
+		return nil, errors.New("Unknown coefficient order")
+	}
+	if jpeg.IsLossless {
+		return nil, errors.New("Lossless image has no DCT coefficients")
+	}
+	if jpeg.CurStatus != 0 {
+		return nil, errors.New("Coefficients must be read before the image")
+	}
+	if err := jpeg.Options.validate(); err != nil {
+		return nil, err
+	}
+
+	jpeg.constInit()
+	if _, ok := jpeg.decodeScans(0); !ok || jpeg.reader.EOF() {
+		return nil, jpeg.err()
+	}
+
+	res := Coefficients{
+		ImageHeight:     jpeg.ImageHeight,
+		ImageWidth:      jpeg.ImageWidth,
+		SamplePrecision: jpeg.SamplePrecision,
+		IsProgressive:   jpeg.IsProgressive,
+		QuantTables:     jpeg.quantTables,
+		Scans:           jpeg.scans,
+		Apps:            jpeg.apps,
+	}
+	res.Comps = make([]CompCoefficients, jpeg.numOfComps)
+	for i := range res.Comps {
+		comp := &jpeg.comps[i]
+		plane := CompCoefficients{
+			ID:           comp.id,
+			H:            comp.h,
+			V:            comp.v,
+			QuantTableID: comp.quantTableID,
+			BlocksHeight: int(comp.blocksHeight),
+			BlocksWidth:  int(comp.blocksWidth),
+			Blocks:       make([][][]int16, int(jpeg.numBlocksHeight)*int(comp.v)),
+		}
+		for row := range plane.Blocks {
+			plane.Blocks[row] = make([][]int16, int(jpeg.numBlocksWidth)*int(comp.h))
+			for col := range plane.Blocks[row] {
+				mcuRow, mcuCol := jpeg.blockPos(comp, row, col)
+				plane.Blocks[row][col] = jpeg.blocks[mcuRow][mcuCol].channel(Channel(i))
+			}
+		}
+		res.Comps[i] = plane
+	}
+	return res.InOrder(order), nil
+}
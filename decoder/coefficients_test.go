@@ -0,0 +1,107 @@
+package decoder
+
+import (
+	"bufio"
+	"bytes"
+	"os"
+	"testing"
+)
+
+// Чтение коэффициентов из содержимого файла data в порядке order
+func readTestCoefficients(t *testing.T, data []byte, order CoefOrder) *Coefficients {
+	t.Helper()
+	jpeg, err := ReadJPEG(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal("ReadJPEG -> error", err.Error())
+	}
+	res, err := jpeg.ReadCoefficients(order)
+	if err != nil {
+		t.Fatal("ReadCoefficients -> error", err.Error())
+	}
+	return res
+}
+
+func TestReadCoefficients(t *testing.T) {
+	data, err := os.ReadFile("pics/Gray/GrayBaseline.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	zigZag := readTestCoefficients(t, data, ZigZagOrder)
+	natural := readTestCoefficients(t, data, NaturalOrder)
+
+	comp := zigZag.Comps[0]
+	if comp.H != 1 || comp.V != 1 || comp.BlocksHeight != 10 || comp.BlocksWidth != 13 {
+		t.Fatal("Read component:", comp.H, comp.V, comp.BlocksHeight, comp.BlocksWidth, "Expect: 1 1 10 13")
+	}
+
+	//Второй элемент зиг-зага - (0, 1), третий - (1, 0)
+	quant := zigZag.QuantTables[comp.QuantTableID]
+	naturalQuant := natural.QuantTables[comp.QuantTableID]
+	if naturalQuant[1] != quant[1] || naturalQuant[unitColCount] != quant[2] {
+		t.Fatal("Quant tables orders mismatch")
+	}
+	unit := comp.Blocks[3][4]
+	naturalUnit := natural.Comps[0].Blocks[3][4]
+	if naturalUnit[1] != unit[1] || naturalUnit[unitColCount] != unit[2] || naturalUnit[sizeOfTable-1] != unit[sizeOfTable-1] {
+		t.Fatal("Coefficient orders mismatch")
+	}
+
+	//DC блока - среднее значение его отсчетов, умноженное на 8
+	img, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("Decode -> error", err.Error())
+	}
+	for row := range comp.BlocksHeight - 1 {
+		for col := range comp.BlocksWidth - 1 {
+			sum := 0
+			for y := range unitRowCount {
+				for x := range unitColCount {
+					r, _, _, _ := img.At(col*unitColCount+x, row*unitRowCount+y).RGBA()
+					sum += int(r >> 8)
+				}
+			}
+			mean := float64(sum) / (unitRowCount * unitColCount)
+			dc := float64(comp.Blocks[row][col][0])*float64(quant[0])/8 + 128
+			if mean-dc > 2 || dc-mean > 2 {
+				t.Fatalf("Block (%d, %d): DC %f, mean %f", row, col, dc, mean)
+			}
+		}
+	}
+}
+
+func TestReadCoefficientsErrors(t *testing.T) {
+	data, err := os.ReadFile("pics/Gray/GrayBaseline.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jpeg, err := ReadJPEG(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal("ReadJPEG -> error", err.Error())
+	}
+	if _, err := jpeg.ReadCoefficients(CoefOrder(2)); err == nil {
+		t.Fatal("ReadCoefficients with unknown order -> expect error")
+	}
+	if _, err := jpeg.ReadGrayJPEG(CreateGrayMatrix(jpeg.ImageHeight, jpeg.ImageWidth), 0); err != nil {
+		t.Fatal("ReadGrayJPEG -> error", err.Error())
+	}
+	if _, err := jpeg.ReadCoefficients(ZigZagOrder); err == nil {
+		t.Fatal("ReadCoefficients after image -> expect error")
+	}
+}
+
+func BenchmarkReadCoefficients(b *testing.B) {
+	data, err := os.ReadFile("pics/Baseline/Aqours.jpg")
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.SetBytes(int64(len(data)))
+	for range b.N {
+		jpeg, err := ReadJPEG(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			b.Fatal("ReadJPEG -> error", err.Error())
+		}
+		if _, err := jpeg.ReadCoefficients(ZigZagOrder); err != nil {
+			b.Fatal("ReadCoefficients -> error", err.Error())
+		}
+	}
+}
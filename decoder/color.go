@@ -0,0 +1,209 @@
+package decoder
+
+import "math"
+
+type Image = [][]Rgb
+type GrayImage = [][]byte
+type CMYKImage = [][]Cmyk
+type Image16 = [][]Rgb16
+type Gray16Image = [][]uint16
+type yCbCrMatrix = [][]yCbCr
+
+// Структура для хранения данных в RGB формате
+type Rgb struct {
+	R byte
+	G byte
+	B byte
+}
+
+// Структура для хранения данных в RGB формате с 16 битами на отсчет
+// Значения хранятся в исходной глубине изображения (0-4095 для 12 бит)
+type Rgb16 struct {
+	R uint16
+	G uint16
+	B uint16
+}
+
+// Структура для хранения данных в CMYK формате
+type Cmyk struct {
+	C byte
+	M byte
+	Y byte
+	K byte
+}
+
+// Структура для хранения данных в YCbCr формате
+// Для RGB и CMYK в полях хранятся компоненты в порядке их следования в кадре
+type yCbCr struct {
+	y  float32
+	cb float32
+	cr float32
+	k  float32 //Четвертая компонента CMYK/YCCK
+}
+
+// Запись значения канала ch
+func (cur *yCbCr) set(ch Channel, val float32) {
+	switch ch {
+	case Y:
+		cur.y = val
+	case Cb:
+		cur.cb = val
+	case Cr:
+		cur.cr = val
+	case K:
+		cur.k = val
+	}
+}
+
+// Диапазон отсчетов для глубины цвета изображения
+type sampleRange struct {
+	delta  int //Константа, которая прибавляется при переводе в RGB (128 для 8 бит, 2048 для 12)
+	maxVal int //Максимальное значение отсчета
+}
+
+// Диапазон отсчетов для глубины precision
+func newSampleRange(precision byte) sampleRange {
+	return sampleRange{
+		delta:  1 << (precision - 1),
+		maxVal: 1<<precision - 1,
+	}
+}
+
+// Проверка в диапазоне 0-maxVal
+func (s sampleRange) clamp(val int) int {
+	if val < 0 {
+		return 0
+	}
+	if val > s.maxVal {
+		return s.maxVal
+	}
+	return val
+}
+
+// Перевод значения после ОДКП в отсчет
+func (s sampleRange) toSample(val float32) int {
+	return s.clamp(int(math.Round(float64(val))) + s.delta)
+}
+
+// Приведение отсчета к 8 битам
+func (s sampleRange) to8(val int) byte {
+	if s.maxVal == 0xFF {
+		return byte(val)
+	}
+	return byte((val*0xFF + s.maxVal/2) / s.maxVal)
+}
+
+// Растяжение отсчета на весь 16-битный диапазон
+func (s sampleRange) to16(val uint16) uint16 {
+	return uint16((int(val)*0xFFFF + s.maxVal/2) / s.maxVal)
+}
+
+// Перевод в RGB пространство
+func (cur *yCbCr) toRGB(s sampleRange) (int, int, int) {
+	y := float64(cur.y) + float64(s.delta)
+	r := s.clamp(int(math.Round(y + 1.402*float64(cur.cr))))
+	g := s.clamp(int(math.Round(y - 0.34414*float64(cur.cb) - 0.71414*float64(cur.cr))))
+	b := s.clamp(int(math.Round(y + 1.772*float64(cur.cb))))
+	return r, g, b
+}
+
+// Компоненты без цветового преобразования в RGB
+func (cur *yCbCr) rawRGB(s sampleRange) (int, int, int) {
+	return s.toSample(cur.y), s.toSample(cur.cb), s.toSample(cur.cr)
+}
+
+// Перевод в CMYK, inverted - флаг инвертированного хранения (сегмент Adobe)
+func (cur *yCbCr) toCMYK(s sampleRange, transform colorTransform, inverted bool) (int, int, int, int) {
+	if transform == transformYCCK {
+		//Инверсия CMY относительно RGB компенсирует инверсию Adobe, инвертируется только K
+		r, g, b := cur.toRGB(s)
+		return r, g, b, s.maxVal - s.toSample(cur.k)
+	}
+
+	c, m, y, k := s.toSample(cur.y), s.toSample(cur.cb), s.toSample(cur.cr), s.toSample(cur.k)
+	if inverted {
+		return s.maxVal - c, s.maxVal - m, s.maxVal - y, s.maxVal - k
+	}
+	return c, m, y, k
+}
+
+// Перевод CMYK в RGB
+func (s sampleRange) cmykToRGB(c int, m int, y int, k int) (int, int, int) {
+	w := s.maxVal - k
+	return (s.maxVal - c) * w / s.maxVal, (s.maxVal - m) * w / s.maxVal, (s.maxVal - y) * w / s.maxVal
+}
+
+// Перевод RGB в CMYK
+func (s sampleRange) rgbToCMYK(r int, g int, b int) (int, int, int, int) {
+	w := max(r, g, b)
+	if w == 0 {
+		return 0, 0, 0, s.maxVal
+	}
+	return (w - r) * s.maxVal / w, (w - g) * s.maxVal / w, (w - b) * s.maxVal / w, s.maxVal - w
+}
+
+// Перевод RGB в оттенок серого
+func (s sampleRange) rgbToGray(r int, g int, b int) int {
+	return (299*r + 587*g + 114*b + 500) / 1000
+}
+
+// Флаг того, что оттенок серого определяется только первой компонентой
+func (jpeg *JPEG) lumaOnly() bool {
+	return jpeg.transform == transformGray || jpeg.transform == transformYCbCr
+}
+
+// Перевод пикселя в RGB с учетом цветового пространства изображения
+func (jpeg *JPEG) pixelRGB(cur *yCbCr) (int, int, int) {
+	s := jpeg.samples
+	switch jpeg.transform {
+	case transformGray:
+		val := s.toSample(cur.y)
+		return val, val, val
+	case transformRGB:
+		return cur.rawRGB(s)
+	case transformCMYK, transformYCCK:
+		return s.cmykToRGB(cur.toCMYK(s, jpeg.transform, jpeg.adobe))
+	default:
+		return cur.toRGB(s)
+	}
+}
+
+// Перевод пикселя в CMYK с учетом цветового пространства изображения
+func (jpeg *JPEG) pixelCMYK(cur *yCbCr) (int, int, int, int) {
+	s := jpeg.samples
+	switch jpeg.transform {
+	case transformCMYK, transformYCCK:
+		return cur.toCMYK(s, jpeg.transform, jpeg.adobe)
+	default:
+		return s.rgbToCMYK(jpeg.pixelRGB(cur))
+	}
+}
+
+// Перевод пикселя в оттенок серого с учетом цветового пространства изображения
+func (jpeg *JPEG) pixelGray(cur *yCbCr) int {
+	if jpeg.lumaOnly() {
+		return jpeg.samples.toSample(cur.y)
+	}
+	return jpeg.samples.rgbToGray(jpeg.pixelRGB(cur))
+}
+
+// Запись пикселя в установленный буфер результата
+// x y - координаты пикселя в результате
+func (jpeg *JPEG) storePixel(cur *yCbCr, x int, y int) {
+	s := jpeg.samples
+	switch {
+	case jpeg.cmyk != nil:
+		c, m, ye, k := jpeg.pixelCMYK(cur)
+		jpeg.cmyk[x][y] = Cmyk{C: s.to8(c), M: s.to8(m), Y: s.to8(ye), K: s.to8(k)}
+	case jpeg.gray != nil:
+		jpeg.gray[x][y] = s.to8(jpeg.pixelGray(cur))
+	case jpeg.gray16 != nil:
+		jpeg.gray16[x][y] = uint16(jpeg.pixelGray(cur))
+	case jpeg.img16 != nil:
+		r, g, b := jpeg.pixelRGB(cur)
+		jpeg.img16[x][y] = Rgb16{R: uint16(r), G: uint16(g), B: uint16(b)}
+	default:
+		r, g, b := jpeg.pixelRGB(cur)
+		jpeg.img[x][y] = Rgb{R: s.to8(r), G: s.to8(g), B: s.to8(b)}
+	}
+}
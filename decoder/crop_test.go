@@ -0,0 +1,97 @@
+package decoder
+
+import (
+	"bytes"
+	"image"
+	"image/draw"
+	"os"
+	"testing"
+)
+
+// Области, проверяемые при декодировании: выровненные и не выровненные по MCU, обрезаются по размеру изображения
+var testCrops = []image.Rectangle{
+	image.Rect(0, 0, 16, 16),
+	image.Rect(5, 3, 37, 21),
+	image.Rect(17, 9, 18, 10),
+	image.Rect(8, 40, 60, 75),
+}
+
+// Область rect изображения img с началом координат в нуле
+func cropImage(img image.Image, rect image.Rectangle) image.Image {
+	res := image.NewRGBA(image.Rect(0, 0, rect.Dx(), rect.Dy()))
+	draw.Draw(res, res.Bounds(), img, rect.Min, draw.Src)
+	return res
+}
+
+func TestDecodeCrop(t *testing.T) {
+	names := []string{"pics/Gray/GrayBaseline.jpg", "pics/Gray/GraySampled.jpg", testPics[1], testPics[2], "pics/ColorSpace/YCCK.jpg"}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for scale := ScaleFull; scale <= ScaleHalf; scale++ {
+			full, err := DecodeWithOptions(bytes.NewReader(data), &Options{Scale: scale})
+			if err != nil {
+				t.Fatal(name, "DecodeWithOptions -> error", err.Error())
+			}
+			b := full.Bounds()
+			crops := []image.Rectangle{b, image.Rect(b.Dx()-7, b.Dy()-5, b.Dx(), b.Dy())}
+			for _, crop := range testCrops {
+				if crop = crop.Intersect(b); !crop.Empty() {
+					crops = append(crops, crop)
+				}
+			}
+			for _, crop := range crops {
+				for _, workers := range []int{1, 2} {
+					img, err := DecodeWithOptions(bytes.NewReader(data), &Options{Scale: scale, Crop: crop, Workers: workers})
+					if err != nil {
+						t.Fatal(name, crop, "DecodeWithOptions -> error", err.Error())
+					}
+					compareImages(t, name+" "+crop.String(), img, cropImage(full, crop), 0, 0)
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeCropErrors(t *testing.T) {
+	data, err := os.ReadFile("pics/Gray/GrayBaseline.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	//Исходный размер 77x101, при уменьшении в 2 раза - 39x51
+	crops := []image.Rectangle{image.Rect(0, 0, 102, 10), image.Rect(-1, 0, 10, 10), image.Rect(40, 30, 60, 40)}
+	for _, crop := range crops {
+		if _, err := DecodeWithOptions(bytes.NewReader(data), &Options{Scale: ScaleHalf, Crop: crop}); err == nil {
+			t.Fatal("DecodeWithOptions with crop", crop, "-> expect error")
+		}
+	}
+
+	//Буфер должен иметь размер области
+	jpeg, err := ReadJPEG(toBufio(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal("ReadJPEG -> error", err.Error())
+	}
+	jpeg.Options.Crop = image.Rect(10, 10, 20, 30)
+	if _, err := jpeg.ReadGrayJPEG(CreateGrayMatrix(jpeg.ImageHeight, jpeg.ImageWidth), 0); err == nil {
+		t.Fatal("ReadGrayJPEG with full size buffer -> expect error")
+	}
+}
+
+func BenchmarkDecodeCrop(b *testing.B) {
+	data, err := os.ReadFile(testPics[0])
+	if err != nil {
+		b.Fatal(err)
+	}
+	crops := map[string]image.Rectangle{"Full": {}, "64x64": image.Rect(100, 100, 164, 164)}
+	for name, crop := range crops {
+		b.Run(name, func(b *testing.B) {
+			for range b.N {
+				if _, err := DecodeWithOptions(bytes.NewReader(data), &Options{Crop: crop}); err != nil {
+					b.Fatal("DecodeWithOptions -> error", err.Error())
+				}
+			}
+		})
+	}
+}
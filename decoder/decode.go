@@ -2,51 +2,51 @@ package decoder
 
 import (
 	"errors"
+	"image"
 	"jpeg/decoder/huffman"
-	"math"
 )
 
-const rgbDelta = 128 //Константа, которая прибавляется при переводе в RGB
-
-type Image = [][]Rgb
-type yCbCrMatrix = [][]yCbCr
-
-// Структура для хранения данных в YCbCr формате
-type yCbCr struct {
-	y  float32
-	cb float32
-	cr float32
+// Создание пустого изображения RGB
+func CreateRGBMatrix(height uint16, width uint16) Image {
+	res := make([][]Rgb, height)
+	for i := range height {
+		res[i] = make([]Rgb, width)
+	}
+	return res
 }
 
-// Перевод в RGB пространство по указателю
-func (cur *yCbCr) toRGB(res *Rgb) {
-	cur.y += rgbDelta
-	cur.cb += rgbDelta
-	cur.cr += rgbDelta
-	res.R = Clamp255(int(math.Round(float64(cur.y) + 1.402*float64((float64(cur.cr)-rgbDelta)))))
-	res.G = Clamp255(int(math.Round(float64(cur.y) - 0.34414*float64((float64(cur.cb)-rgbDelta)) - 0.71414*float64((float64(cur.cr)-rgbDelta)))))
-	res.B = Clamp255(int(math.Round(float64(cur.y) + 1.772*float64((float64(cur.cb)-rgbDelta)))))
+// Создание пустого изображения в оттенках серого
+func CreateGrayMatrix(height uint16, width uint16) GrayImage {
+	res := make([][]byte, height)
+	for i := range height {
+		res[i] = make([]byte, width)
+	}
+	return res
 }
 
-// Структура для хранения данных в RGB формате
-type Rgb struct {
-	R byte
-	G byte
-	B byte
+// Создание пустого изображения CMYK
+func CreateCMYKMatrix(height uint16, width uint16) CMYKImage {
+	res := make([][]Cmyk, height)
+	for i := range height {
+		res[i] = make([]Cmyk, width)
+	}
+	return res
 }
 
-var bandSkips uint16 //Счетчик пропусков вычислений в progressive
-var prev []int16     //Предыдущие значения DC для дельта кодирования
-
-// Переменные для AC refinement
-var positiveBit int16
-var negativeBit int16
+// Создание пустого изображения RGB с 16 битами на отсчет
+func CreateRGB16Matrix(height uint16, width uint16) Image16 {
+	res := make([][]Rgb16, height)
+	for i := range height {
+		res[i] = make([]Rgb16, width)
+	}
+	return res
+}
 
-// Создание пустого изображения RGB
-func CreateRGBMatrix(height uint16, width uint16) Image {
-	res := make([][]Rgb, height)
+// Создание пустого изображения в оттенках серого с 16 битами на отсчет
+func CreateGray16Matrix(height uint16, width uint16) Gray16Image {
+	res := make([][]uint16, height)
 	for i := range height {
-		res[i] = make([]Rgb, width)
+		res[i] = make([]uint16, width)
 	}
 	return res
 }
@@ -60,46 +60,93 @@ func createYCbCrMatrix(height byte, width byte) yCbCrMatrix {
 	return res
 }
 
-// Создание пустого блока размерами [height][width] из MCU(8х8) в YCbCr
-func createYCbCrBlock(height byte, width byte) [][]yCbCrMatrix {
+// Создание пустого блока размерами [height][width] из MCU(size x size) в YCbCr
+func createYCbCrBlock(height byte, width byte, size byte) [][]yCbCrMatrix {
 	res := make([][]yCbCrMatrix, height)
 	for i := range height {
 		res[i] = make([]yCbCrMatrix, width)
 		for j := range width {
-			res[i][j] = createYCbCrMatrix(unitRowCount, unitColCount)
+			res[i][j] = createYCbCrMatrix(size, size)
 		}
 	}
 	return res
 }
 
+// Количество блоков 8x8 компоненты с фактором factor по стороне size
+func compBlocks(size uint16, factor byte, maxFactor byte, unitSize int) uint16 {
+	compSize := (int(size)*int(factor) + int(maxFactor) - 1) / int(maxFactor)
+	return uint16((compSize + unitSize - 1) / unitSize)
+}
+
+// Округление count вверх до кратного factor
+func roundUp(count uint16, factor byte) uint16 {
+	return (count + uint16(factor) - 1) / uint16(factor) * uint16(factor)
+}
+
 // Вычисление тех переменных, которые нужны при сканах, но вычисляются единожды
 func (jpeg *JPEG) constInit() {
-	jpeg.numOfMCUHeight = (jpeg.ImageHeight + (unitRowCount - 1)) / (unitRowCount)
-	jpeg.numOfMCUHeight += jpeg.numOfMCUHeight % uint16(jpeg.maxV)
-
-	jpeg.numOfMCUWidth = (jpeg.ImageWidth + (unitColCount - 1)) / (unitColCount)
-	jpeg.numOfMCUWidth += jpeg.numOfMCUWidth % uint16(jpeg.maxH)
+	jpeg.numOfMCUHeight = roundUp((jpeg.ImageHeight+(unitRowCount-1))/unitRowCount, jpeg.maxV)
+	jpeg.numOfMCUWidth = roundUp((jpeg.ImageWidth+(unitColCount-1))/unitColCount, jpeg.maxH)
 
 	jpeg.numBlocksHeight = jpeg.numOfMCUHeight / uint16(jpeg.maxV)
 	jpeg.numBlocksWidth = jpeg.numOfMCUWidth / uint16(jpeg.maxH)
 
-	jpeg.blocks = CreateMCUMatrix(jpeg.numOfMCUHeight, jpeg.numOfMCUWidth)
+	for i := range jpeg.numOfComps {
+		comp := &jpeg.comps[i]
+		comp.blocksHeight = compBlocks(jpeg.ImageHeight, comp.v, jpeg.maxV, unitRowCount)
+		comp.blocksWidth = compBlocks(jpeg.ImageWidth, comp.h, jpeg.maxH, unitColCount)
+	}
+
+	jpeg.blocks = createMCUMatrix(jpeg.numOfMCUHeight, jpeg.numOfMCUWidth, jpeg.numOfComps)
+}
+
+// Положение блока (row, col) компоненты comp в матрице MCU
+func (jpeg *JPEG) blockPos(comp *component, row int, col int) (int, int) {
+	mcuRow := row/int(comp.v)*int(jpeg.maxV) + row%int(comp.v)
+	mcuCol := col/int(comp.h)*int(jpeg.maxH) + col%int(comp.h)
+	return mcuRow, mcuCol
 }
 
 // Инициализация дельта-декодирования, перезапуск bands, инициализация побитового чтения
 func (jpeg *JPEG) decodeInit() {
-	prev = make([]int16, jpeg.numOfComps)
-	bandSkips = 0
-	positiveBit = int16(1 << jpeg.saLow)
+	jpeg.prev = [maxComps]int16{}
+	jpeg.bandSkips = 0
+	jpeg.positiveBit = int16(1 << jpeg.saLow)
 	temp := -1
-	negativeBit = int16(uint(temp) << uint(jpeg.saLow))
-	jpeg.reader.HuffStreamStart()
+	jpeg.negativeBit = int16(uint(temp) << uint(jpeg.saLow))
+	if jpeg.IsArithmetic {
+		jpeg.arithRestart()
+	} else {
+		jpeg.reader.HuffStreamStart()
+	}
 }
 
 // Сброс дельта-кодирования
 func (jpeg *JPEG) restart() {
-	prev = make([]int16, jpeg.numOfComps)
-	bandSkips = 0
+	jpeg.prev = [maxComps]int16{}
+	jpeg.bandSkips = 0
+	if jpeg.IsArithmetic {
+		jpeg.arithRestart()
+	}
+}
+
+// Сброс арифметического декодера и состояний таблиц компонент текущего скана
+func (jpeg *JPEG) arithRestart() {
+	jpeg.arith.Reset()
+	for i := range jpeg.numOfComps {
+		comp := &jpeg.comps[i]
+		if !comp.used {
+			continue
+		}
+		//Уточнение DC использует только фиксированное состояние
+		if jpeg.startSpectral == 0 && jpeg.saHigh == 0 {
+			jpeg.arith.ResetDC(comp.dcTableID)
+			jpeg.dcContext[i] = 0
+		}
+		if jpeg.endSpectral != 0 {
+			jpeg.arith.ResetAC(comp.acTableID)
+		}
+	}
 }
 
 // Декодирование знака в потоке Хаффмана
@@ -111,27 +158,43 @@ func decodeSign(num int16, len byte) int16 {
 	}
 }
 
-// Декодирование DC элемента
-func (jpeg *JPEG) decodeDC(id int, huff *huffman.HuffTable) int16 {
-	temp, err := huff.DecodeHuff(jpeg.reader)
-
+// Декодирование разности DC арифметическим декодером
+func (jpeg *JPEG) decodeArithDC(id int) int16 {
+	diff, err := jpeg.arith.DecodeDC(jpeg.reader, jpeg.comps[id].dcTableID, &jpeg.dcContext[id])
 	if err != nil {
 		jpeg.readError = err
 	}
+	return diff
+}
+
+// Декодирование DC элемента, для арифметического кодирования huff не используется
+func (jpeg *JPEG) decodeDC(id int, huff *huffman.HuffTable) int16 {
+	var diff int16
+	if jpeg.IsArithmetic {
+		diff = jpeg.decodeArithDC(id)
+	} else {
+		temp, err := huff.DecodeHuff(jpeg.reader)
 
-	diff := decodeSign(int16(jpeg.reader.GetBits(byte(temp))), byte(temp))
-	res := diff + prev[id]
-	prev[id] = res
+		if err != nil {
+			jpeg.readError = err
+			return jpeg.prev[id]
+		}
+		//Разность DC занимает не больше SamplePrecision+3 бит
+		if temp > uint16(jpeg.SamplePrecision)+3 {
+			jpeg.readError = errors.New("Huffman bit-reading error: DC difference is too long")
+			return jpeg.prev[id]
+		}
+
+		diff = decodeSign(int16(jpeg.reader.GetBits(byte(temp))), byte(temp))
+	}
+	res := diff + jpeg.prev[id]
+	jpeg.prev[id] = res
 	return res
 }
 
 // Декодирование AC элемента
-func (jpeg *JPEG) decodeAC(unit []int16, huff *huffman.HuffTable) {
-	if bandSkips > 0 {
-		bandSkips--
-		return
-	}
-
+// Для арифметического кодирования используется таблица с номером acTableID, huff не используется
+func (jpeg *JPEG) decodeAC(unit []int16, huff *huffman.HuffTable, acTableID byte) {
 	unitLen := jpeg.endSpectral
 
 	var k byte
@@ -141,6 +204,18 @@ func (jpeg *JPEG) decodeAC(unit []int16, huff *huffman.HuffTable) {
 		k = 1
 	}
 
+	if jpeg.IsArithmetic {
+		if err := jpeg.arith.DecodeAC(jpeg.reader, acTableID, unit, k, unitLen, jpeg.saLow); err != nil {
+			jpeg.readError = err
+		}
+		return
+	}
+
+	if jpeg.bandSkips > 0 {
+		jpeg.bandSkips--
+		return
+	}
+
 	for ; k <= unitLen; k++ {
 		rs, err := huff.DecodeHuff(jpeg.reader)
 
@@ -158,8 +233,8 @@ func (jpeg *JPEG) decodeAC(unit []int16, huff *huffman.HuffTable) {
 
 		if small == 0 {
 			if big != 15 {
-				bandSkips = jpeg.reader.DecodeEndOfBand(big)
-				bandSkips--
+				jpeg.bandSkips = jpeg.reader.DecodeEndOfBand(big)
+				jpeg.bandSkips--
 				break
 			} else {
 				k += 15
@@ -190,21 +265,27 @@ func Clamp255(val int) byte {
 	return byte(val)
 }
 
-// Декодирование data unit
-func (jpeg *JPEG) decodeDataUnit(channel int) []int16 {
-	temp := make([]int16, unitRowCount*unitColCount)
-	temp[0] = jpeg.decodeDC(channel, jpeg.dcTables[jpeg.comps[channel].dcTableID])
-	jpeg.decodeAC(temp, jpeg.acTables[jpeg.comps[channel].acTableID])
-	return temp
+// Декодирование data unit канала channel в unit
+func (jpeg *JPEG) decodeDataUnit(channel int, unit []int16) {
+	clear(unit)
+	comp := &jpeg.comps[channel]
+	unit[0] = jpeg.decodeDC(channel, jpeg.dcTables[comp.dcTableID])
+	jpeg.decodeAC(unit, jpeg.acTables[comp.acTableID], comp.acTableID)
 }
 
 // Выполнение рестарта дельта кодирвоания
 func (jpeg *JPEG) makeRestart() bool {
+	//Арифметический декодер мог не дочитать интервал до маркера
+	if jpeg.IsArithmetic {
+		jpeg.reader.SkipToMarker()
+	}
 	marker := jpeg.reader.GetWord()
 	if marker == EOI {
 		return true
 	} else if marker >= RST0 && marker <= RST7 {
-		jpeg.reader.BitsAlign()
+		if !jpeg.IsArithmetic {
+			jpeg.reader.BitsAlign()
+		}
 		jpeg.restart()
 		return true
 	}
@@ -222,14 +303,7 @@ func (jpeg *JPEG) decodeBaselineBlock(mcus [][]MCU, x uint16, y uint16) bool {
 
 		for curV := range uint16(comp.v) {
 			for curH := range uint16(comp.h) {
-				switch i {
-				case int(Y):
-					mcus[x+curV][y+curH].Y = jpeg.decodeDataUnit(i)
-				case int(Cb):
-					mcus[x+curV][y+curH].Cb = jpeg.decodeDataUnit(i)
-				case int(Cr):
-					mcus[x+curV][y+curH].Cr = jpeg.decodeDataUnit(i)
-				}
+				jpeg.decodeDataUnit(i, mcus[x+curV][y+curH].channel(Channel(i)))
 
 				if jpeg.readError != nil {
 					return false
@@ -273,6 +347,7 @@ func (jpeg *JPEG) decodeBaselineScan(mcus [][]MCU, increment uint16) (uint16, ui
 				return 0, 0, false
 			}
 		}
+		jpeg.rowReady(int(row))
 	}
 	res := row * unitColCount * uint16(jpeg.maxV)
 	if res >= jpeg.ImageHeight {
@@ -294,11 +369,11 @@ func (jpeg *JPEG) RefinementZeroSkip(data []int16, zeros byte, startIndex byte,
 			}
 		} else if data[k] > 0 {
 			if jpeg.reader.GetBit() == 1 {
-				data[k] |= positiveBit
+				data[k] |= jpeg.positiveBit
 			}
 		} else {
 			if jpeg.reader.GetBit() == 1 {
-				data[k] += negativeBit
+				data[k] += jpeg.negativeBit
 			}
 		}
 	}
@@ -316,76 +391,74 @@ func (jpeg *JPEG) decodeProgressiveDC(mcus [][]MCU, x uint16, y uint16) {
 
 		for curV := range uint16(comp.v) {
 			for curH := range uint16(comp.h) {
-				if jpeg.saHigh == 0 { // Первое чтение DC
-					switch i {
-					case int(Y):
-						mcus[x+curV][y+curH].Y[0] = jpeg.decodeDC(i, jpeg.dcTables[comp.dcTableID]) << int16(jpeg.saLow)
-					case int(Cb):
-						mcus[x+curV][y+curH].Cb[0] = jpeg.decodeDC(i, jpeg.dcTables[comp.dcTableID]) << int16(jpeg.saLow)
-					case int(Cr):
-						mcus[x+curV][y+curH].Cr[0] = jpeg.decodeDC(i, jpeg.dcTables[comp.dcTableID]) << int16(jpeg.saLow)
-					}
-				} else { // Повторное чтение DC
-					bit := jpeg.reader.GetBit()
-					switch i {
-					case int(Y):
-						mcus[x+curV][y+curH].Y[0] |= int16(bit << jpeg.saLow)
-					case int(Cb):
-						mcus[x+curV][y+curH].Cb[0] |= int16(bit << jpeg.saLow)
-					case int(Cr):
-						mcus[x+curV][y+curH].Cr[0] |= int16(bit << jpeg.saLow)
-					}
-				}
+				jpeg.decodeProgressiveDCUnit(i, mcus[x+curV][y+curH].channel(Channel(i)))
 			}
 		}
 	}
 }
 
-// Декодирование сканов AC
-func (jpeg *JPEG) decodeProgressiveAC(mcus [][]MCU) {
-	for i, comp := range jpeg.comps {
-		if !comp.used {
-			continue
+// Декодирование DC блока unit компоненты i в progressive
+func (jpeg *JPEG) decodeProgressiveDCUnit(i int, unit []int16) {
+	if jpeg.saHigh == 0 { // Первое чтение DC
+		unit[0] = jpeg.decodeDC(i, jpeg.dcTables[jpeg.comps[i].dcTableID]) << int16(jpeg.saLow)
+	} else { // Повторное чтение DC
+		var bit byte
+		if jpeg.IsArithmetic {
+			bit = jpeg.arith.DecodeFixed(jpeg.reader)
+		} else {
+			bit = jpeg.reader.GetBit()
 		}
+		unit[0] |= int16(bit << jpeg.saLow)
+	}
+}
 
-		rowCount := int(jpeg.numOfMCUHeight)
-		colCount := int(jpeg.numOfMCUWidth)
-
-		if jpeg.ImageHeight%unitRowCount == 0 {
-			rowCount = int(jpeg.ImageHeight / unitRowCount)
+// Количество компонент в текущем скане
+func (jpeg *JPEG) scanComps() int {
+	res := 0
+	for i := range jpeg.numOfComps {
+		if jpeg.comps[i].used {
+			res++
 		}
+	}
+	return res
+}
 
-		if jpeg.ImageWidth%unitColCount == 0 {
-			colCount = int(jpeg.ImageWidth / unitColCount)
+// Декодирование неинтерливных сканов: AC или DC одной компоненты
+func (jpeg *JPEG) decodeNonInterleavedScan(mcus [][]MCU) {
+	for i, comp := range jpeg.comps {
+		if !comp.used {
+			continue
 		}
 
-		rowStep := jpeg.maxV / comp.v
-		colStep := jpeg.maxH / comp.h
-		for row := 0; row < rowCount; row += int(rowStep) {
-			for col := 0; col < colCount; col += int(colStep) {
-				if jpeg.saHigh == 0 { // Первое чтение AC
-					switch i {
-					case int(Y):
-						jpeg.decodeAC(mcus[row][col].Y, jpeg.acTables[comp.acTableID])
-					case int(Cb):
-						jpeg.decodeAC(mcus[row][col].Cb, jpeg.acTables[comp.acTableID])
-					case int(Cr):
-						jpeg.decodeAC(mcus[row][col].Cr, jpeg.acTables[comp.acTableID])
+		//Неинтерливный скан: MCU состоит из одного блока компоненты
+		var blockCount uint
+		for blockRow := range int(comp.blocksHeight) {
+			for blockCol := range int(comp.blocksWidth) {
+				if jpeg.readError != nil {
+					return
+				}
+				//Перезапуск перед очередным интервалом, после последнего блока маркера нет
+				if blockCount != 0 && jpeg.restartInterval != 0 && blockCount%uint(jpeg.restartInterval) == 0 && !jpeg.makeRestart() {
+					return
+				}
+				blockCount++
+
+				row, col := jpeg.blockPos(&comp, blockRow, blockCol)
+				arr := mcus[row][col].channel(Channel(i)) // Указатель на текущий массив цвета
+				if jpeg.startSpectral == 0 {
+					jpeg.decodeProgressiveDCUnit(i, arr)
+				} else if jpeg.saHigh == 0 { // Первое чтение AC
+					jpeg.decodeAC(arr, jpeg.acTables[comp.acTableID], comp.acTableID)
+				} else if jpeg.IsArithmetic {
+					err := jpeg.arith.DecodeACRefine(jpeg.reader, comp.acTableID, arr, jpeg.startSpectral, jpeg.endSpectral, jpeg.saLow)
+					if err != nil {
+						jpeg.readError = err
 					}
 				} else { // Повторное чтение AC
-					var arr []int16 // Указатель на текущий массив цвета
-					switch i {
-					case int(Y):
-						arr = mcus[row][col].Y
-					case int(Cb):
-						arr = mcus[row][col].Cb
-					case int(Cr):
-						arr = mcus[row][col].Cr
-					}
 
-					if bandSkips > 0 {
+					if jpeg.bandSkips > 0 {
 						jpeg.RefinementZeroSkip(arr, unitRowCount*unitColCount, jpeg.startSpectral, jpeg.endSpectral)
-						bandSkips--
+						jpeg.bandSkips--
 						continue
 					}
 
@@ -405,17 +478,17 @@ func (jpeg *JPEG) decodeProgressiveAC(mcus [][]MCU) {
 						switch low {
 						case 0:
 							if high != 15 {
-								bandSkips = jpeg.reader.DecodeEndOfBand(high)
+								jpeg.bandSkips = jpeg.reader.DecodeEndOfBand(high)
 								k = jpeg.RefinementZeroSkip(arr, unitRowCount*unitColCount, k, jpeg.endSpectral)
-								bandSkips--
+								jpeg.bandSkips--
 							} else {
 								k = jpeg.RefinementZeroSkip(arr, high, k, jpeg.endSpectral)
 							}
 						case 1:
 							if jpeg.reader.GetBit() == 1 {
-								coeff = positiveBit
+								coeff = jpeg.positiveBit
 							} else {
-								coeff = negativeBit
+								coeff = jpeg.negativeBit
 							}
 							k = jpeg.RefinementZeroSkip(arr, high, k, jpeg.endSpectral)
 							arr[k] = coeff
@@ -437,12 +510,13 @@ func (jpeg *JPEG) decodeProgressiveScan(mcus [][]MCU) bool {
 	var row uint16      //Счетчик строк блоков MCU
 	var col uint16      //Счетчик столбцов блоков MCU
 
-	if jpeg.startSpectral == 0 && jpeg.endSpectral == 0 { // Только для DC сканов
+	if jpeg.startSpectral == 0 && jpeg.scanComps() > 1 { // Только для интерливных DC сканов
+		numOfBlocks := uint(jpeg.numBlocksHeight) * uint(jpeg.numBlocksWidth)
 		for row = range jpeg.numBlocksHeight {
 			for col = range jpeg.numBlocksWidth {
 				jpeg.decodeProgressiveDC(mcus, row*uint16(jpeg.maxV), col*uint16(jpeg.maxH))
 				blockCount++
-				if jpeg.restartInterval != 0 && blockCount%uint(jpeg.restartInterval) == 0 && !jpeg.makeRestart() {
+				if jpeg.restartInterval != 0 && blockCount%uint(jpeg.restartInterval) == 0 && blockCount != numOfBlocks && !jpeg.makeRestart() {
 					jpeg.readError = errors.New("Huffman bit-reading error: make restart error")
 					return false
 
@@ -450,66 +524,115 @@ func (jpeg *JPEG) decodeProgressiveScan(mcus [][]MCU) bool {
 			}
 		}
 	} else {
-		jpeg.decodeProgressiveAC(mcus)
+		jpeg.decodeNonInterleavedScan(mcus)
 	}
 
 	return jpeg.readError == nil
 }
 
 // Вычисление YCbCr для канала ch
-// x y - координаты левого верхнего MCU в блоке
-func (jpeg *JPEG) componentCalc(blocks [][]MCU, x uint, y uint, res [][]yCbCrMatrix, ch Channel, readAll bool) {
-	// Перевод в YCbCr
-	for curV := range uint16(jpeg.comps[ch].v) {
-		for curH := range uint16(jpeg.comps[ch].h) {
-			var curMCU MCU
-			if !readAll && jpeg.IsProgressive {
-				curMCU = MakeMCU()
-				blocks[x+uint(curV)][y+uint(curH)].Copy(&curMCU)
-			} else {
-				curMCU = blocks[x+uint(curV)][y+uint(curH)]
+// x y - координаты левого верхнего MCU в блоке, plane - отсчеты для интерполяции или nil для повторения отсчетов
+func (jpeg *JPEG) componentCalc(blocks [][]MCU, x uint, y uint, res [][]yCbCrMatrix, ch Channel, plane *samplePlane) {
+	size := jpeg.Options.Scale.unitSize() //Сторона блока MCU в результате
+	if plane != nil {
+		for row := range int(jpeg.maxV) * size {
+			for col := range int(jpeg.maxH) * size {
+				res[row/size][col/size][row%size][col%size].set(ch, plane.value(int(x)*size+row, int(y)*size+col))
 			}
-			scalingX := jpeg.maxV / jpeg.comps[ch].v
-			scalingY := jpeg.maxH / jpeg.comps[ch].h
+		}
+		return
+	}
+
+	comp := &jpeg.comps[ch]
+	compSize, scalingX, scalingY := jpeg.compScaling(comp) //Сторона блока компоненты после ОДКП и увеличение
+
+	// Перевод в YCbCr
+	for curV := range int(comp.v) {
+		for curH := range int(comp.h) {
+			curMCU := &blocks[x+uint(curV)][y+uint(curH)]
 
-			curMCU.Dequant(jpeg.quantTables[jpeg.comps[ch].quantTableID], ch)
-			unit := curMCU.InverseCosin(ch)
+			var unit idctBlock
+			jpeg.unitIDCT(curMCU.channel(ch), comp, compSize, &unit)
 
 			//chroma subsample
-			var vPadding uint16 //Отступ в текущем MCU по x
-			var hPadding uint16 //Отступ в текущем MCU по y
-			for x := range unitRowCount * scalingX {
-				vPadding = uint16(x / unitRowCount)
-
-				for y := range unitColCount * scalingY {
-					hPadding = uint16(y / unitColCount)
-
-					switch ch {
-					case Y:
-						res[curV+vPadding][curH+hPadding][x%unitRowCount][y%unitColCount].y = unit[x/scalingX][y/scalingY]
-					case Cb:
-						res[curV+vPadding][curH+hPadding][x%unitRowCount][y%unitColCount].cb = unit[x/scalingX][y/scalingY]
-					case Cr:
-						res[curV+vPadding][curH+hPadding][x%unitRowCount][y%unitColCount].cr = unit[x/scalingX][y/scalingY]
-					}
+			for x := range compSize * scalingX {
+				row := curV*compSize*scalingX + x //Строка в MCU
+				for y := range compSize * scalingY {
+					col := curH*compSize*scalingY + y //Столбец в MCU
+					res[row/size][col/size][row%size][col%size].set(ch, unit[x/scalingX][y/scalingY])
 				}
 			}
 		}
 	}
 }
 
-// Копирование в результат информации из блока YCbCrMatrix
-// x y - координаты левого верхнего угла блока в результате
-func (jpeg *JPEG) copyToRes(curMatrix yCbCrMatrix, res [][]Rgb, x int, y int) {
-	for i := 0; i < len(curMatrix) && x+i < int(jpeg.ImageHeight); i++ {
-		for j := 0; j < len(curMatrix[0]) && y+j < int(jpeg.ImageWidth); j++ {
-			curMatrix[i][j].toRGB(&res[x+i][y+j])
+// ОДКП блока unit компоненты comp со стороной результата compSize
+func (jpeg *JPEG) unitIDCT(unit []int16, comp *component, compSize int, res *idctBlock) {
+	if compSize == unitRowCount {
+		inverseDCT(unit, jpeg.quantTables[comp.quantTableID], jpeg.Options.DCTMethod, res)
+	} else {
+		scaledInverseDCT(unit, jpeg.quantTables[comp.quantTableID], compSize, res)
+	}
+}
+
+// Копирование в результат информации из блока YCbCrMatrix, попадающей в область результата rect
+// x y - координаты левого верхнего угла блока в уменьшенном изображении
+func (jpeg *JPEG) copyToRes(curMatrix yCbCrMatrix, x int, y int, rect image.Rectangle) {
+	for i := max(0, rect.Min.Y-x); i < len(curMatrix) && x+i < rect.Max.Y; i++ {
+		for j := max(0, rect.Min.X-y); j < len(curMatrix[0]) && y+j < rect.Max.X; j++ {
+			jpeg.storePixel(&curMatrix[i][j], x+i-rect.Min.Y, y+j-rect.Min.X)
 		}
 	}
 }
 
-// Вычисления над прочитанными данными, readAll - флаг чтения всего изображения сразу для отпимизации
-func (jpeg *JPEG) rgbCalc(blocks [][]MCU, readAll bool, startRow int, endRow int) {
+// Вычисление пикселей строки MCU row, для интерполяции доступны первые decoded строк MCU
+// Деквантуются и преобразуются только MCU, пересекающиеся с областью результата
+func (jpeg *JPEG) rgbCalcRow(blocks [][]MCU, row int, decoded int) {
+	if jpeg.ycbcr != nil {
+		jpeg.planarCalcRow(blocks, row)
+		return
+	}
+
+	size := jpeg.Options.Scale.unitSize()
+	rect := jpeg.outputRect()
+	mcuHeight, mcuWidth := int(jpeg.maxV)*size, int(jpeg.maxH)*size
+	if row*mcuHeight >= rect.Max.Y || (row+1)*mcuHeight <= rect.Min.Y {
+		return
+	}
+
+	//Для результата в оттенках серого нужна только яркость
+	comps := jpeg.numOfComps
+	if (jpeg.gray != nil || jpeg.gray16 != nil) && jpeg.lumaOnly() {
+		comps = 1
+	}
+
+	//Отсчеты интерполируемых компонент вычисляются сразу для всей строки
+	firstCol, lastCol := rect.Min.X/mcuWidth, (rect.Max.X+mcuWidth-1)/mcuWidth
+	var planes [maxComps]*samplePlane
+	for c := range comps {
+		planes[c] = jpeg.samplePlane(blocks, Channel(c), row, firstCol, lastCol, decoded)
+	}
+
+	for col := firstCol; col < lastCol; col++ {
+		mcuRow := row * int(jpeg.maxV) // Номер текущего MCU
+		mcuCol := col * int(jpeg.maxH) // Номер текущего MCU
+
+		curBlock := createYCbCrBlock(jpeg.maxV, jpeg.maxH, byte(size))
+		for c := range comps {
+			jpeg.componentCalc(blocks, uint(mcuRow), uint(mcuCol), curBlock, Channel(c), planes[c])
+		}
+
+		for i := range int(jpeg.maxV) {
+			for j := range int(jpeg.maxH) {
+				jpeg.copyToRes(curBlock[i][j], (mcuRow+i)*size, (mcuCol+j)*size, rect)
+			}
+		}
+	}
+}
+
+// Вычисления над прочитанными данными
+// Строки MCU независимы и вычисляются параллельно
+func (jpeg *JPEG) rgbCalc(blocks [][]MCU, startRow int, endRow int) {
 	var rowMax int
 	var row int
 	if jpeg.IsProgressive {
@@ -518,24 +641,13 @@ func (jpeg *JPEG) rgbCalc(blocks [][]MCU, readAll bool, startRow int, endRow int
 	} else {
 		rowMax = endRow
 		row = int(startRow / unitRowCount / int(jpeg.maxV))
-	}
-
-	for ; row < rowMax; row++ {
-		for col := range int(jpeg.numBlocksWidth) {
-			mcuRow := row * int(jpeg.maxV) // Номер текущего MCU
-			mcuCol := col * int(jpeg.maxH) // Номер текущего MCU
-
-			curBlock := createYCbCrBlock(jpeg.maxV, jpeg.maxH)
-
-			for c := range jpeg.numOfComps {
-				jpeg.componentCalc(blocks, uint(mcuRow), uint(mcuCol), curBlock, Channel(c), readAll)
-			}
-
-			for i := range int(jpeg.maxV) {
-				for j := range int(jpeg.maxH) {
-					jpeg.copyToRes(curBlock[i][j], jpeg.img, mcuRow*unitRowCount+i*unitRowCount, mcuCol*unitColCount+j*unitColCount)
-				}
-			}
+		//Последняя строка прошлого чтения вычислялась без следующей строки
+		if row > 0 && jpeg.contextRows() {
+			row--
 		}
 	}
+
+	parallelFor(rowMax-row, jpeg.Options.workers(), func(i int) {
+		jpeg.rgbCalcRow(blocks, row+i, rowMax)
+	})
 }
@@ -0,0 +1,62 @@
+package decoder
+
+import (
+	"bytes"
+	"os"
+	"testing"
+	"time"
+)
+
+// Замена всех символов таблиц Хаффмана DC в сегментах DHT на symbol
+func withDCSymbols(t *testing.T, data []byte, symbol byte) []byte {
+	t.Helper()
+	res := append([]byte{}, data...)
+	patched := 0
+	for pos := 2; pos+4 <= len(res) && res[pos] == 0xFF && uint16(res[pos])<<8|uint16(res[pos+1]) != SOS; {
+		end := pos + 2 + (int(res[pos+2])<<8 | int(res[pos+3]))
+		if uint16(res[pos])<<8|uint16(res[pos+1]) == DHT {
+			for table := pos + 4; table+17 <= end; {
+				count := 0
+				for _, num := range res[table+1 : table+17] {
+					count += int(num)
+				}
+				if res[table]>>4 == 0 {
+					for i := table + 17; i < table+17+count; i++ {
+						res[i] = symbol
+					}
+					patched++
+				}
+				table += 17 + count
+			}
+		}
+		pos = end
+	}
+	if patched == 0 {
+		t.Fatal("DC Huffman table not found")
+	}
+	return res
+}
+
+func TestDecodeCorruptDC(t *testing.T) {
+	for _, name := range []string{"pics/Gray/GrayBaseline.jpg", "pics/Gray/GrayProgressive.jpg"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		//Размер разности 69 бит не должен приводить к зацикливанию чтения
+		broken := withDCSymbols(t, data, 0x45)
+		done := make(chan error, 1)
+		go func() {
+			_, err := DecodeWithOptions(bytes.NewReader(broken), &Options{Workers: 1})
+			done <- err
+		}()
+		select {
+		case err := <-done:
+			if err == nil {
+				t.Fatal(name, "DecodeWithOptions with DC size 69 -> expect error")
+			}
+		case <-time.After(10 * time.Second):
+			t.Fatal(name, "DecodeWithOptions with DC size 69 -> hang")
+		}
+	}
+}
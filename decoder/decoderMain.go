@@ -4,23 +4,31 @@ import (
 	"bufio"
 	"errors"
 	"fmt"
+	"image"
+	"image/color"
+	"io"
+	"jpeg/decoder/arithmetic"
 	binreader "jpeg/decoder/binReader"
 	binwriter "jpeg/decoder/binWriter"
 	"jpeg/decoder/huffman"
 	"log"
 	"path/filepath"
+	"runtime"
 	"strconv"
 	"strings"
 )
 
 // Структура цветовой компоненты, данные для текущего скана
 type component struct {
+	id           byte //Идентификатор компоненты из заголовка фрейма
 	h            byte
 	v            byte
-	quantTableID byte //ID таблицы квантования для этого цвета
-	dcTableID    byte //DC таблица для этого цвета
-	acTableID    byte //AC таблица для этого цвета
-	used         bool //Флаг использования компоненты в текущем скане
+	quantTableID byte   //ID таблицы квантования для этого цвета
+	dcTableID    byte   //DC таблица для этого цвета
+	acTableID    byte   //AC таблица для этого цвета
+	used         bool   //Флаг использования компоненты в текущем скане
+	blocksHeight uint16 //Количество блоков компоненты по высоте (для неинтерливных сканов)
+	blocksWidth  uint16 //Количество блоков компоненты по ширине (для неинтерливных сканов)
 }
 
 // Маркеры всех используемых заголовков
@@ -28,9 +36,18 @@ const (
 	SOI   uint16 = 0xFFD8
 	EOI   uint16 = 0xFFD9
 	SOF0  uint16 = 0xFFC0
+	SOF1  uint16 = 0xFFC1
 	SOF2  uint16 = 0xFFC2
+	SOF3  uint16 = 0xFFC3
+	SOF9  uint16 = 0xFFC9
+	SOF10 uint16 = 0xFFCA
+	DAC   uint16 = 0xFFCC
 	APP0  uint16 = 0xFFE0
+	APP1  uint16 = 0xFFE1
+	APP2  uint16 = 0xFFE2
+	APP14 uint16 = 0xFFEE
 	APP15 uint16 = 0xFFEF
+	COM   uint16 = 0xFFFE
 	DQT   uint16 = 0xFFDB
 	DHT   uint16 = 0xFFC4
 	SOS   uint16 = 0xFFDA
@@ -40,23 +57,90 @@ const (
 )
 
 const numOfTables = 4   //Максимальное количество таблиц
-const numOfChannels = 3 //Максимальное количество цветовых компонент
-const maxComps = 3      //Максимальное количество компонент
+const numOfChannels = 4 //Максимальное количество цветовых компонент
+const maxComps = 4      //Максимальное количество компонент
 const colCount = 8      //Количество столбцов в таблице квантования (для вывода в лог)
 const sizeOfTable = 64  //Количество элементов в одной таблице квантования
+const adobeLen = 12     //Длина данных сегмента Adobe APP14
+
+// Значения флага transform из сегмента Adobe APP14
+const (
+	adobeTransformNone  byte = 0 //RGB или CMYK без преобразования
+	adobeTransformYCbCr byte = 1 //YCbCr
+	adobeTransformYCCK  byte = 2 //YCCK
+)
+
+// Цветовое пространство компонент в потоке
+type colorTransform byte
+
+const (
+	transformGray  colorTransform = iota //Одна яркостная компонента
+	transformYCbCr                       //YCbCr, переводится в RGB
+	transformRGB                         //RGB без преобразования
+	transformCMYK                        //CMYK без преобразования
+	transformYCCK                        //YCbCr + K, переводится в CMYK
+)
+
+// Параметры декодирования
+type Options struct {
+	DCTMethod      DCTMethod       //Метод обратного ДКП
+	Workers        int             //Количество горутин декодирования, 0 - по количеству процессоров, 1 - последовательно
+	Scale          Scale           //Масштаб результата, размеры буфера задает OutputSize
+	Crop           image.Rectangle //Декодируемая область в координатах уменьшенного изображения, пустая - все изображение
+	Upsampling     Upsampling      //Способ восстановления прореженных компонент
+	AutoOrient     bool            //Поворот результата Decode* по тегу Orientation из EXIF, Crop задается до поворота
+	KeepColorSpace bool            //Не переводить результат Decode* в sRGB по встроенному профилю ICC
+}
+
+// Проверка параметров декодирования
+func (o *Options) validate() error {
+	if o.DCTMethod > DCTIntFast {
+		return errors.New("Unknown DCT method")
+	}
+	if o.Workers < 0 {
+		return errors.New("Negative number of workers")
+	}
+	if o.Scale > ScaleEighth {
+		return errors.New("Unknown scale")
+	}
+	if o.Upsampling > UpsampleBilinear {
+		return errors.New("Unknown upsampling")
+	}
+	return nil
+}
+
+// Количество горутин декодирования
+func (o *Options) workers() int {
+	if o.Workers == 0 {
+		return runtime.GOMAXPROCS(0)
+	}
+	return o.Workers
+}
 
 type JPEG struct {
-	ImageHeight   uint16 //Высота изображения
-	ImageWidth    uint16 //Ширина изображения
-	IsProgressive bool   //Флаг для прогрессивного декодирования
-	CurStatus     uint16 //Текущее состояние чтения
+	ImageHeight     uint16      //Высота изображения
+	ImageWidth      uint16      //Ширина изображения
+	IsProgressive   bool        //Флаг для прогрессивного декодирования
+	CurStatus       uint16      //Текущее состояние чтения
+	IsLossless      bool        //Флаг lossless изображения (SOF3), читается через ReadLosslessJPEG
+	SamplePrecision byte        //Глубина цвета в битах на отсчет (8 или 12, для lossless 2-16)
+	IsArithmetic    bool        //Флаг арифметического кодирования (SOF9, SOF10)
+	Exif            *Exif       //Метаданные EXIF из первого сегмента APP1, nil - нет или не удалось разобрать
+	ICC             *ICCProfile //Профиль ICC из сегментов APP2 до заголовка фрейма, nil - нет или не удалось собрать
+	XMP             string      //Основной пакет XMP из сегмента APP1 до заголовка фрейма
+	ExtendedXMP     string      //Расширенный XMP, собранный из частей в сегментах APP1, пустой - нет или не удалось собрать
+	Comments        []string    //Текст сегментов COM в порядке чтения
+
+	Options Options //Параметры декодирования, задаются до чтения изображения
 
 	reader          *binreader.BinReader            //Объект для чтения файла
 	blocks          [][]MCU                         // Текущие матрицы с коэф из ДКП
-	quantTables     [numOfTables][]byte             //Массив с таблицами квантования
+	quantTables     [numOfTables][]uint16           //Массив с таблицами квантования
 	acTables        [numOfTables]*huffman.HuffTable //Массив с AC таблицами Хаффмана
 	dcTables        [numOfTables]*huffman.HuffTable //Массив с DC таблицами Хаффмана
-	samplePrecision byte                            //Глубина цвета
+	arith           *arithmetic.Decoder             //Арифметический декодер с условными состояниями таблиц
+	dcContext       [maxComps]byte                  //Категория предыдущей разности DC для арифметического декодера
+	samples         sampleRange                     //Диапазон отсчетов для глубины цвета
 	maxH            byte                            //Максимальный Н фактор
 	maxV            byte                            //Максимальный V фактор
 	numOfComps      byte                            //Количество цветовых компонет в изображении
@@ -71,9 +155,24 @@ type JPEG struct {
 	numBlocksHeight uint16                          //Количество блоков subsample по высоте
 	numBlocksWidth  uint16                          //Количество блоков subsample по ширине
 	blockCount      uint                            //Общее количество прочитанных блоков mcu
+	prev            [maxComps]int16                 //Предыдущие значения DC для дельта кодирования
+	bandSkips       uint16                          //Счетчик пропусков вычислений в progressive
+	positiveBit     int16                           //Прибавляемый бит для AC refinement
+	negativeBit     int16                           //Вычитаемый бит для AC refinement
 	wasEOI          bool                            //Флаг завершения чтения
 	readError       error                           //Ошибка при декодировании
 	img             Image                           //Результирующее изображение
+	gray            GrayImage                       //Результирующее изображение в оттенках серого
+	cmyk            CMYKImage                       //Результирующее изображение в CMYK
+	img16           Image16                         //Результирующее изображение с 16 битами на отсчет
+	gray16          Gray16Image                     //Результирующее изображение в оттенках серого с 16 битами на отсчет
+	ycbcr           *image.YCbCr                    //Результирующие плоскости YCbCr без перевода в RGB
+	adobe           bool                            //Флаг наличия сегмента Adobe APP14
+	adobeTransform  byte                            //Флаг transform из сегмента Adobe APP14
+	transform       colorTransform                  //Цветовое пространство компонент в потоке
+	apps            []AppSegment                    //Прочитанные сегменты приложений
+	scans           []ScanInfo                      //Параметры прочитанных сканов
+	readyRows       chan<- readyRow                 //Строки MCU baseline, переданные на вычисление пикселей, nil - вычисление после чтения
 }
 
 // Чтение маркера marker
@@ -85,24 +184,57 @@ func (jpeg *JPEG) readMarker(marker uint16) bool {
 }
 
 // Чтение сегмента приложения
-func (jpeg *JPEG) readApp() {
+func (jpeg *JPEG) readApp(marker uint16) {
 	ln := jpeg.reader.GetWord()
-	jpeg.reader.GetArray(ln - 2)
+	data := jpeg.reader.GetArray(ln - 2)
+
+	jpeg.apps = append(jpeg.apps, AppSegment{Marker: marker, Data: data})
+	switch {
+	case marker == APP1 && jpeg.Exif == nil && isExif(data):
+		//Поврежденные метаданные не мешают декодированию изображения
+		jpeg.Exif, _ = ParseExif(data)
+	case marker == APP14:
+		jpeg.readAdobe(data)
+	}
 }
 
-// Чтение таблицы квантования
-func (jpeg *JPEG) readQuantTable() {
-	jpeg.reader.GetWord()
-	//До тех пор, пока следующий байт не будет маркером
-	tq := jpeg.reader.GetByte()
-
-	if tq > numOfTables-1 {
-		jpeg.readError = errors.New("Segment reading error: Quant table invalid table destination")
+// Разбор сегмента Adobe APP14: "Adobe", версия, 2 слова флагов и флаг transform
+func (jpeg *JPEG) readAdobe(data []byte) {
+	if len(data) < adobeLen || string(data[:5]) != "Adobe" {
 		return
 	}
+	jpeg.adobe = true
+	jpeg.adobeTransform = data[adobeLen-1]
+}
+
+// Чтение таблиц квантования
+// Pq = 0 - 8-битные элементы, Pq = 1 - 16-битные (для 12-битных изображений)
+func (jpeg *JPEG) readQuantTable() {
+	ln := int(jpeg.reader.GetWord()) - 2
+	//До тех пор, пока в сегменте остаются таблицы
+	for ln > 0 {
+		pq, tq := jpeg.reader.Get4Bit()
 
-	table := jpeg.reader.GetArray(sizeOfTable)
-	jpeg.quantTables[tq] = table
+		if tq > numOfTables-1 {
+			jpeg.readError = errors.New("Segment reading error: Quant table invalid table destination")
+			return
+		}
+		if pq > 1 {
+			jpeg.readError = errors.New("Segment reading error: Quant table invalid precision")
+			return
+		}
+
+		table := make([]uint16, sizeOfTable)
+		for i := range table {
+			if pq == 0 {
+				table[i] = uint16(jpeg.reader.GetByte())
+			} else {
+				table[i] = jpeg.reader.GetWord()
+			}
+		}
+		jpeg.quantTables[tq] = table
+		ln -= 1 + sizeOfTable*int(pq+1)
+	}
 }
 
 // Чтение сегмента с перезапуском дельта-кодирования
@@ -111,12 +243,34 @@ func (jpeg *JPEG) readRestartInterval() {
 	jpeg.restartInterval = jpeg.reader.GetWord()
 }
 
+// Чтение сегмента DAC с параметрами условного арифметического кодирования
+// Для DC таблицы передаются границы L и U, для AC - граница Kx
+func (jpeg *JPEG) readArithConditioning() {
+	ln := int(jpeg.reader.GetWord()) - 2
+	for ; ln > 0 && jpeg.readError == nil; ln -= 2 {
+		tc, tb := jpeg.reader.Get4Bit()
+		switch tc {
+		case 0:
+			u, l := jpeg.reader.Get4Bit()
+			jpeg.readError = jpeg.arith.SetDCConditioning(tb, l, u)
+		case 1:
+			jpeg.readError = jpeg.arith.SetACConditioning(tb, jpeg.reader.GetByte())
+		default:
+			jpeg.readError = errors.New("Segment reading error: arithmetic conditioning invalid table class")
+		}
+	}
+}
+
 // Чтение сегмента таблиц, возвращает следующие за сегментами 2 байта
 func (jpeg *JPEG) readTables() uint16 {
 	marker := jpeg.reader.GetWord()
 	isContinue := false
 	if marker >= APP0 && marker <= APP15 {
-		jpeg.readApp()
+		jpeg.readApp(marker)
+		isContinue = true
+	} else if marker == COM {
+		ln := jpeg.reader.GetWord()
+		jpeg.Comments = append(jpeg.Comments, string(jpeg.reader.GetArray(ln-2)))
 		isContinue = true
 	} else if marker == DQT {
 		jpeg.readQuantTable()
@@ -142,6 +296,12 @@ func (jpeg *JPEG) readTables() uint16 {
 	} else if marker == DRI {
 		jpeg.readRestartInterval()
 		isContinue = true
+	} else if marker == DAC {
+		jpeg.readArithConditioning()
+		if jpeg.readError != nil {
+			return 0
+		}
+		isContinue = true
 	}
 	if isContinue {
 		marker = jpeg.readTables()
@@ -165,9 +325,9 @@ func (jpeg *JPEG) readScanHeader() {
 
 	//Для каждой компоненты
 	for range ns {
-		cs := jpeg.reader.GetByte()
-		if cs > numOfChannels {
-			jpeg.readError = errors.New("Segment reading error: too much color channels")
+		cs := jpeg.compIndex(jpeg.reader.GetByte())
+		if cs < 0 {
+			jpeg.readError = errors.New("Segment reading error: unknown color channel ID")
 			return
 		}
 
@@ -178,27 +338,92 @@ func (jpeg *JPEG) readScanHeader() {
 			return
 		}
 
-		jpeg.comps[cs-1].dcTableID = td
-		jpeg.comps[cs-1].acTableID = ta
-		jpeg.comps[cs-1].used = true
+		jpeg.comps[cs].dcTableID = td
+		jpeg.comps[cs].acTableID = ta
+		jpeg.comps[cs].used = true
 	}
 	jpeg.startSpectral = jpeg.reader.GetByte()
 	jpeg.endSpectral = jpeg.reader.GetByte()
-	if jpeg.startSpectral > jpeg.endSpectral || jpeg.endSpectral > 63 {
+	//Для lossless вместо spectral selection передаются предиктор и 0
+	if !jpeg.IsLossless && (jpeg.startSpectral > jpeg.endSpectral || jpeg.endSpectral > 63) {
 		jpeg.readError = fmt.Errorf("Segment reading error: spectralSelection params error: start: %d\tend: %d", jpeg.startSpectral, jpeg.endSpectral)
 		return
 	}
 	jpeg.saHigh, jpeg.saLow = jpeg.reader.Get4Bit()
+	jpeg.scans = append(jpeg.scans, jpeg.scanInfo())
+}
+
+// Поиск индекса компоненты по идентификатору, -1 если не найдена
+func (jpeg *JPEG) compIndex(id byte) int {
+	for i := range jpeg.numOfComps {
+		if jpeg.comps[i].id == id {
+			return int(i)
+		}
+	}
+	return -1
+}
+
+// Определение цветового пространства по количеству компонент и сегменту Adobe
+func (jpeg *JPEG) setTransform() {
+	switch jpeg.numOfComps {
+	case 1:
+		jpeg.transform = transformGray
+	case 3:
+		rgbIDs := jpeg.comps[0].id == 'R' && jpeg.comps[1].id == 'G' && jpeg.comps[2].id == 'B'
+		if (jpeg.adobe && jpeg.adobeTransform == adobeTransformNone) || (!jpeg.adobe && rgbIDs) {
+			jpeg.transform = transformRGB
+		} else {
+			jpeg.transform = transformYCbCr
+		}
+	case 4:
+		if jpeg.adobe && jpeg.adobeTransform == adobeTransformYCCK {
+			jpeg.transform = transformYCCK
+		} else {
+			jpeg.transform = transformCMYK
+		}
+	default:
+		jpeg.readError = fmt.Errorf("Segment reading error: unsupported number of color channels: %d", jpeg.numOfComps)
+	}
+}
+
+// Цветовая модель изображения
+func (jpeg *JPEG) colorModel() color.Model {
+	if jpeg.IsLossless {
+		if jpeg.numOfComps == 1 {
+			return color.Gray16Model
+		}
+		return color.RGBA64Model
+	}
+
+	wide := jpeg.SamplePrecision > 8
+	switch {
+	case jpeg.transform == transformCMYK || jpeg.transform == transformYCCK:
+		return color.CMYKModel
+	case jpeg.transform == transformGray && wide:
+		return color.Gray16Model
+	case jpeg.transform == transformGray:
+		return color.GrayModel
+	case wide:
+		return color.RGBA64Model
+	default:
+		return color.RGBAModel
+	}
 }
 
 // Чтение заголовка фрейма
 func (jpeg *JPEG) readFrameHeader() {
 	jpeg.reader.GetWord()
-	jpeg.samplePrecision = jpeg.reader.GetByte()
+	jpeg.SamplePrecision = jpeg.reader.GetByte()
 
-	if jpeg.samplePrecision != 8 && jpeg.samplePrecision != 16 {
+	if jpeg.IsLossless && (jpeg.SamplePrecision < 2 || jpeg.SamplePrecision > 16) {
 		jpeg.readError = errors.New("Segment reading error: invalid segment precision")
+		return
+	}
+	if !jpeg.IsLossless && jpeg.SamplePrecision != 8 && jpeg.SamplePrecision != 12 {
+		jpeg.readError = errors.New("Segment reading error: invalid segment precision")
+		return
 	}
+	jpeg.samples = newSampleRange(jpeg.SamplePrecision)
 
 	jpeg.ImageHeight = jpeg.reader.GetWord()
 	jpeg.ImageWidth = jpeg.reader.GetWord()
@@ -210,7 +435,7 @@ func (jpeg *JPEG) readFrameHeader() {
 	}
 
 	//Для каждой компоненты
-	for range jpeg.numOfComps {
+	for i := range jpeg.numOfComps {
 		c := jpeg.reader.GetByte()
 		h, v := jpeg.reader.Get4Bit()
 		if h > jpeg.maxH {
@@ -220,16 +445,42 @@ func (jpeg *JPEG) readFrameHeader() {
 			jpeg.maxV = v
 		}
 		tq := jpeg.reader.GetByte()
-		jpeg.comps[c-1] = component{h: h, v: v, quantTableID: tq}
+		for k := range i {
+			if jpeg.comps[k].id == c {
+				jpeg.readError = errors.New("Segment reading error: duplicate color channel ID")
+				return
+			}
+		}
+		jpeg.comps[i] = component{id: c, h: h, v: v, quantTableID: tq}
+	}
+
+	//Единственная компонента всегда читается неинтерливно, MCU из одного блока
+	if jpeg.numOfComps == 1 {
+		jpeg.comps[0].h, jpeg.comps[0].v = 1, 1
+		jpeg.maxH, jpeg.maxV = 1, 1
 	}
 }
 
 // Чтение скана, iterCount - кол-во строк/сканов для текущего вычисления
 func (jpeg *JPEG) readScans(iterCount uint16) bool {
+	if !jpeg.IsProgressive && jpeg.Options.workers() > 1 {
+		return jpeg.readScansPipelined(iterCount)
+	}
+	startStatus := int(jpeg.CurStatus)
+	curRow, ok := jpeg.decodeScans(iterCount)
+	if !ok {
+		return false
+	}
+	jpeg.rgbCalc(jpeg.blocks, startStatus, int(curRow))
+	return true
+}
+
+// Декодирование сканов в коэффициенты без вычисления пикселей
+// Возвращает номер строки блоков, на которой остановилось чтение baseline
+func (jpeg *JPEG) decodeScans(iterCount uint16) (uint16, bool) {
 	var curRow uint16
 	var flag bool
 	readAll := iterCount == 0
-	startStatus := int(jpeg.CurStatus)
 
 	if jpeg.IsProgressive {
 		temp := jpeg.CurStatus
@@ -240,14 +491,17 @@ func (jpeg *JPEG) readScans(iterCount uint16) bool {
 				break
 			} else if nextMarker != SOS {
 				jpeg.readError = errors.New("Scan reading error")
-				return false
+				return 0, false
 			}
 			jpeg.readScanHeader()
 			if !jpeg.decodeProgressiveScan(jpeg.blocks) {
-				return false
+				return 0, false
 			}
 
-			if jpeg.reader.GetNextByte() != 0xFF {
+			if jpeg.IsArithmetic {
+				//Арифметический декодер может не дочитать скан до маркера
+				jpeg.reader.SkipToMarker()
+			} else if jpeg.reader.GetNextByte() != 0xFF {
 				jpeg.reader.BitsAlign()
 			}
 			jpeg.CurStatus++
@@ -257,75 +511,180 @@ func (jpeg *JPEG) readScans(iterCount uint16) bool {
 			nextMarker := jpeg.readTables()
 			if nextMarker != SOS {
 				jpeg.readError = errors.New("Scan reading error")
-				return false
+				return 0, false
 			}
 			jpeg.readScanHeader()
 			jpeg.decodeInit()
 		}
-		jpeg.CurStatus, curRow, flag = jpeg.decodeBaselineScan(jpeg.blocks, iterCount)
+		if readAll && jpeg.CurStatus == 0 && jpeg.parallelRestarts() {
+			jpeg.CurStatus, curRow, flag = jpeg.decodeRestartSegments(jpeg.blocks)
+		} else {
+			jpeg.CurStatus, curRow, flag = jpeg.decodeBaselineScan(jpeg.blocks, iterCount)
+		}
 		if !flag {
-			return false
+			return 0, false
 		}
 	}
-	jpeg.rgbCalc(jpeg.blocks, readAll, startStatus, int(curRow))
-	return true
+	return curRow, true
 }
 
 // Чтение заголовка файла до заголовка фрейма включительно
 func (jpeg *JPEG) readFileHeader() {
 	nextMarker := jpeg.readTables()
+	//Поврежденный профиль не мешает декодированию изображения
+	if data, err := assembleICC(jpeg.apps); err == nil && data != nil {
+		jpeg.ICC, _ = ParseICC(data)
+	}
+	jpeg.readXMP()
 	switch nextMarker {
-	case SOF0:
+	case SOF0, SOF1:
 		jpeg.IsProgressive = false
 	case SOF2:
 		jpeg.IsProgressive = true
+	case SOF3:
+		jpeg.IsLossless = true
+	case SOF9:
+		jpeg.IsArithmetic = true
+	case SOF10:
+		jpeg.IsProgressive = true
+		jpeg.IsArithmetic = true
 	default:
-		jpeg.readError = errors.New("Decoder works only with Baseline and Progressive DCT-based JPEG")
+		jpeg.readError = errors.New("Decoder works only with Baseline, Extended, Progressive, Lossless Huffman and Arithmetic DCT JPEG")
 		return
 	}
 	jpeg.readFrameHeader()
+	//Для lossless отсчеты отдаются без цветового преобразования
+	if jpeg.readError == nil && !jpeg.IsLossless {
+		jpeg.setTransform()
+	}
 }
 
-// Чтение изображения на кол-во строк numOfRows
-// Возвращает true, если прочитано до конца
-func (jpeg *JPEG) ReadBaseJPEG(result Image, numOfRows uint16) (bool, error) {
+// Размеры буфера результата
+func bufSize[T any](buf [][]T) (int, int) {
+	if len(buf) == 0 {
+		return 0, 0
+	}
+	return len(buf), len(buf[0])
+}
+
+// Проверка размеров буфера для результата и сброс предыдущего буфера
+func (jpeg *JPEG) prepareRead(height int, width int) error {
+	if jpeg.IsLossless {
+		return errors.New("Lossless image must be read with ReadLosslessJPEG")
+	}
+
+	if err := jpeg.Options.validate(); err != nil {
+		return err
+	}
+
 	if jpeg.CurStatus == 0 {
 		jpeg.constInit()
 	}
 
-	if len(result) != int(jpeg.ImageHeight) || len(result[0]) != int(jpeg.ImageWidth) {
-		return false, errors.New("Buffer size error")
+	if !jpeg.Options.Crop.Empty() && !jpeg.Options.Crop.In(jpeg.scaledRect()) {
+		return errors.New("Crop is out of image bounds")
 	}
-	jpeg.img = result
 
-	if !jpeg.readScans(numOfRows) {
-		return jpeg.wasEOI, jpeg.readError
+	if outHeight, outWidth := jpeg.OutputSize(); height != int(outHeight) || width != int(outWidth) {
+		return errors.New("Buffer size error")
+	}
+	jpeg.img, jpeg.gray, jpeg.cmyk, jpeg.img16, jpeg.gray16, jpeg.ycbcr = nil, nil, nil, nil, nil, nil
+	return nil
+}
+
+// Чтение изображения в установленный буфер на iterCount строк или сканов
+// Возвращает true, если прочитано до конца
+func (jpeg *JPEG) read(iterCount uint16) (bool, error) {
+	if !jpeg.readScans(iterCount) || jpeg.reader.EOF() {
+		return jpeg.wasEOI, jpeg.err()
 	}
 	return jpeg.wasEOI, nil
 }
 
+// Ошибка чтения, io.ErrUnexpectedEOF если данные закончились раньше времени
+func (jpeg *JPEG) err() error {
+	if jpeg.reader.EOF() {
+		return io.ErrUnexpectedEOF
+	}
+	return jpeg.readError
+}
+
+// Чтение изображения на кол-во строк numOfRows
+// Возвращает true, если прочитано до конца
+func (jpeg *JPEG) ReadBaseJPEG(result Image, numOfRows uint16) (bool, error) {
+	if err := jpeg.prepareRead(bufSize(result)); err != nil {
+		return false, err
+	}
+	jpeg.img = result
+
+	return jpeg.read(numOfRows)
+}
+
 // Чтение изображения на кол-во сканов numOfScans
 // Возвращает true, если прочитано до конца
 func (jpeg *JPEG) ReadProgJPEG(result Image, numOfScans uint16) (bool, error) {
-	if jpeg.CurStatus == 0 {
-		jpeg.constInit()
+	if err := jpeg.prepareRead(bufSize(result)); err != nil {
+		return false, err
+	}
+	jpeg.img = result
+
+	return jpeg.read(numOfScans)
+}
+
+// Чтение изображения в оттенках серого, iterCount - кол-во строк для baseline или сканов для progressive
+// Для цветного изображения в результат записывается яркостная компонента Y
+// Возвращает true, если прочитано до конца
+func (jpeg *JPEG) ReadGrayJPEG(result GrayImage, iterCount uint16) (bool, error) {
+	if err := jpeg.prepareRead(bufSize(result)); err != nil {
+		return false, err
 	}
+	jpeg.gray = result
+
+	return jpeg.read(iterCount)
+}
 
-	if len(result) != int(jpeg.ImageHeight) || len(result[0]) != int(jpeg.ImageWidth) {
-		return false, errors.New("Buffer size error")
+// Чтение изображения в CMYK, iterCount - кол-во строк для baseline или сканов для progressive
+// Инвертированные значения из файлов с сегментом Adobe возвращаются в прямом виде,
+// изображения в других пространствах переводятся в CMYK
+// Возвращает true, если прочитано до конца
+func (jpeg *JPEG) ReadCMYKJPEG(result CMYKImage, iterCount uint16) (bool, error) {
+	if err := jpeg.prepareRead(bufSize(result)); err != nil {
+		return false, err
 	}
-	jpeg.img = result
+	jpeg.cmyk = result
+
+	return jpeg.read(iterCount)
+}
 
-	if !jpeg.readScans(numOfScans) {
-		return jpeg.wasEOI, jpeg.readError
+// Чтение изображения в RGB с 16 битами на отсчет, iterCount - кол-во строк для baseline или сканов для progressive
+// Значения записываются в исходной глубине SamplePrecision без растяжения
+// Возвращает true, если прочитано до конца
+func (jpeg *JPEG) ReadJPEG16(result Image16, iterCount uint16) (bool, error) {
+	if err := jpeg.prepareRead(bufSize(result)); err != nil {
+		return false, err
 	}
-	return jpeg.wasEOI, nil
+	jpeg.img16 = result
+
+	return jpeg.read(iterCount)
+}
+
+// Чтение изображения в оттенках серого с 16 битами на отсчет
+// Значения записываются в исходной глубине SamplePrecision без растяжения
+// Возвращает true, если прочитано до конца
+func (jpeg *JPEG) ReadGray16JPEG(result Gray16Image, iterCount uint16) (bool, error) {
+	if err := jpeg.prepareRead(bufSize(result)); err != nil {
+		return false, err
+	}
+	jpeg.gray16 = result
+
+	return jpeg.read(iterCount)
 }
 
 // Чтение JPEG файла по пути source
 func ReadJPEG(source *bufio.Reader) (*JPEG, error) {
 	var res JPEG
 	res.reader = binreader.BinReaderInit(source)
+	res.arith = arithmetic.NewDecoder()
 
 	if !res.readMarker(SOI) {
 		return nil, errors.New("Image is not JPEG: can't read SOI marker")
@@ -333,8 +692,8 @@ func ReadJPEG(source *bufio.Reader) (*JPEG, error) {
 
 	res.readFileHeader()
 
-	if res.readError != nil {
-		return nil, res.readError
+	if res.readError != nil || res.reader.EOF() {
+		return nil, res.err()
 	}
 
 	return &res, nil
@@ -343,7 +702,7 @@ func ReadJPEG(source *bufio.Reader) (*JPEG, error) {
 // =======================================
 // Кодирование в BMP для наглядности
 func EncodeBMP(img Image, fileName string) {
-	err := binwriter.BinwriterInit(fileName)
+	writer, err := binwriter.BinWriterInit(fileName)
 	if err != nil {
 		log.Panic(err.Error())
 	}
@@ -351,28 +710,28 @@ func EncodeBMP(img Image, fileName string) {
 	width := len(img[0])
 	paddingSize := width % 4
 	size := 14 + 12 + height*width*3 + paddingSize*height
-	binwriter.PutChar('B')
-	binwriter.PutChar('M')
-	binwriter.PutInt(uint(size))
-	binwriter.PutInt(0)
-	binwriter.PutInt(0x1A)
-	binwriter.PutInt(12)
-	binwriter.PutShort(uint(width))
-	binwriter.PutShort(uint(height))
-	binwriter.PutShort(1)
-	binwriter.PutShort(24)
+	writer.PutChar('B')
+	writer.PutChar('M')
+	writer.PutInt(uint(size))
+	writer.PutInt(0)
+	writer.PutInt(0x1A)
+	writer.PutInt(12)
+	writer.PutShort(uint(width))
+	writer.PutShort(uint(height))
+	writer.PutShort(1)
+	writer.PutShort(24)
 
 	for i := int(height - 1); i >= 0; i-- {
 		for j := 0; j < int(width); j++ {
-			binwriter.PutChar(img[i][j].B)
-			binwriter.PutChar(img[i][j].G)
-			binwriter.PutChar(img[i][j].R)
+			writer.PutChar(img[i][j].B)
+			writer.PutChar(img[i][j].G)
+			writer.PutChar(img[i][j].R)
 		}
 		for range paddingSize {
-			binwriter.PutChar(0)
+			writer.PutChar(0)
 		}
 	}
-	err = binwriter.Close()
+	err = writer.Close()
 	if err != nil {
 		log.Panic(err.Error())
 	}
@@ -0,0 +1,457 @@
+package decoder
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	binreader "jpeg/decoder/binReader"
+	"math"
+	"strings"
+	"time"
+)
+
+// Разбор метаданных EXIF из сегмента APP1: заголовок TIFF и каталоги IFD с тегами
+
+const exifHeader = "Exif\x00\x00" //Начало данных сегмента APP1 с EXIF
+
+// Номер тега EXIF
+type ExifTag uint16
+
+// Теги IFD0 и IFD1
+const (
+	TagImageDescription ExifTag = 0x010E
+	TagMake             ExifTag = 0x010F
+	TagModel            ExifTag = 0x0110
+	TagOrientation      ExifTag = 0x0112
+	TagXResolution      ExifTag = 0x011A
+	TagYResolution      ExifTag = 0x011B
+	TagResolutionUnit   ExifTag = 0x0128
+	TagSoftware         ExifTag = 0x0131
+	TagDateTime         ExifTag = 0x0132
+	TagArtist           ExifTag = 0x013B
+	TagThumbnailOffset  ExifTag = 0x0201 //Смещение миниатюры JPEG в IFD1
+	TagThumbnailLength  ExifTag = 0x0202 //Длина миниатюры JPEG в IFD1
+	TagCopyright        ExifTag = 0x8298
+	TagExifIFD          ExifTag = 0x8769 //Смещение каталога EXIF
+	TagGPSIFD           ExifTag = 0x8825 //Смещение каталога GPS
+)
+
+// Теги каталога EXIF
+const (
+	TagExposureTime      ExifTag = 0x829A
+	TagFNumber           ExifTag = 0x829D
+	TagExposureProgram   ExifTag = 0x8822
+	TagISOSpeed          ExifTag = 0x8827
+	TagExifVersion       ExifTag = 0x9000
+	TagDateTimeOriginal  ExifTag = 0x9003
+	TagDateTimeDigitized ExifTag = 0x9004
+	TagOffsetTimeOrig    ExifTag = 0x9011
+	TagExposureBias      ExifTag = 0x9204
+	TagFlash             ExifTag = 0x9209
+	TagFocalLength       ExifTag = 0x920A
+	TagSubSecTimeOrig    ExifTag = 0x9291
+	TagPixelXDimension   ExifTag = 0xA002
+	TagPixelYDimension   ExifTag = 0xA003
+	TagLensModel         ExifTag = 0xA434
+)
+
+// Теги каталога GPS
+const (
+	TagGPSLatitudeRef  ExifTag = 0x0001
+	TagGPSLatitude     ExifTag = 0x0002
+	TagGPSLongitudeRef ExifTag = 0x0003
+	TagGPSLongitude    ExifTag = 0x0004
+	TagGPSAltitudeRef  ExifTag = 0x0005
+	TagGPSAltitude     ExifTag = 0x0006
+	TagGPSTimeStamp    ExifTag = 0x0007
+	TagGPSDateStamp    ExifTag = 0x001D
+)
+
+// Тип значения тега
+type ExifType uint16
+
+const (
+	ExifByte      ExifType = 1
+	ExifASCII     ExifType = 2
+	ExifShort     ExifType = 3
+	ExifLong      ExifType = 4
+	ExifRational  ExifType = 5
+	ExifSByte     ExifType = 6
+	ExifUndefined ExifType = 7
+	ExifSShort    ExifType = 8
+	ExifSLong     ExifType = 9
+	ExifSRational ExifType = 10
+	ExifFloat     ExifType = 11
+	ExifDouble    ExifType = 12
+)
+
+// Размер одного значения типа в байтах, 0 - неизвестный тип
+func (typ ExifType) size() int {
+	switch typ {
+	case ExifByte, ExifASCII, ExifSByte, ExifUndefined:
+		return 1
+	case ExifShort, ExifSShort:
+		return 2
+	case ExifLong, ExifSLong, ExifFloat:
+		return 4
+	case ExifRational, ExifSRational, ExifDouble:
+		return 8
+	}
+	return 0
+}
+
+// Значение тега EXIF
+type ExifField struct {
+	Type  ExifType         //Тип значений
+	Count int              //Количество значений
+	Data  []byte           //Значения в порядке байт файла
+	end   binreader.Endian //Порядок байт файла
+}
+
+// Метаданные EXIF по каталогам, отсутствующий каталог - пустой
+type Exif struct {
+	IFD0    map[ExifTag]ExifField //Основное изображение
+	ExifIFD map[ExifTag]ExifField //Параметры съемки
+	GPS     map[ExifTag]ExifField //Координаты съемки
+	IFD1    map[ExifTag]ExifField //Миниатюра
+}
+
+// Чтение данных data с позиции offset в порядке байт end
+func sliceReader(data []byte, offset int, end binreader.Endian) *binreader.BinReader {
+	reader := binreader.BinReaderInit(bufio.NewReader(bytes.NewReader(data[offset:])))
+	reader.SetEndian(end)
+	return reader
+}
+
+// Проверка, что данные сегмента APP1 содержат EXIF
+func isExif(data []byte) bool {
+	return len(data) >= len(exifHeader) && string(data[:len(exifHeader)]) == exifHeader
+}
+
+// Разбор данных сегмента APP1 с заголовком Exif
+func ParseExif(data []byte) (*Exif, error) {
+	if !isExif(data) {
+		return nil, errors.New("EXIF reading error: no Exif header")
+	}
+	tiff := data[len(exifHeader):]
+	if len(tiff) < 8 {
+		return nil, errors.New("EXIF reading error: TIFF header is too short")
+	}
+
+	var end binreader.Endian
+	switch string(tiff[:2]) {
+	case "II":
+		end = binreader.LITTLE
+	case "MM":
+		end = binreader.BIG
+	default:
+		return nil, errors.New("EXIF reading error: unknown byte order")
+	}
+	reader := sliceReader(tiff, 2, end)
+	if reader.GetWord() != 42 {
+		return nil, errors.New("EXIF reading error: invalid TIFF header")
+	}
+
+	p := exifParser{data: tiff, end: end, visited: map[uint32]bool{}}
+	res := &Exif{}
+	next, err := p.readIFD(reader.GetDWord(), &res.IFD0)
+	if err != nil {
+		return nil, err
+	}
+	if next != 0 {
+		if _, err := p.readIFD(next, &res.IFD1); err != nil {
+			return nil, err
+		}
+	}
+	for _, sub := range []struct {
+		tag ExifTag
+		ifd *map[ExifTag]ExifField
+	}{{TagExifIFD, &res.ExifIFD}, {TagGPSIFD, &res.GPS}} {
+		field, ok := res.IFD0[sub.tag]
+		if !ok {
+			continue
+		}
+		offset, err := field.Int(0)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := p.readIFD(uint32(offset), sub.ifd); err != nil {
+			return nil, err
+		}
+	}
+	return res, nil
+}
+
+// Состояние разбора каталогов TIFF
+type exifParser struct {
+	data    []byte           //Данные TIFF, смещения отсчитываются от их начала
+	end     binreader.Endian //Порядок байт
+	visited map[uint32]bool  //Прочитанные каталоги для защиты от циклов
+}
+
+// Чтение каталога по смещению offset в res
+// Возвращает смещение следующего каталога, 0 - последний каталог
+func (p *exifParser) readIFD(offset uint32, res *map[ExifTag]ExifField) (uint32, error) {
+	if p.visited[offset] {
+		return 0, errors.New("EXIF reading error: IFD loop")
+	}
+	p.visited[offset] = true
+	if int64(offset)+2 > int64(len(p.data)) {
+		return 0, errors.New("EXIF reading error: IFD out of bounds")
+	}
+
+	reader := sliceReader(p.data, int(offset), p.end)
+	count := int(reader.GetWord())
+	entries := int(offset) + 2
+	if entries+12*count > len(p.data) {
+		return 0, errors.New("EXIF reading error: IFD out of bounds")
+	}
+
+	*res = make(map[ExifTag]ExifField, count)
+	for i := range count {
+		tag, typ, n := ExifTag(reader.GetWord()), ExifType(reader.GetWord()), reader.GetDWord()
+		valueOffset := reader.GetDWord()
+		//Неизвестные типы пропускаются
+		if typ.size() == 0 {
+			continue
+		}
+
+		size := int64(typ.size()) * int64(n)
+		start := int64(entries + 12*i + 8) //Значения до 4 байт записаны на месте смещения
+		if size > 4 {
+			start = int64(valueOffset)
+		}
+		if start+size > int64(len(p.data)) {
+			return 0, fmt.Errorf("EXIF reading error: tag %#04x value out of bounds", uint16(tag))
+		}
+		(*res)[tag] = ExifField{Type: typ, Count: int(n), Data: p.data[start : start+size], end: p.end}
+	}
+
+	//Смещение следующего каталога может отсутствовать в конце данных
+	if entries+12*count+4 > len(p.data) {
+		return 0, nil
+	}
+	return reader.GetDWord(), nil
+}
+
+// Проверка номера значения index
+func (f ExifField) check(index int) error {
+	if index < 0 || index >= f.Count {
+		return fmt.Errorf("EXIF value error: index %d out of range %d", index, f.Count)
+	}
+	return nil
+}
+
+// Целое значение с номером index для типов BYTE, SHORT, LONG, UNDEFINED и знаковых
+func (f ExifField) Int(index int) (int64, error) {
+	if err := f.check(index); err != nil {
+		return 0, err
+	}
+	reader := sliceReader(f.Data, index*f.Type.size(), f.end)
+	switch f.Type {
+	case ExifByte, ExifUndefined:
+		return int64(reader.GetByte()), nil
+	case ExifSByte:
+		return int64(int8(reader.GetByte())), nil
+	case ExifShort:
+		return int64(reader.GetWord()), nil
+	case ExifSShort:
+		return int64(int16(reader.GetWord())), nil
+	case ExifLong:
+		return int64(reader.GetDWord()), nil
+	case ExifSLong:
+		return int64(int32(reader.GetDWord())), nil
+	}
+	return 0, errors.New("EXIF value error: not an integer type")
+}
+
+// Числитель и знаменатель дроби с номером index для типов RATIONAL и SRATIONAL
+func (f ExifField) Rational(index int) (int64, int64, error) {
+	if err := f.check(index); err != nil {
+		return 0, 0, err
+	}
+	reader := sliceReader(f.Data, index*f.Type.size(), f.end)
+	switch f.Type {
+	case ExifRational:
+		return int64(reader.GetDWord()), int64(reader.GetDWord()), nil
+	case ExifSRational:
+		return int64(int32(reader.GetDWord())), int64(int32(reader.GetDWord())), nil
+	}
+	return 0, 0, errors.New("EXIF value error: not a rational type")
+}
+
+// Значение с номером index любого числового типа
+func (f ExifField) Float(index int) (float64, error) {
+	switch f.Type {
+	case ExifRational, ExifSRational:
+		num, den, err := f.Rational(index)
+		if err != nil {
+			return 0, err
+		}
+		if den == 0 {
+			return 0, errors.New("EXIF value error: zero denominator")
+		}
+		return float64(num) / float64(den), nil
+	case ExifFloat, ExifDouble:
+		if err := f.check(index); err != nil {
+			return 0, err
+		}
+		reader := sliceReader(f.Data, index*f.Type.size(), f.end)
+		if f.Type == ExifFloat {
+			return float64(math.Float32frombits(reader.GetDWord())), nil
+		}
+		first, second := uint64(reader.GetDWord()), uint64(reader.GetDWord())
+		if f.end == binreader.LITTLE {
+			first, second = second, first
+		}
+		return math.Float64frombits(first<<32 | second), nil
+	}
+	val, err := f.Int(index)
+	return float64(val), err
+}
+
+// Строка типа ASCII без завершающих нулей
+func (f ExifField) Text() (string, error) {
+	if f.Type != ExifASCII {
+		return "", errors.New("EXIF value error: not an ASCII type")
+	}
+	return strings.TrimRight(string(f.Data), "\x00"), nil
+}
+
+// Поиск тега tag в каталоге ifd
+func exifField(ifd map[ExifTag]ExifField, tag ExifTag) (ExifField, error) {
+	field, ok := ifd[tag]
+	if !ok {
+		return ExifField{}, fmt.Errorf("EXIF value error: tag %#04x not found", uint16(tag))
+	}
+	return field, nil
+}
+
+// Строка тега tag каталога ifd, пустая при отсутствии
+func exifText(ifd map[ExifTag]ExifField, tag ExifTag) string {
+	field, err := exifField(ifd, tag)
+	if err != nil {
+		return ""
+	}
+	text, _ := field.Text()
+	return strings.TrimSpace(text)
+}
+
+// Число тега tag каталога ifd
+func exifFloat(ifd map[ExifTag]ExifField, tag ExifTag) (float64, error) {
+	field, err := exifField(ifd, tag)
+	if err != nil {
+		return 0, err
+	}
+	return field.Float(0)
+}
+
+// Производитель камеры
+func (e *Exif) Make() string {
+	return exifText(e.IFD0, TagMake)
+}
+
+// Модель камеры
+func (e *Exif) Model() string {
+	return exifText(e.IFD0, TagModel)
+}
+
+// Ориентация изображения 1-8, 1 при отсутствии или неверном значении
+func (e *Exif) Orientation() int {
+	field, err := exifField(e.IFD0, TagOrientation)
+	if err != nil {
+		return 1
+	}
+	val, err := field.Int(0)
+	if err != nil || val < 1 || val > 8 {
+		return 1
+	}
+	return int(val)
+}
+
+// Время съемки из DateTimeOriginal, при отсутствии из DateTime IFD0
+// Часовой пояс берется из OffsetTimeOriginal, без него время считается UTC
+func (e *Exif) DateTimeOriginal() (time.Time, error) {
+	text := exifText(e.ExifIFD, TagDateTimeOriginal)
+	if text == "" {
+		text = exifText(e.IFD0, TagDateTime)
+	}
+	if offset := exifText(e.ExifIFD, TagOffsetTimeOrig); offset != "" {
+		return time.Parse("2006:01:02 15:04:05-07:00", text+offset)
+	}
+	return time.Parse("2006:01:02 15:04:05", text)
+}
+
+// Выдержка в секундах в виде дроби
+func (e *Exif) ExposureTime() (int64, int64, error) {
+	field, err := exifField(e.ExifIFD, TagExposureTime)
+	if err != nil {
+		return 0, 0, err
+	}
+	return field.Rational(0)
+}
+
+// Диафрагменное число
+func (e *Exif) FNumber() (float64, error) {
+	return exifFloat(e.ExifIFD, TagFNumber)
+}
+
+// Фокусное расстояние в миллиметрах
+func (e *Exif) FocalLength() (float64, error) {
+	return exifFloat(e.ExifIFD, TagFocalLength)
+}
+
+// Светочувствительность ISO
+func (e *Exif) ISO() (int, error) {
+	val, err := exifFloat(e.ExifIFD, TagISOSpeed)
+	return int(val), err
+}
+
+// Координата в градусах из тега tag с градусами, минутами и секундами и направления из тега ref
+// Направления negative ("S" или "W") дают отрицательную координату
+func (e *Exif) gpsCoordinate(tag ExifTag, ref ExifTag, negative string) (float64, error) {
+	field, err := exifField(e.GPS, tag)
+	if err != nil {
+		return 0, err
+	}
+	res := 0.0
+	for i, scale := range []float64{1, 60, 3600} {
+		val, err := field.Float(i)
+		if err != nil {
+			return 0, err
+		}
+		res += val / scale
+	}
+	if exifText(e.GPS, ref) == negative {
+		res = -res
+	}
+	return res, nil
+}
+
+// Широта и долгота съемки в градусах, южная широта и западная долгота отрицательны
+func (e *Exif) GPSPosition() (float64, float64, error) {
+	lat, err := e.gpsCoordinate(TagGPSLatitude, TagGPSLatitudeRef, "S")
+	if err != nil {
+		return 0, 0, err
+	}
+	lon, err := e.gpsCoordinate(TagGPSLongitude, TagGPSLongitudeRef, "W")
+	if err != nil {
+		return 0, 0, err
+	}
+	return lat, lon, nil
+}
+
+// Высота съемки в метрах, ниже уровня моря отрицательна
+func (e *Exif) GPSAltitude() (float64, error) {
+	res, err := exifFloat(e.GPS, TagGPSAltitude)
+	if err != nil {
+		return 0, err
+	}
+	if field, err := exifField(e.GPS, TagGPSAltitudeRef); err == nil {
+		if ref, _ := field.Int(0); ref == 1 {
+			res = -res
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,250 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"os"
+	"testing"
+	"time"
+)
+
+// Тег для записи в тестовый каталог
+type testExifEntry struct {
+	tag   ExifTag
+	typ   ExifType
+	count int
+	data  []byte
+}
+
+// Порядок байт с дописыванием значений в срез
+type testByteOrder interface {
+	binary.ByteOrder
+	binary.AppendByteOrder
+}
+
+// Построитель данных TIFF с порядком байт order
+type testTIFF struct {
+	order testByteOrder
+	buf   []byte
+}
+
+// Заголовок TIFF, смещение IFD0 записывается в segment
+func newTestTIFF(order testByteOrder) *testTIFF {
+	t := &testTIFF{order: order}
+	if order == testByteOrder(binary.LittleEndian) {
+		t.buf = append(t.buf, 'I', 'I')
+	} else {
+		t.buf = append(t.buf, 'M', 'M')
+	}
+	t.buf = order.AppendUint16(t.buf, 42)
+	t.buf = order.AppendUint32(t.buf, 0)
+	return t
+}
+
+// Запись каталога с тегами entries и смещением следующего каталога next, возвращает смещение каталога
+func (t *testTIFF) ifd(entries []testExifEntry, next uint32) uint32 {
+	offset := uint32(len(t.buf))
+	dataOffset := offset + 2 + 12*uint32(len(entries)) + 4
+	var values []byte
+	t.buf = t.order.AppendUint16(t.buf, uint16(len(entries)))
+	for _, e := range entries {
+		t.buf = t.order.AppendUint16(t.buf, uint16(e.tag))
+		t.buf = t.order.AppendUint16(t.buf, uint16(e.typ))
+		t.buf = t.order.AppendUint32(t.buf, uint32(e.count))
+		if len(e.data) <= 4 {
+			t.buf = append(t.buf, append(e.data, make([]byte, 4-len(e.data))...)...)
+		} else {
+			t.buf = t.order.AppendUint32(t.buf, dataOffset+uint32(len(values)))
+			values = append(values, e.data...)
+		}
+	}
+	t.buf = t.order.AppendUint32(t.buf, next)
+	t.buf = append(t.buf, values...)
+	return offset
+}
+
+// Данные сегмента APP1 с IFD0 по смещению ifd0
+func (t *testTIFF) segment(ifd0 uint32) []byte {
+	t.order.PutUint32(t.buf[4:], ifd0)
+	return append([]byte(exifHeader), t.buf...)
+}
+
+func (t *testTIFF) ascii(tag ExifTag, text string) testExifEntry {
+	return testExifEntry{tag, ExifASCII, len(text) + 1, append([]byte(text), 0)}
+}
+
+func (t *testTIFF) short(tag ExifTag, val uint16) testExifEntry {
+	return testExifEntry{tag, ExifShort, 1, t.order.AppendUint16(nil, val)}
+}
+
+func (t *testTIFF) long(tag ExifTag, val uint32) testExifEntry {
+	return testExifEntry{tag, ExifLong, 1, t.order.AppendUint32(nil, val)}
+}
+
+func (t *testTIFF) rationals(tag ExifTag, typ ExifType, vals ...uint32) testExifEntry {
+	var data []byte
+	for _, val := range vals {
+		data = t.order.AppendUint32(data, val)
+	}
+	return testExifEntry{tag, typ, len(vals) / 2, data}
+}
+
+// Сегмент EXIF со всеми каталогами в порядке байт order
+func testExifSegment(order testByteOrder) []byte {
+	t := newTestTIFF(order)
+	exifIFD := t.ifd([]testExifEntry{
+		t.rationals(TagExposureTime, ExifRational, 1, 250),
+		t.rationals(TagFNumber, ExifRational, 28, 10),
+		t.short(TagISOSpeed, 400),
+		t.ascii(TagDateTimeOriginal, "2024:05:17 14:03:21"),
+		t.ascii(TagOffsetTimeOrig, "+09:00"),
+		t.rationals(TagFocalLength, ExifRational, 50, 1),
+		t.rationals(TagExposureBias, ExifSRational, math.MaxUint32, 3),
+		{TagFlash, ExifDouble, 1, t.order.AppendUint64(nil, math.Float64bits(1.5))},
+	}, 0)
+	gps := t.ifd([]testExifEntry{
+		t.ascii(TagGPSLatitudeRef, "N"),
+		t.rationals(TagGPSLatitude, ExifRational, 35, 1, 39, 1, 315, 10),
+		t.ascii(TagGPSLongitudeRef, "W"),
+		t.rationals(TagGPSLongitude, ExifRational, 139, 1, 42, 1, 0, 1),
+		{TagGPSAltitudeRef, ExifByte, 1, []byte{1}},
+		t.rationals(TagGPSAltitude, ExifRational, 125, 2),
+	}, 0)
+	ifd1 := t.ifd([]testExifEntry{t.long(TagThumbnailOffset, 1000), t.long(TagThumbnailLength, 2000)}, 0)
+	ifd0 := t.ifd([]testExifEntry{
+		t.ascii(TagMake, "Canon"),
+		t.ascii(TagModel, "EOS R5 "),
+		t.short(TagOrientation, 6),
+		t.long(TagExifIFD, exifIFD),
+		t.long(TagGPSIFD, gps),
+		{0x9999, 99, 1, []byte{1, 2, 3, 4}}, //Неизвестный тип пропускается
+	}, ifd1)
+	return t.segment(ifd0)
+}
+
+// Вставка сегментов marker с данными apps после SOI файла data
+func withApp(data []byte, marker uint16, apps ...[]byte) []byte {
+	res := append([]byte{}, data[:2]...)
+	for _, app := range apps {
+		res = append(res, byte(marker>>8), byte(marker), byte((len(app)+2)>>8), byte(len(app)+2))
+		res = append(res, app...)
+	}
+	return append(res, data[2:]...)
+}
+
+func TestParseExif(t *testing.T) {
+	for _, order := range []testByteOrder{binary.LittleEndian, binary.BigEndian} {
+		exif, err := ParseExif(testExifSegment(order))
+		if err != nil {
+			t.Fatal(order, "ParseExif -> error", err.Error())
+		}
+		if exif.Make() != "Canon" || exif.Model() != "EOS R5" || exif.Orientation() != 6 {
+			t.Fatal(order, "Read:", exif.Make(), exif.Model(), exif.Orientation(), "Expect: Canon EOS R5 6")
+		}
+
+		date, err := exif.DateTimeOriginal()
+		want := time.Date(2024, 5, 17, 14, 3, 21, 0, time.FixedZone("", 9*3600))
+		if err != nil || !date.Equal(want) {
+			t.Fatal(order, "DateTimeOriginal:", date, err, "Expect:", want)
+		}
+		if num, den, err := exif.ExposureTime(); err != nil || num != 1 || den != 250 {
+			t.Fatal(order, "ExposureTime:", num, den, err)
+		}
+		if val, err := exif.FNumber(); err != nil || val != 2.8 {
+			t.Fatal(order, "FNumber:", val, err)
+		}
+		if val, err := exif.ISO(); err != nil || val != 400 {
+			t.Fatal(order, "ISO:", val, err)
+		}
+		if val, err := exif.FocalLength(); err != nil || val != 50 {
+			t.Fatal(order, "FocalLength:", val, err)
+		}
+		if num, den, err := exif.ExifIFD[TagExposureBias].Rational(0); err != nil || num != -1 || den != 3 {
+			t.Fatal(order, "ExposureBias:", num, den, err)
+		}
+		if val, err := exif.ExifIFD[TagFlash].Float(0); err != nil || val != 1.5 {
+			t.Fatal(order, "Double:", val, err)
+		}
+
+		lat, lon, err := exif.GPSPosition()
+		if err != nil || math.Abs(lat-(35+39.0/60+31.5/3600)) > 1e-9 || math.Abs(lon+(139+42.0/60)) > 1e-9 {
+			t.Fatal(order, "GPSPosition:", lat, lon, err)
+		}
+		if val, err := exif.GPSAltitude(); err != nil || val != -62.5 {
+			t.Fatal(order, "GPSAltitude:", val, err)
+		}
+
+		if val, err := exif.IFD1[TagThumbnailLength].Int(0); err != nil || val != 2000 {
+			t.Fatal(order, "IFD1 thumbnail length:", val, err)
+		}
+		if _, ok := exif.IFD0[0x9999]; ok {
+			t.Fatal(order, "Tag of unknown type -> expect skipped")
+		}
+	}
+}
+
+func TestParseExifErrors(t *testing.T) {
+	segment := testExifSegment(binary.BigEndian)
+	//IFD0 ссылается на себя как на следующий каталог
+	loop := newTestTIFF(binary.LittleEndian)
+	loop.ifd([]testExifEntry{loop.short(TagOrientation, 1)}, 8)
+
+	bad := map[string][]byte{
+		"no header":     []byte("JFIF\x00"),
+		"short":         segment[:10],
+		"byte order":    append([]byte(exifHeader), "XX\x00\x2a\x00\x00\x00\x08"...),
+		"magic":         append([]byte(exifHeader), "MM\x00\x2b\x00\x00\x00\x08"...),
+		"truncated IFD": segment[:len(segment)-40],
+		"loop":          loop.segment(8),
+	}
+	for name, data := range bad {
+		if _, err := ParseExif(data); err == nil {
+			t.Fatal(name, "ParseExif -> expect error")
+		}
+	}
+
+	exif, err := ParseExif(segment)
+	if err != nil {
+		t.Fatal("ParseExif -> error", err.Error())
+	}
+	if _, err := exif.IFD0[TagMake].Int(0); err == nil {
+		t.Fatal("Int of ASCII -> expect error")
+	}
+	if _, err := exif.ExifIFD[TagISOSpeed].Int(1); err == nil {
+		t.Fatal("Int out of range -> expect error")
+	}
+	if _, err := (&Exif{}).FNumber(); err == nil {
+		t.Fatal("FNumber without tag -> expect error")
+	}
+	if val := (&Exif{}).Orientation(); val != 1 {
+		t.Fatal("Orientation without tag:", val, "Expect: 1")
+	}
+}
+
+func TestReadJPEGExif(t *testing.T) {
+	data, err := os.ReadFile("pics/Gray/GrayBaseline.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jpeg, err := ReadJPEG(toBufio(bytes.NewReader(withApp(data, APP1, testExifSegment(binary.LittleEndian)))))
+	if err != nil {
+		t.Fatal("ReadJPEG -> error", err.Error())
+	}
+	if jpeg.Exif == nil || jpeg.Exif.Model() != "EOS R5" {
+		t.Fatal("ReadJPEG -> expect EXIF of EOS R5")
+	}
+
+	//Поврежденные метаданные не мешают декодированию
+	broken := withApp(data, APP1, testExifSegment(binary.BigEndian)[:30])
+	jpeg, err = ReadJPEG(toBufio(bytes.NewReader(broken)))
+	if err != nil {
+		t.Fatal("ReadJPEG -> error", err.Error())
+	}
+	if jpeg.Exif != nil {
+		t.Fatal("ReadJPEG with broken EXIF -> expect nil Exif")
+	}
+	if _, err := Decode(bytes.NewReader(broken)); err != nil {
+		t.Fatal("Decode with broken EXIF -> error", err.Error())
+	}
+}
@@ -14,7 +14,7 @@ func printComponent(c component) {
 }
 
 // Вывод таблицы в лог
-func printTable(table []byte) {
+func printTable(table []uint16) {
 	res := "\n"
 	for i := range sizeOfTable {
 		if i%colCount == 0 && i != 0 {
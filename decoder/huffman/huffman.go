@@ -8,30 +8,36 @@ import (
 const NumHuffCodesLen = 16 //Количество длин кодов Хаффмана
 const maxNumHuffSym = 176  //Максимальное количество символов в таблице Хаффмана
 
+const lookupBits = 9 //Длина кода, декодируемого за один просмотр таблицы
+
 // Структура таблицы Хаффмана
 type HuffTable struct {
-	offset  []byte   // Количество символов по длине для вычисления кодов
-	symbols []byte   // Символы в таблице
-	codes   []uint16 //Коды для символов
+	offset  []byte                  // Количество символов по длине для вычисления кодов
+	symbols []byte                  // Символы в таблице
+	codes   []uint16                //Коды для символов
+	lookup  [1 << lookupBits]uint16 //Длина кода и символ по первым lookupBits битам, 0 - длинный код
 }
 
 // Декодирование из битового потока значений Хаффмана с помощью binReader
+// Коды до lookupBits бит находятся по таблице, более длинные - по первым кодам каждой длины
 func (h *HuffTable) DecodeHuff(reader *binreader.BinReader) (uint16, error) {
-	var code uint16
-	codeLen := 0
-	for {
-		code = code << 1
-		code += uint16(reader.GetBit())
-		codeLen++
-		if codeLen > 16 {
-			return 0, errors.New("Huffman bit-reading error: can't find a symbol")
+	if val := h.lookup[reader.PeekBits(lookupBits)]; val != 0 {
+		reader.SkipBits(byte(val >> 8))
+		return val & 0xFF, nil
+	}
+	bits := reader.PeekBits(NumHuffCodesLen)
+	for codeLen := lookupBits + 1; codeLen <= NumHuffCodesLen; codeLen++ {
+		first, last := h.offset[codeLen-1], h.offset[codeLen]
+		if first == last {
+			continue
 		}
-		for i := h.offset[codeLen-1]; i < h.offset[codeLen]; i++ {
-			if code == h.codes[i] {
-				return uint16(h.symbols[i]), nil
-			}
+		code := bits >> (NumHuffCodesLen - codeLen)
+		if code >= h.codes[first] && code <= h.codes[last-1] {
+			reader.SkipBits(byte(codeLen))
+			return uint16(h.symbols[first+byte(code-h.codes[first])]), nil
 		}
 	}
+	return 0, errors.New("Huffman bit-reading error: can't find a symbol")
 }
 
 // Восстановление кодов таблицы Хаффмана и конструирование объекта
@@ -43,10 +49,20 @@ func makeHuffTable(offset []byte, symbols []byte) (*HuffTable, error) {
 	ans.offset = offset
 	ans.symbols = symbols
 	ans.codes = make([]uint16, offset[NumHuffCodesLen])
-	var code uint16
+	var code uint32
 	for i := range NumHuffCodesLen {
 		for j := ans.offset[i]; j < ans.offset[i+1]; j++ {
-			ans.codes[j] = code
+			if code >= 1<<(i+1) {
+				return nil, errors.New("Huffman recovery error: invalid code lengths")
+			}
+			ans.codes[j] = uint16(code)
+			//Все продолжения короткого кода до lookupBits бит указывают на его символ
+			if i < lookupBits {
+				shift := lookupBits - 1 - i
+				for k := code << shift; k < (code+1)<<shift; k++ {
+					ans.lookup[k] = uint16(i+1)<<8 | uint16(symbols[j])
+				}
+			}
 			code++
 		}
 		code = code << 1
@@ -0,0 +1,141 @@
+package huffman
+
+import (
+	"bufio"
+	"bytes"
+	binreader "jpeg/decoder/binReader"
+	"math/rand"
+	"testing"
+)
+
+// Количество кодов по длинам стандартной таблицы AC яркости (K.3)
+var testCounts = [NumHuffCodesLen]byte{0, 2, 1, 3, 3, 2, 4, 3, 5, 5, 4, 4, 0, 0, 1, 0x7d}
+
+// Таблица с количеством кодов testCounts и символами по порядку
+func testTable(t testing.TB) *HuffTable {
+	t.Helper()
+	offset := make([]byte, NumHuffCodesLen+1)
+	for i, count := range testCounts {
+		offset[i+1] = offset[i] + count
+	}
+	symbols := make([]byte, offset[NumHuffCodesLen])
+	for i := range symbols {
+		symbols[i] = byte(i)
+	}
+	huff, err := makeHuffTable(offset, symbols)
+	if err != nil {
+		t.Fatal("makeHuffTable -> error", err.Error())
+	}
+	return huff
+}
+
+// Кодирование count случайных символов таблицы huff, короткие коды встречаются чаще
+// Возвращает символы и поток с байт-стаффингом, завершенный маркером EOI
+func testStream(huff *HuffTable, count int) ([]byte, []byte) {
+	lens := make([]byte, len(huff.symbols))
+	for i := range NumHuffCodesLen {
+		for j := huff.offset[i]; j < huff.offset[i+1]; j++ {
+			lens[j] = byte(i + 1)
+		}
+	}
+	rnd := rand.New(rand.NewSource(1))
+	var symbols, stream []byte
+	var acc uint32
+	var accLen byte
+	put := func(val byte) {
+		stream = append(stream, val)
+		if val == 0xFF {
+			stream = append(stream, 0x00)
+		}
+	}
+	for range count {
+		j := rnd.Intn(len(lens))
+		for rnd.Intn(int(lens[j])) > 2 {
+			j = rnd.Intn(len(lens))
+		}
+		symbols = append(symbols, huff.symbols[j])
+		acc = acc<<lens[j] | uint32(huff.codes[j])
+		accLen += lens[j]
+		for accLen >= 8 {
+			accLen -= 8
+			put(byte(acc >> accLen))
+		}
+	}
+	if accLen > 0 {
+		put(byte(acc<<(8-accLen)) | byte(1<<(8-accLen)-1))
+	}
+	return symbols, append(stream, 0xFF, 0xD9)
+}
+
+// Исходное декодирование: чтение по одному биту и перебор кодов каждой длины
+func decodeHuffBitwise(h *HuffTable, reader *binreader.BinReader) uint16 {
+	var code uint16
+	for codeLen := 1; codeLen <= NumHuffCodesLen; codeLen++ {
+		code = code<<1 | uint16(reader.GetBit())
+		for i := h.offset[codeLen-1]; i < h.offset[codeLen]; i++ {
+			if code == h.codes[i] {
+				return uint16(h.symbols[i])
+			}
+		}
+	}
+	return 0
+}
+
+// Создание BinReader для потока Хаффмана stream
+func streamReader(stream []byte) *binreader.BinReader {
+	reader := binreader.BinReaderInit(bufio.NewReader(bytes.NewReader(stream)))
+	reader.HuffStreamStart()
+	return reader
+}
+
+func TestDecodeHuff(t *testing.T) {
+	huff := testTable(t)
+	symbols, stream := testStream(huff, 10000)
+	reader := streamReader(stream)
+	for i, sym := range symbols {
+		res, err := huff.DecodeHuff(reader)
+		if err != nil {
+			t.Fatal("DecodeHuff -> error", err.Error())
+		}
+		if res != uint16(sym) {
+			t.Fatal("Symbol", i, "read:", res, "Expect:", sym)
+		}
+	}
+	//Поток Хаффмана не читается дальше маркера
+	reader.HuffStreamEnd()
+	if temp := reader.GetWord(); temp != 0xFFD9 {
+		t.Fatal("Read:", temp, "Expect:", 0xFFD9)
+	}
+}
+
+func TestDecodeHuffInvalidCode(t *testing.T) {
+	huff := testTable(t)
+	//Коды из одних единиц не используются
+	reader := streamReader([]byte{0xFF, 0x00, 0xFF, 0x00, 0xFF, 0xD9})
+	if _, err := huff.DecodeHuff(reader); err == nil {
+		t.Fatal("DecodeHuff of invalid code -> expect error")
+	}
+}
+
+func BenchmarkDecodeHuff(b *testing.B) {
+	huff := testTable(b)
+	symbols, stream := testStream(huff, 100000)
+	b.Run("Lookup", func(b *testing.B) {
+		b.SetBytes(int64(len(stream)))
+		for range b.N {
+			reader := streamReader(stream)
+			for range symbols {
+				huff.DecodeHuff(reader)
+			}
+		}
+	})
+	b.Run("Bitwise", func(b *testing.B) {
+		b.SetBytes(int64(len(stream)))
+		for range b.N {
+			reader := streamReader(stream)
+			for range symbols {
+				decodeHuffBitwise(huff, reader)
+			}
+		}
+	})
+}
@@ -0,0 +1,165 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+	binreader "jpeg/decoder/binReader"
+	"strings"
+	"unicode/utf16"
+)
+
+// Сборка профиля ICC из частей в сегментах APP2 и разбор его заголовка
+
+const (
+	iccHeader     = "ICC_PROFILE\x00"  //Начало данных сегмента APP2 с частью профиля
+	iccChunkStart = len(iccHeader) + 2 //Начало части профиля после номера части и количества частей
+	iccHeaderLen  = 128                //Длина заголовка профиля
+	iccTagLen     = 12                 //Длина записи таблицы тегов
+)
+
+// Профиль ICC, встроенный в изображение
+type ICCProfile struct {
+	Data            []byte //Профиль целиком
+	Version         string //Версия профиля, например 4.3.0
+	DeviceClass     string //Класс устройства: mntr, scnr, prtr, spac и т.д.
+	ColorSpace      string //Цветовое пространство данных: RGB, GRAY, CMYK и т.д.
+	PCS             string //Пространство связи профилей: XYZ или Lab
+	RenderingIntent uint32 //Цель цветопередачи: 0 - perceptual, 1 - relative, 2 - saturation, 3 - absolute
+	Description     string //Описание профиля из тега desc
+
+	tags map[string][]byte //Данные тегов по сигнатуре
+}
+
+// Проверка, что данные сегмента APP2 содержат часть профиля ICC
+func isICC(data []byte) bool {
+	return len(data) >= iccChunkStart && string(data[:len(iccHeader)]) == iccHeader
+}
+
+// Сборка профиля из частей в сегментах APP2 по их номерам
+// Возвращает nil без ошибки, если частей нет
+func assembleICC(apps []AppSegment) ([]byte, error) {
+	var chunks [][]byte
+	for _, app := range apps {
+		if app.Marker != APP2 || !isICC(app.Data) {
+			continue
+		}
+		seq, count := int(app.Data[len(iccHeader)]), int(app.Data[len(iccHeader)+1])
+		if chunks == nil {
+			if count == 0 {
+				return nil, errors.New("ICC reading error: zero chunk count")
+			}
+			chunks = make([][]byte, count)
+		}
+		if count != len(chunks) {
+			return nil, errors.New("ICC reading error: chunk count mismatch")
+		}
+		if seq < 1 || seq > count || chunks[seq-1] != nil {
+			return nil, errors.New("ICC reading error: invalid chunk number")
+		}
+		chunks[seq-1] = app.Data[iccChunkStart:]
+	}
+
+	var res []byte
+	for _, chunk := range chunks {
+		if chunk == nil {
+			return nil, errors.New("ICC reading error: missing chunk")
+		}
+		res = append(res, chunk...)
+	}
+	return res, nil
+}
+
+// Сигнатура из 4 символов без завершающих пробелов
+func iccSignature(data []byte) string {
+	return strings.TrimRight(string(data[:4]), " \x00")
+}
+
+// Разбор заголовка и таблицы тегов профиля data
+func ParseICC(data []byte) (*ICCProfile, error) {
+	if len(data) < iccHeaderLen+4 {
+		return nil, errors.New("ICC reading error: profile is too short")
+	}
+	reader := sliceReader(data, 0, binreader.BIG)
+	if size := reader.GetDWord(); int64(size) > int64(len(data)) || size < iccHeaderLen {
+		return nil, errors.New("ICC reading error: invalid profile size")
+	}
+	if string(data[36:40]) != "acsp" {
+		return nil, errors.New("ICC reading error: no acsp signature")
+	}
+
+	res := &ICCProfile{
+		Data:            data,
+		Version:         fmt.Sprintf("%d.%d.%d", data[8], data[9]>>4, data[9]&0xF),
+		DeviceClass:     iccSignature(data[12:]),
+		ColorSpace:      iccSignature(data[16:]),
+		PCS:             iccSignature(data[20:]),
+		RenderingIntent: sliceReader(data, 64, binreader.BIG).GetDWord(),
+	}
+
+	reader = sliceReader(data, iccHeaderLen, binreader.BIG)
+	count := int64(reader.GetDWord())
+	if iccHeaderLen+4+count*iccTagLen > int64(len(data)) {
+		return nil, errors.New("ICC reading error: tag table out of bounds")
+	}
+	res.tags = make(map[string][]byte, count)
+	for range count {
+		sig := string(reader.GetArray(4))
+		offset, size := int64(reader.GetDWord()), int64(reader.GetDWord())
+		if offset+size > int64(len(data)) {
+			return nil, errors.New("ICC reading error: tag " + sig + " out of bounds")
+		}
+		res.tags[sig] = data[offset : offset+size]
+	}
+
+	res.Description = iccText(res.tags["desc"])
+	return res, nil
+}
+
+// Данные тега с сигнатурой sig, nil - тега нет
+func (p *ICCProfile) Tag(sig string) []byte {
+	return p.tags[sig]
+}
+
+// Текст тега типа textDescriptionType (ICC v2) или multiLocalizedUnicodeType (ICC v4), для других типов пустая строка
+// Из локализованных строк берется английская, при ее отсутствии первая
+func iccText(tag []byte) string {
+	if len(tag) < 12 {
+		return ""
+	}
+	reader := sliceReader(tag, 8, binreader.BIG)
+	switch string(tag[:4]) {
+	case "desc":
+		n := int64(reader.GetDWord())
+		if 12+n > int64(len(tag)) {
+			return ""
+		}
+		return strings.TrimRight(string(tag[12:12+n]), "\x00")
+	case "mluc":
+		count, recordSize := int64(reader.GetDWord()), int64(reader.GetDWord())
+		if count == 0 || recordSize < 12 || 16+count*recordSize > int64(len(tag)) {
+			return ""
+		}
+		var text []byte
+		for i := range count {
+			record := sliceReader(tag, int(16+i*recordSize), binreader.BIG)
+			lang := string(record.GetArray(2))
+			record.GetArray(2) //Страна
+			n, offset := int64(record.GetDWord()), int64(record.GetDWord())
+			if offset+n > int64(len(tag)) {
+				return ""
+			}
+			if text == nil || lang == "en" {
+				text = tag[offset : offset+n]
+			}
+			if lang == "en" {
+				break
+			}
+		}
+		units := make([]uint16, len(text)/2)
+		for i := range units {
+			units[i] = uint16(text[2*i])<<8 | uint16(text[2*i+1])
+		}
+		return strings.TrimRight(string(utf16.Decode(units)), "\x00")
+	}
+	return ""
+}
@@ -0,0 +1,152 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+// Файл со встроенным профилем sRGB IEC61966-2.1 версии 2.1
+const iccPic = "pics/Progressive/AqoursProgressive.jpeg"
+
+// Профиль из iccPic
+func testICCProfile(t *testing.T) []byte {
+	t.Helper()
+	data, err := os.ReadFile(iccPic)
+	if err != nil {
+		t.Fatal(err)
+	}
+	jpeg, err := ReadJPEG(toBufio(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal("ReadJPEG -> error", err.Error())
+	}
+	if jpeg.ICC == nil {
+		t.Fatal(iccPic, "ReadJPEG -> expect ICC profile")
+	}
+	return jpeg.ICC.Data
+}
+
+// Сегмент APP2 с частью chunk под номером seq из count
+func testICCChunk(seq int, count int, chunk []byte) []byte {
+	return append([]byte{'I', 'C', 'C', '_', 'P', 'R', 'O', 'F', 'I', 'L', 'E', 0, byte(seq), byte(count)}, chunk...)
+}
+
+// Профиль ICC v4 с описанием в теге mluc на немецком и английском
+func testICCv4() []byte {
+	var mluc []byte
+	mluc = append(mluc, "mluc\x00\x00\x00\x00"...)
+	mluc = binary.BigEndian.AppendUint32(mluc, 2)
+	mluc = binary.BigEndian.AppendUint32(mluc, 12)
+	texts := [][]byte{{0, 'P', 0, 'r', 0, 'o', 0, 'f', 0, 'i', 0, 'l'}, {0, 'P', 0, 'r', 0, 'o', 0, 'f', 0, 'i', 0, 'l', 0, 'e'}}
+	offset := 16 + 2*12
+	for i, lang := range []string{"dede", "enUS"} {
+		mluc = append(mluc, lang...)
+		mluc = binary.BigEndian.AppendUint32(mluc, uint32(len(texts[i])))
+		mluc = binary.BigEndian.AppendUint32(mluc, uint32(offset))
+		offset += len(texts[i])
+	}
+	mluc = append(append(mluc, texts[0]...), texts[1]...)
+
+	res := make([]byte, iccHeaderLen)
+	res[8], res[9] = 4, 0x30
+	copy(res[12:], "scnrGRAYLab acsp")
+	copy(res[36:], "acsp")
+	binary.BigEndian.PutUint32(res[64:], 1)
+	res = binary.BigEndian.AppendUint32(res, 1)
+	res = append(res, "desc"...)
+	res = binary.BigEndian.AppendUint32(res, iccHeaderLen+4+iccTagLen)
+	res = binary.BigEndian.AppendUint32(res, uint32(len(mluc)))
+	res = append(res, mluc...)
+	binary.BigEndian.PutUint32(res, uint32(len(res)))
+	return res
+}
+
+func TestReadJPEGICC(t *testing.T) {
+	profile, err := ParseICC(testICCProfile(t))
+	if err != nil {
+		t.Fatal("ParseICC -> error", err.Error())
+	}
+	if len(profile.Data) != 3144 || profile.Version != "2.1.0" || profile.DeviceClass != "mntr" || profile.ColorSpace != "RGB" ||
+		profile.PCS != "XYZ" || profile.RenderingIntent != 0 || profile.Description != "sRGB IEC61966-2.1" {
+		t.Fatal("Read:", len(profile.Data), profile.Version, profile.DeviceClass, profile.ColorSpace, profile.PCS,
+			profile.RenderingIntent, profile.Description)
+	}
+	if tag := profile.Tag("rTRC"); len(tag) != 2060 || string(tag[:4]) != "curv" {
+		t.Fatal("Tag rTRC:", len(tag))
+	}
+	if profile.Tag("A2B0") != nil {
+		t.Fatal("Tag A2B0 -> expect nil")
+	}
+
+	profile, err = ParseICC(testICCv4())
+	if err != nil {
+		t.Fatal("ParseICC v4 -> error", err.Error())
+	}
+	if profile.Version != "4.3.0" || profile.DeviceClass != "scnr" || profile.ColorSpace != "GRAY" || profile.PCS != "Lab" ||
+		profile.RenderingIntent != 1 || profile.Description != "Profile" {
+		t.Fatal("Read v4:", profile.Version, profile.DeviceClass, profile.ColorSpace, profile.PCS, profile.RenderingIntent, profile.Description)
+	}
+}
+
+func TestAssembleICC(t *testing.T) {
+	profile := testICCProfile(t)
+	data, err := os.ReadFile("pics/Gray/GrayBaseline.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	parts := [][]byte{profile[:1000], profile[1000:2000], profile[2000:]}
+
+	//Части собираются по номерам независимо от порядка сегментов
+	chunked := withApp(data, APP2, testICCChunk(3, 3, parts[2]), testICCChunk(1, 3, parts[0]), testICCChunk(2, 3, parts[1]))
+	jpeg, err := ReadJPEG(toBufio(bytes.NewReader(chunked)))
+	if err != nil {
+		t.Fatal("ReadJPEG -> error", err.Error())
+	}
+	if jpeg.ICC == nil || !bytes.Equal(jpeg.ICC.Data, profile) {
+		t.Fatal("ReadJPEG -> expect assembled profile")
+	}
+
+	bad := map[string][][]byte{
+		"missing":   {testICCChunk(1, 3, parts[0]), testICCChunk(3, 3, parts[2])},
+		"duplicate": {testICCChunk(1, 2, parts[0]), testICCChunk(1, 2, parts[1])},
+		"count":     {testICCChunk(1, 2, parts[0]), testICCChunk(2, 3, parts[1])},
+		"zero seq":  {testICCChunk(0, 1, profile)},
+		"zero":      {testICCChunk(0, 0, profile)},
+	}
+	for name, apps := range bad {
+		broken := withApp(data, APP2, apps...)
+		jpeg, err := ReadJPEG(toBufio(bytes.NewReader(broken)))
+		if err != nil {
+			t.Fatal(name, "ReadJPEG -> error", err.Error())
+		}
+		if jpeg.ICC != nil {
+			t.Fatal(name, "ReadJPEG -> expect nil ICC")
+		}
+		//Поврежденный профиль не мешает декодированию
+		if _, err := Decode(bytes.NewReader(broken)); err != nil {
+			t.Fatal(name, "Decode -> error", err.Error())
+		}
+	}
+}
+
+func TestParseICCErrors(t *testing.T) {
+	profile := testICCProfile(t)
+	noSignature := append([]byte{}, profile...)
+	copy(noSignature[36:], "xxxx")
+	tagOutOfBounds := testICCv4()
+	binary.BigEndian.PutUint32(tagOutOfBounds[iccHeaderLen+8:], 1<<20)
+
+	bad := map[string][]byte{
+		"short":        profile[:100],
+		"size":         profile[:len(profile)-1],
+		"signature":    noSignature,
+		"tag table":    profile[:iccHeaderLen+20],
+		"tag position": tagOutOfBounds,
+	}
+	for name, data := range bad {
+		if _, err := ParseICC(data); err == nil {
+			t.Fatal(name, "ParseICC -> expect error")
+		}
+	}
+}
@@ -0,0 +1,272 @@
+package decoder
+
+// Целочисленное обратное ДКП (порты jidctint.c и jidctfst.c из libjpeg)
+
+// Метод обратного ДКП
+type DCTMethod byte
+
+const (
+	DCTFloat   DCTMethod = iota //Исходное ОДКП в плавающей точке по определению, по умолчанию
+	DCTIntSlow                  //Точное целочисленное ОДКП (libjpeg islow)
+	DCTIntFast                  //Быстрое целочисленное ОДКП AAN с меньшей точностью (libjpeg ifast)
+)
+
+// Блок отсчетов после ОДКП, сдвинутых на половину диапазона
+type idctBlock = [unitRowCount][unitColCount]float32
+
+// Деквантование блока unit в порядке зиг-зага с переводом в построчный порядок
+func dequantNatural(unit []int16, quantTable []uint16) [unitRowCount * unitColCount]int {
+	var res [unitRowCount * unitColCount]int
+	for i := range unitRowCount {
+		for j := range unitColCount {
+			k := zigZagTable[i][j]
+			res[i*unitColCount+j] = int(unit[k]) * int(quantTable[k])
+		}
+	}
+	return res
+}
+
+// Сдвиг вправо на n бит с округлением
+func descale(val int, n uint) int {
+	return (val + 1<<(n-1)) >> n
+}
+
+// Параметры islow: точность констант и дополнительные биты промежуточного результата
+const (
+	islowConstBits = 13
+	islowPass1Bits = 2
+)
+
+// Константы islow: FIX(x) = x * 2^13
+const (
+	fix0298631336 = 2446
+	fix0390180644 = 3196
+	fix0541196100 = 4433
+	fix0765366865 = 6270
+	fix0899976223 = 7373
+	fix1175875602 = 9633
+	fix1501321110 = 12299
+	fix1847759065 = 15137
+	fix1961570560 = 16069
+	fix2053119869 = 16819
+	fix2562915447 = 20995
+	fix3072711026 = 25172
+)
+
+// Одномерное ОДКП islow над 8 значениями data с шагом step
+// Результат масштабирован на 2^islowConstBits и делится на 2^shift с округлением
+func islow1D(data []int, step int, shift uint) {
+	//Четная часть
+	z2, z3 := data[2*step], data[6*step]
+	z1 := (z2 + z3) * fix0541196100
+	tmp2 := z1 - z3*fix1847759065
+	tmp3 := z1 + z2*fix0765366865
+
+	z2, z3 = data[0], data[4*step]
+	tmp0 := (z2 + z3) << islowConstBits
+	tmp1 := (z2 - z3) << islowConstBits
+
+	tmp10, tmp13 := tmp0+tmp3, tmp0-tmp3
+	tmp11, tmp12 := tmp1+tmp2, tmp1-tmp2
+
+	//Нечетная часть
+	tmp0, tmp1, tmp2, tmp3 = data[7*step], data[5*step], data[3*step], data[step]
+	z1, z2, z3 = tmp0+tmp3, tmp1+tmp2, tmp0+tmp2
+	z4 := tmp1 + tmp3
+	z5 := (z3 + z4) * fix1175875602
+
+	tmp0 *= fix0298631336
+	tmp1 *= fix2053119869
+	tmp2 *= fix3072711026
+	tmp3 *= fix1501321110
+	z1 *= -fix0899976223
+	z2 *= -fix2562915447
+	z3 = z3*-fix1961570560 + z5
+	z4 = z4*-fix0390180644 + z5
+
+	tmp0 += z1 + z3
+	tmp1 += z2 + z4
+	tmp2 += z2 + z3
+	tmp3 += z1 + z4
+
+	data[0] = descale(tmp10+tmp3, shift)
+	data[7*step] = descale(tmp10-tmp3, shift)
+	data[step] = descale(tmp11+tmp2, shift)
+	data[6*step] = descale(tmp11-tmp2, shift)
+	data[2*step] = descale(tmp12+tmp1, shift)
+	data[5*step] = descale(tmp12-tmp1, shift)
+	data[3*step] = descale(tmp13+tmp0, shift)
+	data[4*step] = descale(tmp13-tmp0, shift)
+}
+
+// Проверка, что все значения data с шагом step, кроме первого, нулевые
+func onlyDC(data []int, step int) bool {
+	for k := 1; k < unitRowCount; k++ {
+		if data[k*step] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Точное целочисленное ОДКП деквантованного блока в построчном порядке
+func idctIntSlow(coefs *[unitRowCount * unitColCount]int, res *idctBlock) {
+	//Столбцы, результат масштабирован на 2^islowPass1Bits
+	for col := range unitColCount {
+		column := coefs[col:]
+		if onlyDC(column, unitColCount) {
+			dc := column[0] << islowPass1Bits
+			for k := range unitRowCount {
+				column[k*unitColCount] = dc
+			}
+			continue
+		}
+		islow1D(column, unitColCount, islowConstBits-islowPass1Bits)
+	}
+	//Строки с удалением масштаба и деления на 8
+	for row := range unitRowCount {
+		line := coefs[row*unitColCount : (row+1)*unitColCount]
+		if onlyDC(line, 1) {
+			val := float32(descale(line[0], islowPass1Bits+3))
+			for col := range unitColCount {
+				res[row][col] = val
+			}
+			continue
+		}
+		islow1D(line, 1, islowConstBits+islowPass1Bits+3)
+		for col, val := range line {
+			res[row][col] = float32(val)
+		}
+	}
+}
+
+// Параметры ifast: точность констант и дополнительные биты промежуточного результата
+const (
+	ifastConstBits = 8
+	ifastPass1Bits = 2
+	aanScaleBits   = 14
+)
+
+// Константы ifast: FIX(x) = x * 2^8
+const (
+	ifastFix1082392200 = 277
+	ifastFix1414213562 = 362
+	ifastFix1847759065 = 473
+	ifastFix2613125930 = 669
+)
+
+// Масштабные множители AAN в построчном порядке: 2^14 * c(u) * c(v), c(0) = 1, c(k) = cos(k*pi/16) * sqrt(2)
+var aanScales = [unitRowCount * unitColCount]int{
+	16384, 22725, 21407, 19266, 16384, 12873, 8867, 4520,
+	22725, 31521, 29692, 26722, 22725, 17855, 12299, 6270,
+	21407, 29692, 27969, 25172, 21407, 16819, 11585, 5906,
+	19266, 26722, 25172, 22654, 19266, 15137, 10426, 5315,
+	16384, 22725, 21407, 19266, 16384, 12873, 8867, 4520,
+	12873, 17855, 16819, 15137, 12873, 10114, 6967, 3552,
+	8867, 12299, 11585, 10426, 8867, 6967, 4799, 2446,
+	4520, 6270, 5906, 5315, 4520, 3552, 2446, 1247,
+}
+
+// Умножение на константу ifast
+func ifastMul(val int, fix int) int {
+	return descale(val*fix, ifastConstBits)
+}
+
+// Одномерное ОДКП AAN над 8 значениями data с шагом step
+func ifast1D(data []int, step int) {
+	//Четная часть
+	tmp0, tmp1, tmp2, tmp3 := data[0], data[2*step], data[4*step], data[6*step]
+	tmp10, tmp11 := tmp0+tmp2, tmp0-tmp2
+	tmp13 := tmp1 + tmp3
+	tmp12 := ifastMul(tmp1-tmp3, ifastFix1414213562) - tmp13
+
+	tmp0, tmp3 = tmp10+tmp13, tmp10-tmp13
+	tmp1, tmp2 = tmp11+tmp12, tmp11-tmp12
+
+	//Нечетная часть
+	tmp4, tmp5, tmp6, tmp7 := data[step], data[3*step], data[5*step], data[7*step]
+	z13, z10 := tmp6+tmp5, tmp6-tmp5
+	z11, z12 := tmp4+tmp7, tmp4-tmp7
+
+	tmp7 = z11 + z13
+	tmp11 = ifastMul(z11-z13, ifastFix1414213562)
+	z5 := ifastMul(z10+z12, ifastFix1847759065)
+	tmp10 = ifastMul(z12, ifastFix1082392200) - z5
+	tmp12 = ifastMul(z10, -ifastFix2613125930) + z5
+
+	tmp6 = tmp12 - tmp7
+	tmp5 = tmp11 - tmp6
+	tmp4 = tmp10 + tmp5
+
+	data[0] = tmp0 + tmp7
+	data[7*step] = tmp0 - tmp7
+	data[step] = tmp1 + tmp6
+	data[6*step] = tmp1 - tmp6
+	data[2*step] = tmp2 + tmp5
+	data[5*step] = tmp2 - tmp5
+	data[4*step] = tmp3 + tmp4
+	data[3*step] = tmp3 - tmp4
+}
+
+// Быстрое целочисленное ОДКП AAN деквантованного блока в построчном порядке
+func idctIntFast(coefs *[unitRowCount * unitColCount]int, res *idctBlock) {
+	//Масштабирование AAN с сохранением ifastPass1Bits дополнительных бит
+	for k := range coefs {
+		coefs[k] = descale(coefs[k]*aanScales[k], aanScaleBits-ifastPass1Bits)
+	}
+	for col := range unitColCount {
+		column := coefs[col:]
+		if onlyDC(column, unitColCount) {
+			for k := range unitRowCount {
+				column[k*unitColCount] = column[0]
+			}
+			continue
+		}
+		ifast1D(column, unitColCount)
+	}
+	for row := range unitRowCount {
+		line := coefs[row*unitColCount : (row+1)*unitColCount]
+		ifast1D(line, 1)
+		for col, val := range line {
+			res[row][col] = float32(descale(val, ifastPass1Bits+3))
+		}
+	}
+}
+
+// ОДКП в плавающей точке по определению для деквантованных коэффициентов coefs в построчном порядке
+// Нулевые коэффициенты пропускаются: сумма по остальным в том же порядке совпадает побитово
+func idctFloat(coefs *[unitRowCount * unitColCount]int, res *idctBlock) {
+	var nonZero [unitRowCount * unitColCount]byte //Позиции ненулевых коэффициентов по возрастанию
+	count := 0
+	for k, coef := range coefs {
+		if coef != 0 {
+			nonZero[count] = byte(k)
+			count++
+		}
+	}
+	for x := range unitRowCount {
+		for y := range unitColCount {
+			sum := 0.0
+			for _, k := range nonZero[:count] {
+				u, v := k/unitColCount, k%unitColCount
+				sum += float64(coefs[k]) * idctTable[u][x] * idctTable[v][y]
+			}
+			res[x][y] = float32(0.25 * sum)
+		}
+	}
+}
+
+// ОДКП блока unit в порядке зиг-зага с таблицей квантования quantTable методом method
+func inverseDCT(unit []int16, quantTable []uint16, method DCTMethod, res *idctBlock) {
+	switch method {
+	case DCTIntSlow:
+		coefs := dequantNatural(unit, quantTable)
+		idctIntSlow(&coefs, res)
+	case DCTIntFast:
+		coefs := dequantNatural(unit, quantTable)
+		idctIntFast(&coefs, res)
+	default:
+		coefs := dequantNatural(unit, quantTable)
+		idctFloat(&coefs, res)
+	}
+}
@@ -0,0 +1,220 @@
+package decoder
+
+import (
+	"bytes"
+	"math"
+	"math/rand"
+	"os"
+	"testing"
+)
+
+// Статистика ошибок ОДКП по методике IEEE 1180-1990
+type idctErrors struct {
+	peak     int                                 //Максимальная ошибка
+	sum      [unitRowCount][unitColCount]float64 //Сумма ошибок по позициям
+	sqSum    [unitRowCount][unitColCount]float64 //Сумма квадратов ошибок по позициям
+	numOfRun int                                 //Количество блоков
+}
+
+// Ограничение val диапазоном [low, high]
+func clip(val int, low int, high int) int {
+	return min(max(val, low), high)
+}
+
+// Прямое ДКП блока в плавающей точке с округлением коэффициентов
+func referenceFDCT(block *[unitRowCount][unitColCount]int) []int16 {
+	res := make([]int16, unitRowCount*unitColCount)
+	for u := range unitRowCount {
+		for v := range unitColCount {
+			sum := 0.0
+			for x := range unitRowCount {
+				for y := range unitColCount {
+					sum += float64(block[x][y]) * idctTable[u][x] * idctTable[v][y]
+				}
+			}
+			res[zigZagTable[u][v]] = int16(clip(int(math.Round(0.25*sum)), -2048, 2047))
+		}
+	}
+	return res
+}
+
+// Накопление ошибок метода method на случайных блоках из диапазона [-low, high] со знаком sign
+func (e *idctErrors) run(rnd *rand.Rand, method DCTMethod, low int, high int, sign int) {
+	quant := make([]uint16, unitRowCount*unitColCount)
+	for i := range quant {
+		quant[i] = 1
+	}
+	for range 10000 {
+		var block [unitRowCount][unitColCount]int
+		for x := range unitRowCount {
+			for y := range unitColCount {
+				block[x][y] = sign * (rnd.Intn(low+high+1) - low)
+			}
+		}
+		unit := referenceFDCT(&block)
+
+		var want, got idctBlock
+		inverseDCT(unit, quant, DCTFloat, &want)
+		inverseDCT(unit, quant, method, &got)
+		for x := range unitRowCount {
+			for y := range unitColCount {
+				ref := clip(int(math.Round(float64(want[x][y]))), -256, 255)
+				diff := clip(int(got[x][y]), -256, 255) - ref
+				e.peak = max(e.peak, diff, -diff)
+				e.sum[x][y] += float64(diff)
+				e.sqSum[x][y] += float64(diff * diff)
+			}
+		}
+		e.numOfRun++
+	}
+}
+
+// Проверка ошибок по границам: максимальная ошибка, СКО по позиции и в целом, средняя ошибка по позиции и в целом
+func (e *idctErrors) check(t *testing.T, name string, peak int, pixelMSE float64, overallMSE float64, pixelME float64, overallME float64) {
+	t.Helper()
+	var sum, sqSum float64
+	for x := range unitRowCount {
+		for y := range unitColCount {
+			if mse := e.sqSum[x][y] / float64(e.numOfRun); mse > pixelMSE {
+				t.Fatalf("%s: MSE %f at (%d, %d)", name, mse, x, y)
+			}
+			if me := e.sum[x][y] / float64(e.numOfRun); math.Abs(me) > pixelME {
+				t.Fatalf("%s: mean error %f at (%d, %d)", name, me, x, y)
+			}
+			sum += e.sum[x][y]
+			sqSum += e.sqSum[x][y]
+		}
+	}
+	count := float64(e.numOfRun * unitRowCount * unitColCount)
+	if e.peak > peak || sqSum/count > overallMSE || math.Abs(sum/count) > overallME {
+		t.Fatalf("%s: peak %d, MSE %f, mean error %f", name, e.peak, sqSum/count, sum/count)
+	}
+}
+
+func TestIDCTAccuracy(t *testing.T) {
+	ranges := [][2]int{{256, 255}, {5, 5}, {300, 300}}
+	for _, r := range ranges {
+		for _, sign := range []int{1, -1} {
+			rnd := rand.New(rand.NewSource(1))
+			var slow, fast idctErrors
+			slow.run(rnd, DCTIntSlow, r[0], r[1], sign)
+			rnd = rand.New(rand.NewSource(1))
+			fast.run(rnd, DCTIntFast, r[0], r[1], sign)
+			//islow укладывается в границы IEEE 1180-1990
+			slow.check(t, "islow", 1, 0.06, 0.02, 0.015, 0.0015)
+			//ifast, как и в libjpeg, стандарту не соответствует: границы расширены и лишь ловят ухудшение точности
+			fast.check(t, "ifast (widened bounds)", 2, 0.3, 0.15, 0.03, 0.015)
+		}
+	}
+}
+
+func TestDecodeDCTMethods(t *testing.T) {
+	data, err := os.ReadFile(testPics[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := decodeStd(t, data)
+	for _, method := range []DCTMethod{DCTIntSlow, DCTIntFast, DCTFloat} {
+		img, err := DecodeWithOptions(bytes.NewReader(data), &Options{DCTMethod: method})
+		if err != nil {
+			t.Fatal("DecodeWithOptions -> error", err.Error())
+		}
+		compareImages(t, testPics[1], img, want, 16, 1)
+	}
+
+	//Без параметров используется ОДКП в плавающей точке, как до появления целочисленных методов
+	plain, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("Decode -> error", err.Error())
+	}
+	float, err := DecodeWithOptions(bytes.NewReader(data), &Options{DCTMethod: DCTFloat})
+	if err != nil {
+		t.Fatal("DecodeWithOptions -> error", err.Error())
+	}
+	compareImages(t, "default DCT method", plain, float, 0, 0)
+
+	if _, err := DecodeWithOptions(bytes.NewReader(data), &Options{DCTMethod: DCTIntFast + 1}); err == nil {
+		t.Fatal("DecodeWithOptions with unknown DCT method -> expect error")
+	}
+}
+
+func TestInverseDCTAllocs(t *testing.T) {
+	unit := benchmarkUnits(1)[0]
+	quant := make([]uint16, unitRowCount*unitColCount)
+	for i := range quant {
+		quant[i] = uint16(i/4 + 2)
+	}
+	var res idctBlock
+	for _, method := range []DCTMethod{DCTFloat, DCTIntSlow, DCTIntFast} {
+		if allocs := testing.AllocsPerRun(10, func() { inverseDCT(unit, quant, method, &res) }); allocs != 0 {
+			t.Fatal("inverseDCT method", method, "allocs:", allocs, "Expect: 0")
+		}
+	}
+}
+
+func TestMCUInverseCosin(t *testing.T) {
+	quant := make([]byte, unitRowCount*unitColCount)
+	quant16 := make([]uint16, len(quant))
+	for i := range quant {
+		quant[i] = byte(i/4 + 2)
+		quant16[i] = uint16(quant[i])
+	}
+	for _, coefs := range benchmarkUnits(16) {
+		var want idctBlock
+		inverseDCT(coefs, quant16, DCTFloat, &want)
+
+		//Деквантование на месте и ОДКП канала, как в исходном API MCU
+		unit := MakeMCU()
+		copy(unit.Cb, coefs)
+		unit.Dequant(quant, Cb)
+		for i := range coefs {
+			if unit.Cb[i] != coefs[i]*int16(quant[i]) {
+				t.Fatal("Dequant:", unit.Cb[i], "Expect:", coefs[i]*int16(quant[i]))
+			}
+		}
+		got := unit.InverseCosin(Cb)
+		for i := range want {
+			for j := range want[i] {
+				if math.Abs(float64(got[i][j]-want[i][j])) > 1e-3 {
+					t.Fatal("InverseCosin:", got[i][j], "Expect:", want[i][j])
+				}
+			}
+		}
+	}
+	unit := MakeMCU()
+	if unit.InverseCosin(K) != nil {
+		t.Fatal("InverseCosin of missing channel -> expect nil")
+	}
+}
+
+// Случайные блоки коэффициентов, типичные для фотографий: большие низкие частоты и редкие высокие
+func benchmarkUnits(count int) [][]int16 {
+	rnd := rand.New(rand.NewSource(1))
+	res := make([][]int16, count)
+	for i := range res {
+		res[i] = make([]int16, unitRowCount*unitColCount)
+		for k := range res[i] {
+			if rnd.Intn(k+1) < 2 {
+				res[i][k] = int16(rnd.Intn(64) - 32)
+			}
+		}
+	}
+	return res
+}
+
+func BenchmarkInverseDCT(b *testing.B) {
+	units := benchmarkUnits(1024)
+	quant := make([]uint16, unitRowCount*unitColCount)
+	for i := range quant {
+		quant[i] = uint16(i/4 + 2)
+	}
+	names := map[DCTMethod]string{DCTIntSlow: "IntSlow", DCTIntFast: "IntFast", DCTFloat: "Float"}
+	for method, name := range names {
+		b.Run(name, func(b *testing.B) {
+			var res idctBlock
+			for i := range b.N {
+				inverseDCT(units[i%len(units)], quant, method, &res)
+			}
+		})
+	}
+}
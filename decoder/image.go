@@ -0,0 +1,266 @@
+package decoder
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"io"
+)
+
+// Регистрация декодера в пакете image для потоков, начинающихся с SOI
+func init() {
+	image.RegisterFormat("jpeg", "\xff\xd8", Decode, DecodeConfig)
+}
+
+// Приведение источника к *bufio.Reader без повторной буферизации
+func toBufio(r io.Reader) *bufio.Reader {
+	if br, ok := r.(*bufio.Reader); ok {
+		return br
+	}
+	return bufio.NewReader(r)
+}
+
+// Чтение всего изображения в оттенках серого
+func (jpeg *JPEG) readAllGray() (GrayImage, error) {
+	res := CreateGrayMatrix(jpeg.OutputSize())
+	_, err := jpeg.ReadGrayJPEG(res, 0)
+	return res, err
+}
+
+// Чтение всего изображения в CMYK
+func (jpeg *JPEG) readAllCMYK() (CMYKImage, error) {
+	res := CreateCMYKMatrix(jpeg.OutputSize())
+	_, err := jpeg.ReadCMYKJPEG(res, 0)
+	return res, err
+}
+
+// Чтение всего изображения в оттенках серого с 16 битами на отсчет
+func (jpeg *JPEG) readAllGray16() (Gray16Image, error) {
+	res := CreateGray16Matrix(jpeg.OutputSize())
+	_, err := jpeg.ReadGray16JPEG(res, 0)
+	return res, err
+}
+
+// Чтение всего изображения в RGB с 16 битами на отсчет
+func (jpeg *JPEG) readAll16() (Image16, error) {
+	res := CreateRGB16Matrix(jpeg.OutputSize())
+	_, err := jpeg.ReadJPEG16(res, 0)
+	return res, err
+}
+
+// Чтение всего изображения целиком
+func (jpeg *JPEG) readAll() (Image, error) {
+	res := CreateRGBMatrix(jpeg.OutputSize())
+
+	var err error
+	if jpeg.IsProgressive {
+		_, err = jpeg.ReadProgJPEG(res, 0)
+	} else {
+		_, err = jpeg.ReadBaseJPEG(res, 0)
+	}
+	return res, err
+}
+
+// Декодирование JPEG из r в image.Image
+// Для одной компоненты возвращается *image.Gray, для CMYK/YCCK *image.CMYK, иначе *image.RGBA
+// Для глубины больше 8 бит вместо *image.Gray и *image.RGBA возвращаются *image.Gray16 и *image.RGBA64
+// Lossless изображения возвращаются как *image.Gray16 или *image.RGBA64 без цветового преобразования
+func Decode(r io.Reader) (image.Image, error) {
+	return DecodeWithOptions(r, nil)
+}
+
+// Декодирование JPEG из r в image.Image с параметрами o, nil - параметры по умолчанию
+// Результат RGB и в оттенках серого переводится в sRGB по встроенному профилю ICC, если он поддерживается
+func DecodeWithOptions(r io.Reader, o *Options) (image.Image, error) {
+	jpeg, err := ReadJPEG(toBufio(r))
+	if err != nil {
+		return nil, err
+	}
+	if o != nil {
+		jpeg.Options = *o
+	}
+
+	orientation := jpeg.Orientation()
+	if jpeg.IsLossless {
+		if jpeg.Options.Scale != ScaleFull || !jpeg.Options.Crop.Empty() {
+			return nil, errors.New("Lossless image can't be decoded with scale or crop")
+		}
+		grid, err := jpeg.ReadLosslessJPEG()
+		if err != nil {
+			return nil, err
+		}
+		for c := range grid {
+			grid[c] = Orient(grid[c], orientation)
+		}
+		return jpeg.losslessImage(grid)
+	}
+
+	wide := jpeg.SamplePrecision > 8
+	switch {
+	case jpeg.transform == transformCMYK || jpeg.transform == transformYCCK:
+		res, err := jpeg.readAllCMYK()
+		if err != nil {
+			return nil, err
+		}
+		return ToCMYK(Orient(res, orientation)), nil
+	case jpeg.transform == transformGray && wide:
+		res, err := jpeg.readAllGray16()
+		if err != nil {
+			return nil, err
+		}
+		if t := jpeg.srgbTransform(true); t != nil {
+			t.ApplyGray16(res, jpeg.SamplePrecision)
+		}
+		return ToGray16(Orient(res, orientation), jpeg.SamplePrecision), nil
+	case jpeg.transform == transformGray:
+		res, err := jpeg.readAllGray()
+		if err != nil {
+			return nil, err
+		}
+		if t := jpeg.srgbTransform(true); t != nil {
+			t.ApplyGray(res)
+		}
+		return ToGray(Orient(res, orientation)), nil
+	case wide:
+		res, err := jpeg.readAll16()
+		if err != nil {
+			return nil, err
+		}
+		if t := jpeg.srgbTransform(false); t != nil {
+			t.Apply16(res, jpeg.SamplePrecision)
+		}
+		return ToRGBA64(Orient(res, orientation), jpeg.SamplePrecision), nil
+	}
+
+	res, err := jpeg.readAll()
+	if err != nil {
+		return nil, err
+	}
+	if t := jpeg.srgbTransform(false); t != nil {
+		t.Apply(res)
+	}
+	return ToRGBA(Orient(res, orientation)), nil
+}
+
+// Чтение размеров и цветовой модели без декодирования скана
+func DecodeConfig(r io.Reader) (image.Config, error) {
+	return DecodeConfigWithOptions(r, nil)
+}
+
+// Перевод отсчетов lossless изображения в *image.Gray16 или *image.RGBA64
+func (jpeg *JPEG) losslessImage(grid SampleGrid) (image.Image, error) {
+	if jpeg.numOfComps == 1 {
+		return ToGray16(grid[0], jpeg.SamplePrecision), nil
+	}
+	if jpeg.numOfComps != 3 || jpeg.maxH != 1 || jpeg.maxV != 1 {
+		return nil, errors.New("Lossless image: only 1 or 3 components without subsampling can be converted")
+	}
+
+	res := CreateRGB16Matrix(jpeg.OrientedSize())
+	for i := range res {
+		for j := range res[i] {
+			res[i][j] = Rgb16{R: grid[0][i][j], G: grid[1][i][j], B: grid[2][i][j]}
+		}
+	}
+	return ToRGBA64(res, jpeg.SamplePrecision), nil
+}
+
+// Перевод Image в *image.RGBA
+func ToRGBA(img Image) *image.RGBA {
+	height := len(img)
+	width := 0
+	if height != 0 {
+		width = len(img[0])
+	}
+
+	res := image.NewRGBA(image.Rect(0, 0, width, height))
+	for i := range height {
+		line := res.Pix[i*res.Stride:]
+		for j := range width {
+			line[4*j+0] = img[i][j].R
+			line[4*j+1] = img[i][j].G
+			line[4*j+2] = img[i][j].B
+			line[4*j+3] = 0xFF
+		}
+	}
+	return res
+}
+
+// Перевод GrayImage в *image.Gray
+func ToGray(img GrayImage) *image.Gray {
+	height := len(img)
+	width := 0
+	if height != 0 {
+		width = len(img[0])
+	}
+
+	res := image.NewGray(image.Rect(0, 0, width, height))
+	for i := range height {
+		copy(res.Pix[i*res.Stride:i*res.Stride+width], img[i])
+	}
+	return res
+}
+
+// Перевод CMYKImage в *image.CMYK
+func ToCMYK(img CMYKImage) *image.CMYK {
+	height := len(img)
+	width := 0
+	if height != 0 {
+		width = len(img[0])
+	}
+
+	res := image.NewCMYK(image.Rect(0, 0, width, height))
+	for i := range height {
+		line := res.Pix[i*res.Stride:]
+		for j := range width {
+			line[4*j+0] = img[i][j].C
+			line[4*j+1] = img[i][j].M
+			line[4*j+2] = img[i][j].Y
+			line[4*j+3] = img[i][j].K
+		}
+	}
+	return res
+}
+
+// Перевод Gray16Image глубины precision в *image.Gray16
+func ToGray16(img Gray16Image, precision byte) *image.Gray16 {
+	height := len(img)
+	width := 0
+	if height != 0 {
+		width = len(img[0])
+	}
+
+	s := newSampleRange(precision)
+	res := image.NewGray16(image.Rect(0, 0, width, height))
+	for i := range height {
+		line := res.Pix[i*res.Stride:]
+		for j := range width {
+			val := s.to16(img[i][j])
+			line[2*j+0] = byte(val >> 8)
+			line[2*j+1] = byte(val)
+		}
+	}
+	return res
+}
+
+// Перевод Image16 глубины precision в *image.RGBA64
+func ToRGBA64(img Image16, precision byte) *image.RGBA64 {
+	height := len(img)
+	width := 0
+	if height != 0 {
+		width = len(img[0])
+	}
+
+	s := newSampleRange(precision)
+	res := image.NewRGBA64(image.Rect(0, 0, width, height))
+	for i := range height {
+		line := res.Pix[i*res.Stride:]
+		for j := range width {
+			for k, val := range [4]uint16{s.to16(img[i][j].R), s.to16(img[i][j].G), s.to16(img[i][j].B), 0xFFFF} {
+				line[8*j+2*k+0] = byte(val >> 8)
+				line[8*j+2*k+1] = byte(val)
+			}
+		}
+	}
+	return res
+}
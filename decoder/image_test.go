@@ -0,0 +1,211 @@
+package decoder
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"image/color"
+	stdjpeg "image/jpeg"
+	"io"
+	"os"
+	"testing"
+)
+
+// Файлы, на которых проверяется декодирование
+var testPics = []string{
+	"pics/Baseline/Aika.jpg",
+	"pics/Baseline/Suwa.jpg",
+	"pics/Progressive/EikyuuStage.jpeg",
+	"pics/Progressive/AqoursProgressive.jpeg",
+}
+
+// Сравнение двух изображений по каналам RGB с допуском
+func compareImages(t *testing.T, name string, got image.Image, want image.Image, maxDiff int, meanDiff float64) {
+	t.Helper()
+	if got.Bounds() != want.Bounds() {
+		t.Fatalf("%s: bounds %v, expect %v", name, got.Bounds(), want.Bounds())
+	}
+
+	b := got.Bounds()
+	worst, sum := 0, 0
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r1, g1, b1, _ := got.At(x, y).RGBA()
+			r2, g2, b2, _ := want.At(x, y).RGBA()
+			for _, d := range [3]int{int(r1>>8) - int(r2>>8), int(g1>>8) - int(g2>>8), int(b1>>8) - int(b2>>8)} {
+				if d < 0 {
+					d = -d
+				}
+				sum += d
+				worst = max(worst, d)
+			}
+		}
+	}
+
+	mean := float64(sum) / float64(3*b.Dx()*b.Dy())
+	if worst > maxDiff || mean > meanDiff {
+		t.Fatalf("%s: max diff %d, mean diff %f", name, worst, mean)
+	}
+}
+
+// Декодирование эталонным декодером стандартной библиотеки
+func decodeStd(t *testing.T, data []byte) image.Image {
+	t.Helper()
+	res, err := stdjpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("image/jpeg.Decode -> error", err.Error())
+	}
+	return res
+}
+
+func TestDecode(t *testing.T) {
+	for _, name := range testPics {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		img, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(name, "Decode -> error", err.Error())
+		}
+		if _, ok := img.(*image.RGBA); !ok {
+			t.Fatalf("%s: got %T, expect *image.RGBA", name, img)
+		}
+		compareImages(t, name, img, decodeStd(t, data), 16, 1)
+	}
+}
+
+func TestDecodeConfig(t *testing.T) {
+	data, err := os.ReadFile(testPics[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	cfg, err := DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("DecodeConfig -> error", err.Error())
+	}
+	if cfg.Width != 1000 || cfg.Height != 1000 || cfg.ColorModel != color.RGBAModel {
+		t.Fatalf("Read: %dx%d %v", cfg.Width, cfg.Height, cfg.ColorModel)
+	}
+
+	if _, err := DecodeConfig(bytes.NewReader([]byte("not a jpeg"))); err == nil {
+		t.Fatal("DecodeConfig -> expect error")
+	}
+}
+
+func TestDecodeTruncated(t *testing.T) {
+	names := []string{"pics/Arithmetic/ProgressiveHuffman.jpg", "pics/Arithmetic/Sequential.jpg", "pics/Gray/GraySampled.jpg", testPics[1]}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		//Обрезка в заголовке, в данных сканов и перед EOI
+		for _, n := range []int{100, 1157, len(data) / 3, len(data) / 2, len(data) - 2} {
+			if _, err := Decode(bytes.NewReader(data[:n])); err != io.ErrUnexpectedEOF {
+				t.Fatal(name, "Decode of", n, "bytes -> error", err, "Expect:", io.ErrUnexpectedEOF)
+			}
+		}
+		if _, err := DecodeConfig(bytes.NewReader(data[:100])); err != io.ErrUnexpectedEOF {
+			t.Fatal(name, "DecodeConfig of 100 bytes -> error", err, "Expect:", io.ErrUnexpectedEOF)
+		}
+	}
+}
+
+func TestDecodeGray(t *testing.T) {
+	names := []string{
+		"pics/Gray/GrayBaseline.jpg",
+		"pics/Gray/GraySampled.jpg",
+		"pics/Gray/GrayProgressive.jpg",
+	}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		img, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(name, "Decode -> error", err.Error())
+		}
+		if _, ok := img.(*image.Gray); !ok {
+			t.Fatalf("%s: got %T, expect *image.Gray", name, img)
+		}
+		compareImages(t, name, img, decodeStd(t, data), 4, 0.5)
+	}
+}
+
+func TestDecodeOddProgressive(t *testing.T) {
+	name := "pics/Progressive/OddProgressive.jpeg"
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(name, "Decode -> error", err.Error())
+	}
+	compareImages(t, name, img, decodeStd(t, data), 16, 1)
+}
+
+func TestDecodeColorSpaces(t *testing.T) {
+	names := []string{
+		"pics/ColorSpace/Adobe.jpg",
+		"pics/ColorSpace/YCCK.jpg",
+		"pics/ColorSpace/YCCKProgressive.jpg",
+		"pics/ColorSpace/RGB.jpg",
+	}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		img, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(name, "Decode -> error", err.Error())
+		}
+		want := decodeStd(t, data)
+		if _, ok := want.(*image.CMYK); ok {
+			if _, ok := img.(*image.CMYK); !ok {
+				t.Fatalf("%s: got %T, expect *image.CMYK", name, img)
+			}
+		}
+		compareImages(t, name, img, want, 16, 1)
+	}
+}
+
+func TestDecodeInvertedCMYK(t *testing.T) {
+	read := func(name string) CMYKImage {
+		file, err := os.Open(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer file.Close()
+
+		jpeg, err := ReadJPEG(bufio.NewReader(file))
+		if err != nil {
+			t.Fatal(name, "ReadJPEG -> error", err.Error())
+		}
+		res := CreateCMYKMatrix(jpeg.ImageHeight, jpeg.ImageWidth)
+		if _, err := jpeg.ReadCMYKJPEG(res, 0); err != nil {
+			t.Fatal(name, "ReadCMYKJPEG -> error", err.Error())
+		}
+		return res
+	}
+
+	//Данные в файлах совпадают, отличается только наличие сегмента Adobe
+	adobe := read("pics/ColorSpace/Adobe.jpg")
+	plain := read("pics/ColorSpace/NoAdobe.jpg")
+	for i := range adobe {
+		for j := range adobe[i] {
+			a, p := adobe[i][j], plain[i][j]
+			if a.C != 255-p.C || a.M != 255-p.M || a.Y != 255-p.Y || a.K != 255-p.K {
+				t.Fatalf("(%d, %d): adobe %v, plain %v", i, j, a, p)
+			}
+		}
+	}
+}
@@ -0,0 +1,222 @@
+package decoder
+
+import (
+	"errors"
+	"fmt"
+)
+
+// Декодирование lossless JPEG (ITU T.81, приложение H)
+
+const maxPredictor = 7 //Количество предикторов lossless
+const maxDiffLen = 16  //Категория разности 32768, для которой не передаются дополнительные биты
+
+// Отсчеты lossless изображения по компонентам: [компонента][строка][столбец]
+type SampleGrid = [][][]uint16
+
+// Состояние предсказания компоненты в текущем скане
+type losslessComp struct {
+	plane    [][]uint16 //Плоскость отсчетов компоненты с учетом дополнения до MCU
+	firstRow int        //Строка, с которой начался скан или интервал перезапуска
+	firstCol int        //Столбец, с которого начался интервал перезапуска
+}
+
+// Создание плоскостей отсчетов с дополнением до целого количества MCU
+func (jpeg *JPEG) createPlanes() [][][]uint16 {
+	mcusH := (int(jpeg.ImageHeight) + int(jpeg.maxV) - 1) / int(jpeg.maxV)
+	mcusW := (int(jpeg.ImageWidth) + int(jpeg.maxH) - 1) / int(jpeg.maxH)
+
+	res := make([][][]uint16, jpeg.numOfComps)
+	for i := range jpeg.numOfComps {
+		height := mcusH * int(jpeg.comps[i].v)
+		width := mcusW * int(jpeg.comps[i].h)
+		res[i] = make([][]uint16, height)
+		for j := range height {
+			res[i][j] = make([]uint16, width)
+		}
+	}
+	return res
+}
+
+// Размеры компоненты comp без дополнения
+func (jpeg *JPEG) compSize(comp *component) (int, int) {
+	height := (int(jpeg.ImageHeight)*int(comp.v) + int(jpeg.maxV) - 1) / int(jpeg.maxV)
+	width := (int(jpeg.ImageWidth)*int(comp.h) + int(jpeg.maxH) - 1) / int(jpeg.maxH)
+	return height, width
+}
+
+// Вычисление предсказания Px для отсчета (row, col)
+func (jpeg *JPEG) predict(state *losslessComp, row int, col int) int {
+	plane := state.plane
+	switch {
+	case row == state.firstRow && col == state.firstCol:
+		return 1 << (jpeg.SamplePrecision - jpeg.saLow - 1)
+	case row == state.firstRow:
+		return int(plane[row][col-1])
+	case col == 0:
+		return int(plane[row-1][col])
+	}
+
+	ra := int(plane[row][col-1])
+	rb := int(plane[row-1][col])
+	rc := int(plane[row-1][col-1])
+	switch jpeg.startSpectral {
+	case 1:
+		return ra
+	case 2:
+		return rb
+	case 3:
+		return rc
+	case 4:
+		return ra + rb - rc
+	case 5:
+		return ra + (rb-rc)>>1
+	case 6:
+		return rb + (ra-rc)>>1
+	default:
+		return (ra + rb) >> 1
+	}
+}
+
+// Декодирование разности для отсчета компоненты i
+func (jpeg *JPEG) decodeDiff(i int) int {
+	size, err := jpeg.dcTables[jpeg.comps[i].dcTableID].DecodeHuff(jpeg.reader)
+	if err != nil {
+		jpeg.readError = err
+		return 0
+	}
+
+	switch {
+	case size == 0:
+		return 0
+	case size == maxDiffLen:
+		return 1 << 15
+	case size > maxDiffLen:
+		jpeg.readError = errors.New("Huffman bit-reading error: lossless difference is too long")
+		return 0
+	}
+	return int(decodeSign(int16(jpeg.reader.GetBits(byte(size))), byte(size)))
+}
+
+// Декодирование отсчета (row, col) компоненты i
+func (jpeg *JPEG) decodeSample(i int, state *losslessComp, row int, col int) {
+	diff := jpeg.decodeDiff(i)
+	state.plane[row][col] = uint16(jpeg.predict(state, row, col) + diff)
+}
+
+// Декодирование одного lossless скана в плоскости planes
+func (jpeg *JPEG) decodeLosslessScan(planes [][][]uint16) bool {
+	if jpeg.startSpectral < 1 || jpeg.startSpectral > maxPredictor {
+		jpeg.readError = fmt.Errorf("Segment reading error: invalid lossless predictor: %d", jpeg.startSpectral)
+		return false
+	}
+
+	jpeg.reader.HuffStreamStart()
+	defer jpeg.reader.HuffStreamEnd()
+
+	var used []int
+	states := make([]losslessComp, jpeg.numOfComps)
+	for i := range jpeg.numOfComps {
+		if jpeg.comps[i].used {
+			used = append(used, int(i))
+			states[i].plane = planes[i]
+		}
+	}
+
+	//Неинтерливный скан: MCU из одного отсчета, размеры по компоненте
+	var mcusH, mcusW int
+	if len(used) == 1 {
+		mcusH, mcusW = jpeg.compSize(&jpeg.comps[used[0]])
+	} else {
+		mcusH = (int(jpeg.ImageHeight) + int(jpeg.maxV) - 1) / int(jpeg.maxV)
+		mcusW = (int(jpeg.ImageWidth) + int(jpeg.maxH) - 1) / int(jpeg.maxH)
+	}
+
+	var mcuCount uint
+	for mcuRow := range mcusH {
+		for mcuCol := range mcusW {
+			for _, i := range used {
+				h, v := int(jpeg.comps[i].h), int(jpeg.comps[i].v)
+				if len(used) == 1 {
+					h, v = 1, 1
+				}
+				for curV := range v {
+					for curH := range h {
+						jpeg.decodeSample(i, &states[i], mcuRow*v+curV, mcuCol*h+curH)
+					}
+				}
+				if jpeg.readError != nil {
+					return false
+				}
+			}
+
+			mcuCount++
+			if jpeg.restartInterval != 0 && mcuCount%uint(jpeg.restartInterval) == 0 && mcuCount != uint(mcusH*mcusW) {
+				if !jpeg.makeRestart() {
+					return false
+				}
+				//После перезапуска предсказание начинается заново со следующего MCU
+				nextRow, nextCol := mcuRow, mcuCol+1
+				if nextCol == mcusW {
+					nextRow, nextCol = nextRow+1, 0
+				}
+				for _, i := range used {
+					h, v := int(jpeg.comps[i].h), int(jpeg.comps[i].v)
+					if len(used) == 1 {
+						h, v = 1, 1
+					}
+					states[i].firstRow, states[i].firstCol = nextRow*v, nextCol*h
+				}
+			}
+		}
+	}
+	return true
+}
+
+// Чтение всех сканов lossless изображения
+// Возвращает отсчеты каждой компоненты в ее собственном разрешении, сдвинутые на point transform
+func (jpeg *JPEG) ReadLosslessJPEG() (SampleGrid, error) {
+	if !jpeg.IsLossless {
+		return nil, errors.New("Image is not lossless JPEG")
+	}
+
+	planes := jpeg.createPlanes()
+	pointTransform := make([]byte, jpeg.numOfComps)
+	for !jpeg.wasEOI {
+		nextMarker := jpeg.readTables()
+		if nextMarker == EOI {
+			jpeg.wasEOI = true
+			break
+		} else if nextMarker != SOS {
+			jpeg.readError = errors.New("Scan reading error")
+			return nil, jpeg.err()
+		}
+
+		jpeg.readScanHeader()
+		if jpeg.readError != nil || !jpeg.decodeLosslessScan(planes) {
+			return nil, jpeg.err()
+		}
+		for i := range jpeg.numOfComps {
+			if jpeg.comps[i].used {
+				pointTransform[i] = jpeg.saLow
+			}
+		}
+
+		if jpeg.reader.GetNextByte() != 0xFF {
+			jpeg.reader.BitsAlign()
+		}
+	}
+
+	//Обрезка дополнения и восстановление младших бит, отброшенных point transform
+	res := make(SampleGrid, jpeg.numOfComps)
+	for i := range jpeg.numOfComps {
+		height, width := jpeg.compSize(&jpeg.comps[i])
+		res[i] = make([][]uint16, height)
+		for row := range height {
+			res[i][row] = planes[i][row][:width]
+			for col := range width {
+				res[i][row][col] <<= pointTransform[i]
+			}
+		}
+	}
+	return res, nil
+}
@@ -0,0 +1,185 @@
+package decoder
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"math/rand"
+	"testing"
+)
+
+// Предсказание по T.81 H.1.2.1 для отсчета с соседями ra (слева), rb (сверху), rc (сверху слева)
+func testPredict(predictor byte, ra int, rb int, rc int) int {
+	switch predictor {
+	case 1:
+		return ra
+	case 2:
+		return rb
+	case 3:
+		return rc
+	case 4:
+		return ra + rb - rc
+	case 5:
+		return ra + (rb-rc)>>1
+	case 6:
+		return rb + (ra-rc)>>1
+	default:
+		return (ra + rb) >> 1
+	}
+}
+
+// Сборка lossless изображения, все компоненты 1x1
+// scans - номера компонент для каждого скана, restart - интервал перезапуска в MCU (кратен ширине)
+func makeLosslessJPEG(planes [][][]uint16, precision byte, predictor byte, pt byte, restart int, scans [][]int) []byte {
+	height, width := len(planes[0]), len(planes[0][0])
+
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, 0xD8})
+	sof := []byte{precision, byte(height >> 8), byte(height), byte(width >> 8), byte(width), byte(len(planes))}
+	for c := range planes {
+		sof = append(sof, byte(c+1), 0x11, 0)
+	}
+	putSegment(&buf, SOF3, sof...)
+
+	//Категории 0-16 кодами длины 5
+	dht := []byte{0x00, 0, 0, 0, 0, 17, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	for i := range 17 {
+		dht = append(dht, byte(i))
+	}
+	putSegment(&buf, DHT, dht...)
+	if restart != 0 {
+		putSegment(&buf, DRI, byte(restart>>8), byte(restart))
+	}
+
+	for _, comps := range scans {
+		sos := []byte{byte(len(comps))}
+		for _, c := range comps {
+			sos = append(sos, byte(c+1), 0x00)
+		}
+		sos = append(sos, predictor, 0, pt)
+		putSegment(&buf, SOS, sos...)
+
+		var w testBitWriter
+		firstRow := 0
+		for row := range height {
+			if restart != 0 && row != 0 && row*width%restart == 0 {
+				w.flush()
+				w.buf.Write([]byte{0xFF, byte(RST0 + uint16(row*width/restart-1)%8)})
+				firstRow = row
+			}
+			for col := range width {
+				for _, c := range comps {
+					x := func(r int, cl int) int { return int(planes[c][r][cl] >> pt) }
+					var px int
+					switch {
+					case row == firstRow && col == 0:
+						px = 1 << (precision - pt - 1)
+					case row == firstRow:
+						px = x(row, col-1)
+					case col == 0:
+						px = x(row-1, col)
+					default:
+						px = testPredict(predictor, x(row, col-1), x(row-1, col), x(row-1, col-1))
+					}
+
+					diff := (x(row, col) - px) & 0xFFFF
+					if diff == 1<<15 {
+						w.putBits(maxDiffLen, 5)
+						continue
+					}
+					if diff > 1<<15 {
+						diff -= 1 << 16
+					}
+					w.putDiff(diff)
+				}
+			}
+		}
+		w.flush()
+		buf.Write(w.buf.Bytes())
+	}
+
+	buf.Write([]byte{0xFF, 0xD9})
+	return buf.Bytes()
+}
+
+// Случайные отсчеты глубины precision, кратные 1 << pt
+func randomPlanes(rnd *rand.Rand, comps int, height int, width int, precision byte, pt byte) [][][]uint16 {
+	res := make([][][]uint16, comps)
+	for c := range res {
+		res[c] = make([][]uint16, height)
+		for i := range height {
+			res[c][i] = make([]uint16, width)
+			for j := range width {
+				res[c][i][j] = uint16(rnd.Intn(1<<precision)) >> pt << pt
+			}
+		}
+	}
+	return res
+}
+
+// Чтение lossless изображения и сравнение с исходными отсчетами
+func checkLossless(t *testing.T, name string, data []byte, want [][][]uint16) {
+	t.Helper()
+	jpeg, err := ReadJPEG(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(name, "ReadJPEG -> error", err.Error())
+	}
+	if !jpeg.IsLossless {
+		t.Fatal(name, "IsLossless = false")
+	}
+
+	grid, err := jpeg.ReadLosslessJPEG()
+	if err != nil {
+		t.Fatal(name, "ReadLosslessJPEG -> error", err.Error())
+	}
+	for c := range want {
+		for i := range want[c] {
+			for j := range want[c][i] {
+				if grid[c][i][j] != want[c][i][j] {
+					t.Fatalf("%s: comp %d (%d, %d): Read: %d Expect: %d", name, c, i, j, grid[c][i][j], want[c][i][j])
+				}
+			}
+		}
+	}
+}
+
+func TestLosslessPredictors(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	for predictor := byte(1); predictor <= maxPredictor; predictor++ {
+		for _, precision := range []byte{2, 8, 16} {
+			planes := randomPlanes(rnd, 1, 13, 17, precision, 0)
+			data := makeLosslessJPEG(planes, precision, predictor, 0, 0, [][]int{{0}})
+			checkLossless(t, "gray", data, planes)
+		}
+	}
+}
+
+func TestLosslessPointTransformRestart(t *testing.T) {
+	rnd := rand.New(rand.NewSource(2))
+	planes := randomPlanes(rnd, 1, 20, 11, 12, 3)
+	data := makeLosslessJPEG(planes, 12, 6, 3, 2*11, [][]int{{0}})
+	checkLossless(t, "point transform", data, planes)
+}
+
+func TestLosslessColor(t *testing.T) {
+	rnd := rand.New(rand.NewSource(3))
+	planes := randomPlanes(rnd, 3, 9, 10, 8, 0)
+
+	interleaved := makeLosslessJPEG(planes, 8, 4, 0, 10, [][]int{{0, 1, 2}})
+	checkLossless(t, "interleaved", interleaved, planes)
+
+	separate := makeLosslessJPEG(planes, 8, 7, 0, 0, [][]int{{0}, {1}, {2}})
+	checkLossless(t, "non-interleaved", separate, planes)
+
+	img, err := Decode(bytes.NewReader(interleaved))
+	if err != nil {
+		t.Fatal("Decode -> error", err.Error())
+	}
+	rgba, ok := img.(*image.RGBA64)
+	if !ok {
+		t.Fatalf("got %T, expect *image.RGBA64", img)
+	}
+	if px := rgba.RGBA64At(3, 2); px.R>>8 != planes[0][2][3] || px.G>>8 != planes[1][2][3] || px.B>>8 != planes[2][2][3] {
+		t.Fatal("Read:", px, "Expect:", planes[0][2][3], planes[1][2][3], planes[2][2][3])
+	}
+}
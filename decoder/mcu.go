@@ -33,6 +33,7 @@ const (
 	Y  Channel = 0
 	Cb Channel = 1
 	Cr Channel = 2
+	K  Channel = 3 //Четвертая компонента CMYK/YCCK
 )
 
 // Структура для MCU
@@ -41,24 +42,56 @@ type MCU struct {
 	Y  []int16 //Коэффициент из потока
 	Cb []int16 //Коэффициент из потока
 	Cr []int16 //Коэффициент из потока
+	K  []int16 //Коэффициент из потока
 }
 
 // Конструткор MCU
 func MakeMCU() MCU {
+	return makeMCU(3)
+}
+
+// Конструктор MCU, память выделяется только под numOfComps компонент
+func makeMCU(numOfComps byte) MCU {
 	var res MCU
 	res.Y = make([]int16, unitRowCount*unitColCount)
-	res.Cb = make([]int16, unitRowCount*unitColCount)
-	res.Cr = make([]int16, unitRowCount*unitColCount)
+	if numOfComps > 1 {
+		res.Cb = make([]int16, unitRowCount*unitColCount)
+		res.Cr = make([]int16, unitRowCount*unitColCount)
+	}
+	if numOfComps > 3 {
+		res.K = make([]int16, unitRowCount*unitColCount)
+	}
 	return res
 }
 
+// Коэффициенты канала ch
+func (unit *MCU) channel(ch Channel) []int16 {
+	switch ch {
+	case Y:
+		return unit.Y
+	case Cb:
+		return unit.Cb
+	case Cr:
+		return unit.Cr
+	case K:
+		return unit.K
+	default:
+		return nil
+	}
+}
+
 // Сoздание пустой матрицы MCU
 func CreateMCUMatrix(MCUsHeight uint16, MCUsWidth uint16) [][]MCU {
+	return createMCUMatrix(MCUsHeight, MCUsWidth, 3)
+}
+
+// Создание пустой матрицы MCU с памятью под numOfComps компонент
+func createMCUMatrix(MCUsHeight uint16, MCUsWidth uint16, numOfComps byte) [][]MCU {
 	blocks := make([][]MCU, MCUsHeight)
 	for i := range MCUsHeight {
 		blocks[i] = make([]MCU, MCUsWidth)
 		for j := range MCUsWidth {
-			blocks[i][j] = MakeMCU()
+			blocks[i][j] = makeMCU(numOfComps)
 		}
 	}
 	return blocks
@@ -69,56 +102,26 @@ func (unit *MCU) Copy(dst *MCU) {
 	copy(dst.Y, unit.Y)
 	copy(dst.Cb, unit.Cb)
 	copy(dst.Cr, unit.Cr)
+	copy(dst.K, unit.K)
 }
 
 // Деквантование
 // Передается номер канала ch и таблица квантования для него
 func (unit *MCU) Dequant(quantTable []byte, ch Channel) {
-	switch ch {
-	case Y:
-		for i := range unit.Y {
-			unit.Y[i] = unit.Y[i] * int16(quantTable[i])
-		}
-	case Cb:
-		for i := range unit.Cb {
-			unit.Cb[i] = unit.Cb[i] * int16(quantTable[i])
-		}
-	case Cr:
-		for i := range unit.Cr {
-			unit.Cr[i] = unit.Cr[i] * int16(quantTable[i])
-		}
-	}
-}
-
-// Зиг-заг преобразование
-func zigZag(unit []int16) [][]int16 {
-	//Создание матрицы
-	res := make([][]int16, unitRowCount)
-	for i := range unitRowCount {
-		res[i] = make([]int16, unitColCount)
-		for j := range unitColCount {
-			res[i][j] = unit[zigZagTable[i][j]]
-		}
+	data := unit.channel(ch)
+	for i := range data {
+		data[i] = data[i] * int16(quantTable[i])
 	}
-	return res
 }
 
-// Обратное дискретно-косинусное преобразование
-func idctCalc(unit [][]int16) [][]float32 {
-	res := make([][]float32, unitRowCount)
-	for i := range unitRowCount {
-		res[i] = make([]float32, unitColCount)
-	}
-	for x := range unitRowCount {
-		for y := range unitColCount {
-			sum := 0.0
-			for u := range unitRowCount {
-				for v := range unitColCount {
-					sum += float64(unit[u][v]) * idctTable[u][x] * idctTable[v][y]
-				}
-			}
-			res[x][y] = float32(0.25 * sum)
-		}
+// Деквантование, коэффициенты блока не изменяются
+// Передается номер канала ch и таблица квантования для него
+// Результат 32-битный, так как для 12 бит произведение не помещается в int16
+func (unit *MCU) Dequant32(quantTable []uint16, ch Channel) []int32 {
+	data := unit.channel(ch)
+	res := make([]int32, len(data))
+	for i := range data {
+		res[i] = int32(data[i]) * int32(quantTable[i])
 	}
 	return res
 }
@@ -126,14 +129,21 @@ func idctCalc(unit [][]int16) [][]float32 {
 // Обратное дискретно-косинусное преобразование канала ch
 // Используя ее создается блок MCU, который обрабатывается до ргб и записывается в результат
 func (unit *MCU) InverseCosin(ch Channel) [][]float32 {
-	switch ch {
-	case Y:
-		return idctCalc(zigZag(unit.Y))
-	case Cb:
-		return idctCalc(zigZag(unit.Cb))
-	case Cr:
-		return idctCalc(zigZag(unit.Cr))
-	default:
+	data := unit.channel(ch)
+	if data == nil {
 		return nil
 	}
+	var coefs [unitRowCount * unitColCount]int
+	for i := range unitRowCount {
+		for j := range unitColCount {
+			coefs[i*unitColCount+j] = int(data[zigZagTable[i][j]])
+		}
+	}
+	var block idctBlock
+	idctFloat(&coefs, &block)
+	res := make([][]float32, unitRowCount)
+	for i := range block {
+		res[i] = append([]float32{}, block[i][:]...)
+	}
+	return res
 }
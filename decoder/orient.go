@@ -0,0 +1,97 @@
+package decoder
+
+import (
+	"image"
+	"io"
+)
+
+// Поворот и отражение результата по тегу Orientation из EXIF
+
+// Преобразование для значения Orientation: транспонирование, затем отражение координат исходного изображения
+type orientTransform struct {
+	transpose bool //Строки результата берутся из столбцов исходного изображения
+	flipX     bool //Отражение по горизонтали
+	flipY     bool //Отражение по вертикали
+}
+
+// Преобразования для значений Orientation 1-8
+var orientTransforms = [9]orientTransform{
+	1: {},
+	2: {flipX: true},
+	3: {flipX: true, flipY: true},
+	4: {flipY: true},
+	5: {transpose: true},
+	6: {transpose: true, flipY: true},
+	7: {transpose: true, flipX: true, flipY: true},
+	8: {transpose: true, flipX: true},
+}
+
+// Поворот и отражение изображения img для приведения к ориентации 1
+// orientation - значение тега Orientation (1-8), для остальных значений возвращается img
+func Orient[T any](img [][]T, orientation int) [][]T {
+	if orientation <= 1 || orientation >= len(orientTransforms) || len(img) == 0 {
+		return img
+	}
+	t := orientTransforms[orientation]
+
+	height, width := len(img), len(img[0])
+	resHeight, resWidth := height, width
+	if t.transpose {
+		resHeight, resWidth = width, height
+	}
+
+	res := make([][]T, resHeight)
+	for y := range res {
+		res[y] = make([]T, resWidth)
+		for x := range res[y] {
+			srcY, srcX := y, x
+			if t.transpose {
+				srcY, srcX = x, y
+			}
+			if t.flipY {
+				srcY = height - 1 - srcY
+			}
+			if t.flipX {
+				srcX = width - 1 - srcX
+			}
+			res[y][x] = img[srcY][srcX]
+		}
+	}
+	return res
+}
+
+// Значение Orientation, применяемое при декодировании: 1, если Options.AutoOrient не задан или нет EXIF
+func (jpeg *JPEG) Orientation() int {
+	if !jpeg.Options.AutoOrient || jpeg.Exif == nil {
+		return 1
+	}
+	return jpeg.Exif.Orientation()
+}
+
+// Размеры результата DecodeWithOptions: OutputSize после поворота по Orientation
+func (jpeg *JPEG) OrientedSize() (uint16, uint16) {
+	height, width := jpeg.OutputSize()
+	if orientTransforms[jpeg.Orientation()].transpose {
+		return width, height
+	}
+	return height, width
+}
+
+// Чтение размеров и цветовой модели результата DecodeWithOptions с параметрами o без декодирования скана
+// Учитываются масштаб, область и поворот по EXIF, nil - параметры по умолчанию
+func DecodeConfigWithOptions(r io.Reader, o *Options) (image.Config, error) {
+	jpeg, err := ReadJPEG(toBufio(r))
+	if err != nil {
+		return image.Config{}, err
+	}
+	if o != nil {
+		jpeg.Options = *o
+	}
+
+	height, width := jpeg.OrientedSize()
+	return image.Config{
+		ColorModel: jpeg.colorModel(),
+		Width:      int(width),
+		Height:     int(height),
+	}, nil
+}
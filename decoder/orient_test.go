@@ -0,0 +1,149 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"os"
+	"reflect"
+	"strconv"
+	"testing"
+)
+
+// Сегмент EXIF с единственным тегом Orientation
+func testOrientationSegment(orientation int) []byte {
+	t := newTestTIFF(binary.BigEndian)
+	return t.segment(t.ifd([]testExifEntry{t.short(TagOrientation, uint16(orientation))}, 0))
+}
+
+// Эталонный поворот img по таблице из спецификации EXIF: координаты исходного пикселя для пикселя (x, y) результата
+func orientReference(img image.Image, orientation int) image.Image {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if orientation >= 5 {
+		w, h = h, w
+	}
+	res := image.NewRGBA64(image.Rect(0, 0, w, h))
+	for y := range h {
+		for x := range w {
+			sx, sy := x, y
+			switch orientation {
+			case 2:
+				sx = w - 1 - x
+			case 3:
+				sx, sy = w-1-x, h-1-y
+			case 4:
+				sy = h - 1 - y
+			case 5:
+				sx, sy = y, x
+			case 6:
+				sx, sy = y, w-1-x
+			case 7:
+				sx, sy = h-1-y, w-1-x
+			case 8:
+				sx, sy = h-1-y, x
+			}
+			res.Set(x, y, img.At(sx, sy))
+		}
+	}
+	return res
+}
+
+func TestOrient(t *testing.T) {
+	img := [][]int{
+		{1, 2, 3},
+		{4, 5, 6},
+	}
+	want := map[int][][]int{
+		0: {{1, 2, 3}, {4, 5, 6}},
+		1: {{1, 2, 3}, {4, 5, 6}},
+		2: {{3, 2, 1}, {6, 5, 4}},
+		3: {{6, 5, 4}, {3, 2, 1}},
+		4: {{4, 5, 6}, {1, 2, 3}},
+		5: {{1, 4}, {2, 5}, {3, 6}},
+		6: {{4, 1}, {5, 2}, {6, 3}},
+		7: {{6, 3}, {5, 2}, {4, 1}},
+		8: {{3, 6}, {2, 5}, {1, 4}},
+		9: {{1, 2, 3}, {4, 5, 6}},
+	}
+	for orientation, res := range want {
+		if got := Orient(img, orientation); !reflect.DeepEqual(got, res) {
+			t.Fatal("Orientation", orientation, "Read:", got, "Expect:", res)
+		}
+	}
+	if got := Orient(Orient(img, 6), 8); !reflect.DeepEqual(got, img) {
+		t.Fatal("Orientation 6 then 8:", got, "Expect:", img)
+	}
+}
+
+func TestDecodeAutoOrient(t *testing.T) {
+	names := []string{"pics/Progressive/OddProgressive.jpeg", "pics/Gray/GrayBaseline.jpg", "pics/ColorSpace/YCCK.jpg"}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(name, "Decode -> error", err.Error())
+		}
+
+		for orientation := 1; orientation <= 8; orientation++ {
+			testName := name + " orientation " + strconv.Itoa(orientation)
+			oriented := withApp(data, APP1, testOrientationSegment(orientation))
+			want := orientReference(plain, orientation)
+
+			img, err := DecodeWithOptions(bytes.NewReader(oriented), &Options{AutoOrient: true})
+			if err != nil {
+				t.Fatal(testName, "DecodeWithOptions -> error", err.Error())
+			}
+			compareImages(t, testName, img, want, 0, 0)
+
+			config, err := DecodeConfigWithOptions(bytes.NewReader(oriented), &Options{AutoOrient: true})
+			if err != nil {
+				t.Fatal(testName, "DecodeConfigWithOptions -> error", err.Error())
+			}
+			if config.Width != want.Bounds().Dx() || config.Height != want.Bounds().Dy() {
+				t.Fatal(testName, "Config:", config.Width, config.Height, "Expect:", want.Bounds().Size())
+			}
+
+			//Без AutoOrient тег не применяется
+			img, err = Decode(bytes.NewReader(oriented))
+			if err != nil {
+				t.Fatal(testName, "Decode -> error", err.Error())
+			}
+			compareImages(t, testName+" without AutoOrient", img, plain, 0, 0)
+		}
+	}
+}
+
+func TestDecodeAutoOrientScaled(t *testing.T) {
+	data, err := os.ReadFile(testPics[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	oriented := withApp(data, APP1, testOrientationSegment(6))
+	crop := image.Rect(3, 5, 40, 21)
+
+	want, err := DecodeWithOptions(bytes.NewReader(data), &Options{Scale: ScaleHalf, Crop: crop})
+	if err != nil {
+		t.Fatal("DecodeWithOptions -> error", err.Error())
+	}
+	img, err := DecodeWithOptions(bytes.NewReader(oriented), &Options{Scale: ScaleHalf, Crop: crop, AutoOrient: true})
+	if err != nil {
+		t.Fatal("DecodeWithOptions -> error", err.Error())
+	}
+	compareImages(t, "scaled crop", img, orientReference(want, 6), 0, 0)
+
+	config, err := DecodeConfigWithOptions(bytes.NewReader(oriented), &Options{Scale: ScaleHalf, Crop: crop, AutoOrient: true})
+	if err != nil {
+		t.Fatal("DecodeConfigWithOptions -> error", err.Error())
+	}
+	if config.Width != crop.Dy() || config.Height != crop.Dx() {
+		t.Fatal("Config:", config.Width, config.Height, "Expect:", crop.Dy(), crop.Dx())
+	}
+
+	if _, err := DecodeYCbCr(bytes.NewReader(oriented), &Options{AutoOrient: true}); err == nil {
+		t.Fatal("DecodeYCbCr with orientation 6 -> expect error")
+	}
+}
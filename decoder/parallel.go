@@ -0,0 +1,155 @@
+package decoder
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	binreader "jpeg/decoder/binReader"
+	"sync"
+	"sync/atomic"
+)
+
+// Параллельное декодирование интервалов перезапуска и вычисление пикселей по строкам MCU
+
+// Строка MCU, готовая к вычислению пикселей
+type readyRow struct {
+	row     int //Номер строки MCU
+	decoded int //Количество прочитанных строк MCU, доступных для интерполяции
+}
+
+// Передача строки MCU row, полностью прочитанной из потока, на вычисление пикселей
+// При интерполяции между строками вычисляется предыдущая строка, которой нужна прочитанная row
+func (jpeg *JPEG) rowReady(row int) {
+	switch {
+	case jpeg.readyRows == nil:
+	case !jpeg.contextRows():
+		jpeg.readyRows <- readyRow{row, row + 1}
+	case row > 0:
+		jpeg.readyRows <- readyRow{row - 1, row + 1}
+	}
+}
+
+// Чтение baseline, при котором пиксели прочитанных строк MCU вычисляются в отдельных горутинах
+// параллельно с энтропийным декодированием следующих строк
+func (jpeg *JPEG) readScansPipelined(iterCount uint16) bool {
+	workers := jpeg.Options.workers()
+	rows := make(chan readyRow, 2*workers)
+	var wg sync.WaitGroup
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for ready := range rows {
+				jpeg.rgbCalcRow(jpeg.blocks, ready.row, ready.decoded)
+			}
+		}()
+	}
+
+	startRow := int(jpeg.CurStatus) / unitRowCount / int(jpeg.maxV)
+	jpeg.readyRows = rows
+	curRow, ok := jpeg.decodeScans(iterCount)
+	jpeg.readyRows = nil
+	//Последняя прочитанная строка вычисляется без следующей и пересчитывается при следующем чтении
+	if ok && int(curRow) > startRow && jpeg.contextRows() {
+		rows <- readyRow{int(curRow) - 1, int(curRow)}
+	}
+	close(rows)
+	wg.Wait()
+	return ok
+}
+
+// Выполнение work для номеров от 0 до count-1 в workers горутинах
+func parallelFor(count int, workers int, work func(i int)) {
+	workers = min(workers, count)
+	if workers <= 1 {
+		for i := range count {
+			work(i)
+		}
+		return
+	}
+
+	var wg sync.WaitGroup
+	var next atomic.Int64
+	wg.Add(workers)
+	for range workers {
+		go func() {
+			defer wg.Done()
+			for i := int(next.Add(1)) - 1; i < count; i = int(next.Add(1)) - 1 {
+				work(i)
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+// Флаг параллельного декодирования интервалов перезапуска baseline
+// Интервалы кодирования Хаффмана независимы: в начале каждого сбрасываются DC и битовый поток
+func (jpeg *JPEG) parallelRestarts() bool {
+	return jpeg.restartInterval != 0 && !jpeg.IsArithmetic && jpeg.Options.workers() > 1
+}
+
+// Чтение энтропийных сегментов скана, разделенных маркерами RST
+// Маркер после последнего сегмента остается непрочитанным
+func (jpeg *JPEG) readRestartSegments() [][]byte {
+	var segments [][]byte
+	for {
+		segments = append(segments, jpeg.reader.ReadToMarker())
+		marker := jpeg.reader.GetNextWord()
+		if marker < RST0 || marker > RST7 {
+			return segments
+		}
+		jpeg.reader.GetWord()
+	}
+}
+
+// Декодирование интервала перезапуска с номером index из data в mcus
+// Используется копия декодера с собственным битовым потоком и значениями DC
+func (jpeg *JPEG) decodeRestartSegment(mcus [][]MCU, data []byte, index int) error {
+	seg := *jpeg
+	seg.reader = binreader.BinReaderInit(bufio.NewReader(bytes.NewReader(data)))
+	seg.reader.HuffStreamStart()
+	seg.restart()
+
+	numOfMCUs := int(jpeg.numBlocksHeight) * int(jpeg.numBlocksWidth)
+	start := index * int(jpeg.restartInterval)
+	for i := start; i < min(start+int(jpeg.restartInterval), numOfMCUs); i++ {
+		row, col := i/int(jpeg.numBlocksWidth), i%int(jpeg.numBlocksWidth)
+		if !seg.decodeBaselineBlock(mcus, uint16(row*int(jpeg.maxV)), uint16(col*int(jpeg.maxH))) {
+			return seg.readError
+		}
+	}
+	return nil
+}
+
+// Параллельное декодирование всего скана baseline по интервалам перезапуска
+// Возвращает то же, что decodeBaselineScan при чтении изображения целиком
+func (jpeg *JPEG) decodeRestartSegments(mcus [][]MCU) (uint16, uint16, bool) {
+	segments := jpeg.readRestartSegments()
+	numOfMCUs := int(jpeg.numBlocksHeight) * int(jpeg.numBlocksWidth)
+	count := (numOfMCUs + int(jpeg.restartInterval) - 1) / int(jpeg.restartInterval)
+	if len(segments) < count {
+		jpeg.readError = errors.New("Huffman bit-reading error: make restart error")
+		return 0, 0, false
+	}
+
+	errs := make([]error, count)
+	parallelFor(count, jpeg.Options.workers(), func(i int) {
+		errs[i] = jpeg.decodeRestartSegment(mcus, segments[i], i)
+	})
+	//Ошибка первого по порядку интервала, как при последовательном чтении
+	for _, err := range errs {
+		if err != nil {
+			jpeg.readError = err
+			return 0, 0, false
+		}
+	}
+
+	jpeg.blockCount = uint(numOfMCUs)
+	jpeg.wasEOI = true
+	jpeg.reader.HuffStreamEnd()
+	for row := range int(jpeg.numBlocksHeight) {
+		jpeg.rowReady(row)
+	}
+	row := jpeg.numBlocksHeight
+	return row * unitColCount * uint16(jpeg.maxV), row, true
+}
@@ -0,0 +1,162 @@
+package decoder
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"testing"
+)
+
+// Файлы с интервалами перезапуска
+var restartPics = []string{
+	"pics/Baseline/Suwa.jpg",
+	"pics/Arithmetic/RestartHuffman.jpg",
+	"pics/Arithmetic/Restart.jpg",
+}
+
+func TestDecodeWorkers(t *testing.T) {
+	names := append(restartPics, "pics/Gray/GrayBaseline.jpg", "pics/Gray/GraySampled.jpg", testPics[2])
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want, err := DecodeWithOptions(bytes.NewReader(data), &Options{Workers: 1})
+		if err != nil {
+			t.Fatal(name, "DecodeWithOptions -> error", err.Error())
+		}
+		for _, workers := range []int{2, 7} {
+			img, err := DecodeWithOptions(bytes.NewReader(data), &Options{Workers: workers})
+			if err != nil {
+				t.Fatal(name, "DecodeWithOptions -> error", err.Error())
+			}
+			compareImages(t, name, img, want, 0, 0)
+		}
+	}
+}
+
+func TestReadBaseJPEGWorkers(t *testing.T) {
+	data, err := os.ReadFile(restartPics[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := DecodeWithOptions(bytes.NewReader(data), &Options{Workers: 1})
+	if err != nil {
+		t.Fatal("DecodeWithOptions -> error", err.Error())
+	}
+
+	//Построчное чтение использует последовательное декодирование интервалов
+	jpeg, err := ReadJPEG(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal("ReadJPEG -> error", err.Error())
+	}
+	jpeg.Options.Workers = 3
+	res := CreateRGBMatrix(jpeg.ImageHeight, jpeg.ImageWidth)
+	for done := false; !done; {
+		if done, err = jpeg.ReadBaseJPEG(res, 40); err != nil {
+			t.Fatal("ReadBaseJPEG -> error", err.Error())
+		}
+	}
+	compareImages(t, restartPics[0], ToRGBA(res), want, 0, 0)
+}
+
+// Одновременное декодирование разных файлов и запись BMP, гонки данных находит go test -race
+func TestDecodeConcurrent(t *testing.T) {
+	var names []string
+	for _, dir := range []string{"Arithmetic", "ColorSpace", "Gray"} {
+		files, err := filepath.Glob("pics/" + dir + "/*.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		names = append(names, files...)
+	}
+	names = append(names, "pics/Progressive/OddProgressive.jpeg", restartPics[0])
+
+	want := make([]image.Image, len(names))
+	datas := make([][]byte, len(names))
+	for i, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		datas[i] = data
+		if want[i], err = DecodeWithOptions(bytes.NewReader(data), &Options{Workers: 1}); err != nil {
+			t.Fatal(name, "DecodeWithOptions -> error", err.Error())
+		}
+	}
+
+	dir := t.TempDir()
+	var wg sync.WaitGroup
+	errs := make([]error, 2*len(names))
+	got := make([]image.Image, 2*len(names))
+	for i := range got {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			got[i], errs[i] = DecodeWithOptions(bytes.NewReader(datas[i/2]), &Options{Workers: 2})
+			if errs[i] == nil {
+				EncodeBMP(fromRGBA(got[i]), filepath.Join(dir, strconv.Itoa(i)+".bmp"))
+			}
+		}()
+	}
+	wg.Wait()
+
+	for i := range got {
+		if errs[i] != nil {
+			t.Fatal(names[i/2], "DecodeWithOptions -> error", errs[i].Error())
+		}
+		compareImages(t, names[i/2], got[i], want[i/2], 0, 0)
+	}
+}
+
+// Перевод image.Image в Image для записи BMP
+func fromRGBA(img image.Image) Image {
+	b := img.Bounds()
+	res := CreateRGBMatrix(uint16(b.Dy()), uint16(b.Dx()))
+	for y := range b.Dy() {
+		for x := range b.Dx() {
+			r, g, bl, _ := img.At(b.Min.X+x, b.Min.Y+y).RGBA()
+			res[y][x] = Rgb{R: byte(r >> 8), G: byte(g >> 8), B: byte(bl >> 8)}
+		}
+	}
+	return res
+}
+
+func TestDecodeWorkersErrors(t *testing.T) {
+	data, err := os.ReadFile(restartPics[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeWithOptions(bytes.NewReader(data), &Options{Workers: -1}); err == nil {
+		t.Fatal("DecodeWithOptions with negative workers -> expect error")
+	}
+	//Обрезанный файл без части интервалов перезапуска
+	for _, workers := range []int{1, 4} {
+		if _, err := DecodeWithOptions(bytes.NewReader(data[:len(data)/2]), &Options{Workers: workers}); err == nil {
+			t.Fatal("DecodeWithOptions of truncated file -> expect error, workers", workers)
+		}
+	}
+}
+
+func BenchmarkDecodeWorkers(b *testing.B) {
+	for _, name := range []string{restartPics[0], testPics[0], testPics[2]} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			b.Fatal(err)
+		}
+		for _, workers := range []int{1, 4} {
+			b.Run(filepath.Base(name)+"/Workers"+strconv.Itoa(workers), func(b *testing.B) {
+				b.SetBytes(int64(len(data)))
+				for range b.N {
+					if _, err := DecodeWithOptions(bytes.NewReader(data), &Options{Workers: workers}); err != nil {
+						b.Fatal("DecodeWithOptions -> error", err.Error())
+					}
+				}
+			})
+		}
+	}
+}
@@ -0,0 +1,128 @@
+package decoder
+
+import (
+	"errors"
+	"image"
+	"io"
+)
+
+// Вывод компонент в плоскости image.YCbCr с исходным прореживанием, без восстановления цветности и перевода в RGB
+
+// Прореживание цветности изображения в терминах image.YCbCr
+func (jpeg *JPEG) subsampleRatio() (image.YCbCrSubsampleRatio, error) {
+	if jpeg.IsLossless || jpeg.transform != transformYCbCr || jpeg.SamplePrecision != 8 {
+		return 0, errors.New("YCbCr output: only 8-bit YCbCr images are supported")
+	}
+
+	y, cb, cr := jpeg.comps[Y], jpeg.comps[Cb], jpeg.comps[Cr]
+	if y.h != jpeg.maxH || y.v != jpeg.maxV || cb.h != cr.h || cb.v != cr.v || y.h%cb.h != 0 || y.v%cb.v != 0 {
+		return 0, errors.New("YCbCr output: unsupported subsampling")
+	}
+	switch [2]byte{y.h / cb.h, y.v / cb.v} {
+	case [2]byte{1, 1}:
+		return image.YCbCrSubsampleRatio444, nil
+	case [2]byte{2, 1}:
+		return image.YCbCrSubsampleRatio422, nil
+	case [2]byte{2, 2}:
+		return image.YCbCrSubsampleRatio420, nil
+	case [2]byte{1, 2}:
+		return image.YCbCrSubsampleRatio440, nil
+	case [2]byte{4, 1}:
+		return image.YCbCrSubsampleRatio411, nil
+	case [2]byte{4, 2}:
+		return image.YCbCrSubsampleRatio410, nil
+	}
+	return 0, errors.New("YCbCr output: unsupported subsampling")
+}
+
+// Создание буфера для ReadYCbCrJPEG размером OutputSize с прореживанием цветности изображения
+func (jpeg *JPEG) CreateYCbCrImage() (*image.YCbCr, error) {
+	ratio, err := jpeg.subsampleRatio()
+	if err != nil {
+		return nil, err
+	}
+	height, width := jpeg.OutputSize()
+	return image.NewYCbCr(image.Rect(0, 0, int(width), int(height)), ratio), nil
+}
+
+// Чтение компонент YCbCr в плоскости result, iterCount - кол-во строк для baseline или сканов для progressive
+// При уменьшении все компоненты уменьшаются одинаково, прореживание сохраняется. Область Options.Crop не поддерживается
+// Возвращает true, если прочитано до конца
+func (jpeg *JPEG) ReadYCbCrJPEG(result *image.YCbCr, iterCount uint16) (bool, error) {
+	ratio, err := jpeg.subsampleRatio()
+	if err != nil {
+		return false, err
+	}
+	if !jpeg.Options.Crop.Empty() {
+		return false, errors.New("YCbCr output: crop is not supported")
+	}
+	if result.SubsampleRatio != ratio || result.Rect.Min != (image.Point{}) {
+		return false, errors.New("YCbCr output: buffer must have image subsampling and zero origin")
+	}
+	if err := jpeg.prepareRead(result.Rect.Dy(), result.Rect.Dx()); err != nil {
+		return false, err
+	}
+	jpeg.ycbcr = result
+
+	return jpeg.read(iterCount)
+}
+
+// Запись отсчетов компонент строки MCU row в плоскости jpeg.ycbcr
+func (jpeg *JPEG) planarCalcRow(blocks [][]MCU, row int) {
+	size := jpeg.Options.Scale.unitSize()
+	res := jpeg.ycbcr
+	height, width := res.Rect.Dy(), res.Rect.Dx()
+
+	var unit idctBlock
+	for c := range jpeg.numOfComps {
+		comp := &jpeg.comps[c]
+		plane, stride := res.Y, res.YStride
+		switch Channel(c) {
+		case Cb:
+			plane, stride = res.Cb, res.CStride
+		case Cr:
+			plane, stride = res.Cr, res.CStride
+		}
+		//Размеры плоскости с округлением вверх, как в image.NewYCbCr
+		compHeight := (height*int(comp.v) + int(jpeg.maxV) - 1) / int(jpeg.maxV)
+		compWidth := (width*int(comp.h) + int(jpeg.maxH) - 1) / int(jpeg.maxH)
+
+		for blockRow := row * int(comp.v); blockRow < (row+1)*int(comp.v); blockRow++ {
+			for blockCol := range int(jpeg.numBlocksWidth) * int(comp.h) {
+				mcuRow, mcuCol := jpeg.blockPos(comp, blockRow, blockCol)
+				jpeg.unitIDCT(blocks[mcuRow][mcuCol].channel(Channel(c)), comp, size, &unit)
+				for i := range min(size, compHeight-blockRow*size) {
+					offset := (blockRow*size+i)*stride + blockCol*size
+					for j := range min(size, compWidth-blockCol*size) {
+						plane[offset+j] = byte(jpeg.samples.toSample(unit[i][j]))
+					}
+				}
+			}
+		}
+	}
+}
+
+// Декодирование JPEG из r в *image.YCbCr с параметрами o, nil - параметры по умолчанию
+// Цветность возвращается с исходным прореживанием, поддерживаются 8-битные YCbCr изображения
+// Поворот по EXIF не поддерживается: при Options.AutoOrient и Orientation, отличном от 1, возвращается ошибка
+func DecodeYCbCr(r io.Reader, o *Options) (*image.YCbCr, error) {
+	jpeg, err := ReadJPEG(toBufio(r))
+	if err != nil {
+		return nil, err
+	}
+	if o != nil {
+		jpeg.Options = *o
+	}
+	if jpeg.Orientation() != 1 {
+		return nil, errors.New("YCbCr output: orientation is not supported")
+	}
+
+	res, err := jpeg.CreateYCbCrImage()
+	if err != nil {
+		return nil, err
+	}
+	if _, err := jpeg.ReadYCbCrJPEG(res, 0); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
@@ -0,0 +1,150 @@
+package decoder
+
+import (
+	"bytes"
+	"image"
+	stdjpeg "image/jpeg"
+	"os"
+	"path/filepath"
+	"strconv"
+	"testing"
+)
+
+// Сравнение отсчетов плоскостей got и want во всех пикселях с допуском maxDiff
+func compareYCbCr(t *testing.T, name string, got *image.YCbCr, want *image.YCbCr, maxDiff int) {
+	t.Helper()
+	if got.Rect != want.Rect || got.SubsampleRatio != want.SubsampleRatio {
+		t.Fatal(name, "Read:", got.Rect, got.SubsampleRatio, "Expect:", want.Rect, want.SubsampleRatio)
+	}
+	for y := got.Rect.Min.Y; y < got.Rect.Max.Y; y++ {
+		for x := got.Rect.Min.X; x < got.Rect.Max.X; x++ {
+			yi, ci := got.YOffset(x, y), got.COffset(x, y)
+			wyi, wci := want.YOffset(x, y), want.COffset(x, y)
+			for k, pair := range [3][2]byte{{got.Y[yi], want.Y[wyi]}, {got.Cb[ci], want.Cb[wci]}, {got.Cr[ci], want.Cr[wci]}} {
+				if d := int(pair[0]) - int(pair[1]); d > maxDiff || -d > maxDiff {
+					t.Fatalf("%s: (%d, %d) component %d: %d, expect %d", name, x, y, k, pair[0], pair[1])
+				}
+			}
+		}
+	}
+}
+
+func TestDecodeYCbCr(t *testing.T) {
+	names := append([]string{"pics/Progressive/OddProgressive.jpeg"}, testPics...)
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		img, err := DecodeYCbCr(bytes.NewReader(data), nil)
+		if err != nil {
+			t.Fatal(name, "DecodeYCbCr -> error", err.Error())
+		}
+
+		//Эталонный декодер тоже возвращает плоскости с исходным прореживанием
+		std, ok := decodeStd(t, data).(*image.YCbCr)
+		if !ok {
+			t.Fatal(name, "image/jpeg.Decode -> expect *image.YCbCr")
+		}
+		compareYCbCr(t, name, img, std, 2)
+
+		parallel, err := DecodeYCbCr(bytes.NewReader(data), &Options{Workers: 3})
+		if err != nil {
+			t.Fatal(name, "DecodeYCbCr -> error", err.Error())
+		}
+		compareYCbCr(t, name+" workers", parallel, img, 0)
+	}
+}
+
+func TestDecodeYCbCrScaled(t *testing.T) {
+	ratios := map[string]image.YCbCrSubsampleRatio{
+		"pics/Arithmetic/Progressive.jpg": image.YCbCrSubsampleRatio422,
+		testPics[1]:                       image.YCbCrSubsampleRatio420,
+	}
+	for name, ratio := range ratios {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for scale := ScaleFull; scale <= ScaleEighth; scale++ {
+			testName := name + " 1/" + strconv.Itoa(1<<scale)
+			img, err := DecodeYCbCr(bytes.NewReader(data), &Options{Scale: scale})
+			if err != nil {
+				t.Fatal(testName, "DecodeYCbCr -> error", err.Error())
+			}
+			if img.SubsampleRatio != ratio {
+				t.Fatal(testName, "Read:", img.SubsampleRatio, "Expect:", ratio)
+			}
+
+			//Яркость совпадает с результатом в оттенках серого того же масштаба
+			jpeg, err := ReadJPEG(toBufio(bytes.NewReader(data)))
+			if err != nil {
+				t.Fatal("ReadJPEG -> error", err.Error())
+			}
+			jpeg.Options.Scale = scale
+			gray, err := jpeg.readAllGray()
+			if err != nil {
+				t.Fatal(testName, "ReadGrayJPEG -> error", err.Error())
+			}
+			if !bytes.Equal(img.Y, ToGray(gray).Pix) {
+				t.Fatal(testName, "Y plane differs from gray image")
+			}
+		}
+	}
+}
+
+func TestDecodeYCbCrErrors(t *testing.T) {
+	for _, name := range []string{"pics/Gray/GrayBaseline.jpg", "pics/ColorSpace/YCCK.jpg", "pics/ColorSpace/RGB.jpg"} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := DecodeYCbCr(bytes.NewReader(data), nil); err == nil {
+			t.Fatal(name, "DecodeYCbCr -> expect error")
+		}
+	}
+
+	data, err := os.ReadFile(testPics[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeYCbCr(bytes.NewReader(data), &Options{Crop: image.Rect(0, 0, 8, 8)}); err == nil {
+		t.Fatal("DecodeYCbCr with crop -> expect error")
+	}
+	jpeg, err := ReadJPEG(toBufio(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal("ReadJPEG -> error", err.Error())
+	}
+	res := image.NewYCbCr(image.Rect(0, 0, int(jpeg.ImageWidth), int(jpeg.ImageHeight)), image.YCbCrSubsampleRatio444)
+	if _, err := jpeg.ReadYCbCrJPEG(res, 0); err == nil {
+		t.Fatal("ReadYCbCrJPEG with other subsampling -> expect error")
+	}
+}
+
+func BenchmarkDecodeYCbCr(b *testing.B) {
+	data, err := os.ReadFile(testPics[0])
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Run(filepath.Base(testPics[0])+"/RGB", func(b *testing.B) {
+		for range b.N {
+			if _, err := Decode(bytes.NewReader(data)); err != nil {
+				b.Fatal("Decode -> error", err.Error())
+			}
+		}
+	})
+	b.Run(filepath.Base(testPics[0])+"/YCbCr", func(b *testing.B) {
+		for range b.N {
+			if _, err := DecodeYCbCr(bytes.NewReader(data), nil); err != nil {
+				b.Fatal("DecodeYCbCr -> error", err.Error())
+			}
+		}
+	})
+	b.Run(filepath.Base(testPics[0])+"/Std", func(b *testing.B) {
+		for range b.N {
+			if _, err := stdjpeg.Decode(bytes.NewReader(data)); err != nil {
+				b.Fatal("image/jpeg.Decode -> error", err.Error())
+			}
+		}
+	})
+}
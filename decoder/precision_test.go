@@ -0,0 +1,215 @@
+package decoder
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"math/bits"
+	"testing"
+)
+
+// Битовый поток для сборки тестовых файлов с заполнением 0xFF 0x00
+type testBitWriter struct {
+	buf   bytes.Buffer
+	acc   uint32
+	count uint
+}
+
+// Запись n младших бит code
+func (w *testBitWriter) putBits(code uint32, n uint) {
+	for i := int(n) - 1; i >= 0; i-- {
+		w.acc = w.acc<<1 | (code>>uint(i))&1
+		w.count++
+		if w.count == 8 {
+			w.buf.WriteByte(byte(w.acc))
+			if byte(w.acc) == 0xFF {
+				w.buf.WriteByte(0x00)
+			}
+			w.acc, w.count = 0, 0
+		}
+	}
+}
+
+// Дополнение последнего байта единицами
+func (w *testBitWriter) flush() {
+	for w.count != 0 {
+		w.putBits(1, 1)
+	}
+}
+
+// Запись разности diff: категория кодом длины 5 и дополнительные биты
+func (w *testBitWriter) putDiff(diff int) {
+	size := uint(bits.Len(uint(max(diff, -diff))))
+	w.putBits(uint32(size), 5)
+	if diff < 0 {
+		diff += 1<<size - 1
+	}
+	w.putBits(uint32(diff), size)
+}
+
+// Запись сегмента marker с содержимым data
+func putSegment(buf *bytes.Buffer, marker uint16, data ...byte) {
+	buf.Write([]byte{byte(marker >> 8), byte(marker), byte((len(data) + 2) >> 8), byte(len(data) + 2)})
+	buf.Write(data)
+}
+
+// Сборка 12-битного изображения из однотонных блоков 8x8
+// values[c][i] - значение i-го блока компоненты c, все компоненты 1x1
+func make12BitJPEG(values [][]int, blocksW int, blocksH int, progressive bool) []byte {
+	var buf bytes.Buffer
+	buf.Write([]byte{0xFF, 0xD8})
+
+	//16-битная таблица квантования: DC = 8, AC не используются
+	dqt := []byte{0x10}
+	for i := range sizeOfTable {
+		q := uint16(300)
+		if i == 0 {
+			q = 8
+		}
+		dqt = append(dqt, byte(q>>8), byte(q))
+	}
+	putSegment(&buf, DQT, dqt...)
+
+	marker := SOF1
+	if progressive {
+		marker = SOF2
+	}
+	height, width := blocksH*unitRowCount, blocksW*unitColCount
+	sof := []byte{12, byte(height >> 8), byte(height), byte(width >> 8), byte(width), byte(len(values))}
+	for c := range values {
+		sof = append(sof, byte(c+1), 0x11, 0)
+	}
+	putSegment(&buf, marker, sof...)
+
+	//DC: категории 0-15 кодами длины 5, AC: EOB, EOB1 и EOB2 кодами длины 2
+	dc := []byte{0x00, 0, 0, 0, 0, 16, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+	for i := range 16 {
+		dc = append(dc, byte(i))
+	}
+	putSegment(&buf, DHT, dc...)
+	putSegment(&buf, DHT, 0x10, 0, 3, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0, 0x00, 0x10, 0x20)
+
+	scan := func(comps []int, ss byte, se byte, body func(w *testBitWriter)) {
+		sos := []byte{byte(len(comps))}
+		for _, c := range comps {
+			sos = append(sos, byte(c+1), 0x00)
+		}
+		sos = append(sos, ss, se, 0)
+		putSegment(&buf, SOS, sos...)
+
+		var w testBitWriter
+		body(&w)
+		w.flush()
+		buf.Write(w.buf.Bytes())
+	}
+
+	all := make([]int, len(values))
+	for c := range all {
+		all[c] = c
+	}
+	dcScan := func(withAC bool) func(w *testBitWriter) {
+		return func(w *testBitWriter) {
+			prev := make([]int, len(values))
+			for i := range blocksW * blocksH {
+				for c := range values {
+					coef := values[c][i] - 2048
+					w.putDiff(coef - prev[c])
+					prev[c] = coef
+					if withAC {
+						w.putBits(0b00, 2)
+					}
+				}
+			}
+		}
+	}
+
+	if !progressive {
+		scan(all, 0, 63, dcScan(true))
+	} else {
+		scan(all, 0, 0, dcScan(false))
+		for c := range values {
+			//Один EOBRUN на все блоки компоненты
+			scan([]int{c}, 1, 63, func(w *testBitWriter) {
+				run := blocksW * blocksH
+				r := uint(bits.Len(uint(run)) - 1)
+				w.putBits(uint32(r), 2)
+				w.putBits(uint32(run-1<<r), r)
+			})
+		}
+	}
+
+	buf.Write([]byte{0xFF, 0xD9})
+	return buf.Bytes()
+}
+
+func TestDecode12Bit(t *testing.T) {
+	const blocksW, blocksH = 3, 2
+	gray := []int{0, 4095, 2048, 100, 3000, 1234}
+
+	for _, progressive := range []bool{false, true} {
+		data := make12BitJPEG([][]int{gray}, blocksW, blocksH, progressive)
+
+		jpeg, err := ReadJPEG(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			t.Fatal("ReadJPEG -> error", err.Error())
+		}
+		if jpeg.SamplePrecision != 12 || jpeg.IsProgressive != progressive {
+			t.Fatal("Read precision:", jpeg.SamplePrecision, "progressive:", jpeg.IsProgressive)
+		}
+
+		res := CreateGray16Matrix(jpeg.ImageHeight, jpeg.ImageWidth)
+		if _, err := jpeg.ReadGray16JPEG(res, 0); err != nil {
+			t.Fatal("ReadGray16JPEG -> error", err.Error())
+		}
+		for i := range res {
+			for j := range res[i] {
+				want := gray[i/unitRowCount*blocksW+j/unitColCount]
+				if int(res[i][j]) != want {
+					t.Fatalf("progressive %v (%d, %d): Read: %d Expect: %d", progressive, i, j, res[i][j], want)
+				}
+			}
+		}
+
+		img, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal("Decode -> error", err.Error())
+		}
+		gray16, ok := img.(*image.Gray16)
+		if !ok {
+			t.Fatalf("got %T, expect *image.Gray16", img)
+		}
+		if val := gray16.Gray16At(unitColCount, 0).Y; val != 0xFFFF {
+			t.Fatal("Read:", val, "Expect:", 0xFFFF)
+		}
+	}
+}
+
+func TestDecode12BitColor(t *testing.T) {
+	const blocksW, blocksH = 2, 1
+	luma := []int{500, 3500}
+	chroma := []int{2048, 2048}
+	data := make12BitJPEG([][]int{luma, chroma, chroma}, blocksW, blocksH, false)
+
+	jpeg, err := ReadJPEG(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal("ReadJPEG -> error", err.Error())
+	}
+	res := CreateRGB16Matrix(jpeg.ImageHeight, jpeg.ImageWidth)
+	if _, err := jpeg.ReadJPEG16(res, 0); err != nil {
+		t.Fatal("ReadJPEG16 -> error", err.Error())
+	}
+	for j, want := range luma {
+		px := res[0][j*unitColCount]
+		if int(px.R) != want || int(px.G) != want || int(px.B) != want {
+			t.Fatal("Read:", px, "Expect:", want)
+		}
+	}
+
+	img, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("Decode -> error", err.Error())
+	}
+	if _, ok := img.(*image.RGBA64); !ok {
+		t.Fatalf("got %T, expect *image.RGBA64", img)
+	}
+}
@@ -0,0 +1,190 @@
+package decoder
+
+import "image"
+
+// Декодирование с уменьшением в 2, 4 и 8 раз уменьшенными ОДКП (порт jidctred.c из libjpeg)
+
+// Масштаб декодирования
+type Scale byte
+
+const (
+	ScaleFull    Scale = iota //Полный размер
+	ScaleHalf                 //Уменьшение в 2 раза, ОДКП 4x4
+	ScaleQuarter              //Уменьшение в 4 раза, ОДКП 2x2
+	ScaleEighth               //Уменьшение в 8 раз, только DC
+)
+
+// Размер стороны блока после ОДКП для масштаба scale
+func (scale Scale) unitSize() int {
+	return unitRowCount >> scale
+}
+
+// Сторона блока компоненты comp после ОДКП
+// При уменьшении прореженные компоненты восстанавливаются ОДКП большего размера вместо повторения отсчетов, как в libjpeg
+func (jpeg *JPEG) compUnitSize(comp *component) int {
+	size := jpeg.Options.Scale.unitSize()
+	res := size
+	for res < unitRowCount && int(jpeg.maxV)*size%(int(comp.v)*res*2) == 0 && int(jpeg.maxH)*size%(int(comp.h)*res*2) == 0 {
+		res *= 2
+	}
+	return res
+}
+
+// Размер стороны size после уменьшения с округлением вверх
+func (scale Scale) apply(size uint16) uint16 {
+	return uint16((int(size) + 1<<scale - 1) >> scale)
+}
+
+// Границы уменьшенного изображения
+func (jpeg *JPEG) scaledRect() image.Rectangle {
+	return image.Rect(0, 0, int(jpeg.Options.Scale.apply(jpeg.ImageWidth)), int(jpeg.Options.Scale.apply(jpeg.ImageHeight)))
+}
+
+// Область уменьшенного изображения, записываемая в результат
+func (jpeg *JPEG) outputRect() image.Rectangle {
+	if jpeg.Options.Crop.Empty() {
+		return jpeg.scaledRect()
+	}
+	return jpeg.Options.Crop
+}
+
+// Размеры результата декодирования с учетом масштаба Options.Scale и области Options.Crop
+// Буферы для Read*JPEG должны создаваться по этим размерам
+func (jpeg *JPEG) OutputSize() (uint16, uint16) {
+	rect := jpeg.outputRect()
+	return uint16(rect.Dy()), uint16(rect.Dx())
+}
+
+// Константы уменьшенных ОДКП: FIX(x) = x * 2^13
+const (
+	fix0211164243 = 1730
+	fix0509795579 = 4176
+	fix0601344887 = 4926
+	fix0720959822 = 5906
+	fix0850430095 = 6967
+	fix1061594337 = 8697
+	fix1272758580 = 10426
+	fix1451774981 = 11893
+	fix2172734803 = 17799
+	fix3624509785 = 29692
+)
+
+// Одномерное ОДКП 4 точек по коэффициентам data с шагом step, коэффициент 4 не используется
+// Результат масштабирован на 2^(islowConstBits+1) и делится на 2^shift с округлением
+func idct4(data []int, step int, shift uint) [4]int {
+	//Четная часть
+	tmp0 := data[0] << (islowConstBits + 1)
+	tmp2 := data[2*step]*fix1847759065 - data[6*step]*fix0765366865
+	tmp10, tmp12 := tmp0+tmp2, tmp0-tmp2
+
+	//Нечетная часть
+	z1, z2, z3, z4 := data[7*step], data[5*step], data[3*step], data[step]
+	tmp0 = -z1*fix0211164243 + z2*fix1451774981 - z3*fix2172734803 + z4*fix1061594337
+	tmp2 = -z1*fix0509795579 - z2*fix0601344887 + z3*fix0899976223 + z4*fix2562915447
+
+	return [4]int{
+		descale(tmp10+tmp2, shift),
+		descale(tmp12+tmp0, shift),
+		descale(tmp12-tmp0, shift),
+		descale(tmp10-tmp2, shift),
+	}
+}
+
+// Одномерное ОДКП 2 точек по нечетным коэффициентам data с шагом step
+// Результат масштабирован на 2^(islowConstBits+2) и делится на 2^shift с округлением
+func idct2(data []int, step int, shift uint) [2]int {
+	tmp10 := data[0] << (islowConstBits + 2)
+	tmp0 := -data[7*step]*fix0720959822 + data[5*step]*fix0850430095 -
+		data[3*step]*fix1272758580 + data[step]*fix3624509785
+	return [2]int{descale(tmp10+tmp0, shift), descale(tmp10-tmp0, shift)}
+}
+
+// Проверка, что коэффициенты data с шагом step с номерами из ks нулевые
+func zeroCoefs(data []int, step int, ks ...int) bool {
+	for _, k := range ks {
+		if data[k*step] != 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// ОДКП 4x4 деквантованного блока в построчном порядке, результат в левом верхнем углу res
+func idct4x4(coefs *[unitRowCount * unitColCount]int, res *idctBlock) {
+	var ws [4 * unitColCount]int
+	//Столбцы, столбец 4 не используется во втором проходе
+	for col := range unitColCount {
+		if col == 4 {
+			continue
+		}
+		column := coefs[col:]
+		if zeroCoefs(column, unitColCount, 1, 2, 3, 5, 6, 7) {
+			for k := range 4 {
+				ws[k*unitColCount+col] = column[0] << islowPass1Bits
+			}
+			continue
+		}
+		for k, val := range idct4(column, unitColCount, islowConstBits-islowPass1Bits+1) {
+			ws[k*unitColCount+col] = val
+		}
+	}
+	//Строки
+	for row := range 4 {
+		line := ws[row*unitColCount : (row+1)*unitColCount]
+		if zeroCoefs(line, 1, 1, 2, 3, 5, 6, 7) {
+			val := float32(descale(line[0], islowPass1Bits+3))
+			for col := range 4 {
+				res[row][col] = val
+			}
+			continue
+		}
+		for col, val := range idct4(line, 1, islowConstBits+islowPass1Bits+3+1) {
+			res[row][col] = float32(val)
+		}
+	}
+}
+
+// ОДКП 2x2 деквантованного блока в построчном порядке, результат в левом верхнем углу res
+func idct2x2(coefs *[unitRowCount * unitColCount]int, res *idctBlock) {
+	var ws [2 * unitColCount]int
+	//Столбцы, четные столбцы кроме 0 не используются во втором проходе
+	for col := range unitColCount {
+		if col != 0 && col%2 == 0 {
+			continue
+		}
+		column := coefs[col:]
+		if zeroCoefs(column, unitColCount, 1, 3, 5, 7) {
+			ws[col] = column[0] << islowPass1Bits
+			ws[unitColCount+col] = ws[col]
+			continue
+		}
+		vals := idct2(column, unitColCount, islowConstBits-islowPass1Bits+2)
+		ws[col], ws[unitColCount+col] = vals[0], vals[1]
+	}
+	//Строки
+	for row := range 2 {
+		line := ws[row*unitColCount : (row+1)*unitColCount]
+		if zeroCoefs(line, 1, 1, 3, 5, 7) {
+			val := float32(descale(line[0], islowPass1Bits+3))
+			res[row][0], res[row][1] = val, val
+			continue
+		}
+		vals := idct2(line, 1, islowConstBits+islowPass1Bits+3+2)
+		res[row][0], res[row][1] = float32(vals[0]), float32(vals[1])
+	}
+}
+
+// Уменьшенное ОДКП блока unit в порядке зиг-зага с таблицей квантования quantTable
+// Результат со стороной size (4, 2 или 1) записывается в левый верхний угол res
+func scaledInverseDCT(unit []int16, quantTable []uint16, size int, res *idctBlock) {
+	switch size {
+	case 1:
+		res[0][0] = float32(descale(int(unit[0])*int(quantTable[0]), 3))
+	case 2:
+		coefs := dequantNatural(unit, quantTable)
+		idct2x2(&coefs, res)
+	default:
+		coefs := dequantNatural(unit, quantTable)
+		idct4x4(&coefs, res)
+	}
+}
@@ -0,0 +1,111 @@
+package decoder
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// Уменьшение изображения в 2^scale раз усреднением блоков пикселей
+func downscale(img image.Image, scale Scale) image.Image {
+	b := img.Bounds()
+	step := 1 << scale
+	res := image.NewRGBA(image.Rect(0, 0, int(scale.apply(uint16(b.Dx()))), int(scale.apply(uint16(b.Dy())))))
+	for y := range res.Bounds().Dy() {
+		for x := range res.Bounds().Dx() {
+			var sum [3]uint32
+			count := uint32(0)
+			for dy := range step {
+				for dx := range step {
+					if y*step+dy >= b.Dy() || x*step+dx >= b.Dx() {
+						continue
+					}
+					r, g, bl, _ := img.At(b.Min.X+x*step+dx, b.Min.Y+y*step+dy).RGBA()
+					sum[0], sum[1], sum[2] = sum[0]+r>>8, sum[1]+g>>8, sum[2]+bl>>8
+					count++
+				}
+			}
+			res.Set(x, y, color.RGBA{byte(sum[0] / count), byte(sum[1] / count), byte(sum[2] / count), 0xFF})
+		}
+	}
+	return res
+}
+
+func TestOutputSize(t *testing.T) {
+	data, err := os.ReadFile("pics/Gray/GrayBaseline.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	jpeg, err := ReadJPEG(toBufio(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal("ReadJPEG -> error", err.Error())
+	}
+	//Исходный размер 77x101
+	sizes := map[Scale][2]uint16{ScaleFull: {77, 101}, ScaleHalf: {39, 51}, ScaleQuarter: {20, 26}, ScaleEighth: {10, 13}}
+	for scale, size := range sizes {
+		jpeg.Options.Scale = scale
+		if height, width := jpeg.OutputSize(); height != size[0] || width != size[1] {
+			t.Fatal("Scale", scale, "size:", height, width, "Expect:", size[0], size[1])
+		}
+	}
+}
+
+func TestDecodeScaled(t *testing.T) {
+	names := []string{"pics/Gray/GrayBaseline.jpg", "pics/Gray/GraySampled.jpg", testPics[1], testPics[2], "pics/ColorSpace/YCCK.jpg"}
+	for _, name := range names {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		full, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(name, "Decode -> error", err.Error())
+		}
+		for scale := ScaleHalf; scale <= ScaleEighth; scale++ {
+			img, err := DecodeWithOptions(bytes.NewReader(data), &Options{Scale: scale})
+			if err != nil {
+				t.Fatal(name, "DecodeWithOptions -> error", err.Error())
+			}
+			compareImages(t, name+" 1/"+strconv.Itoa(1<<scale), img, downscale(full, scale), 64, 2)
+		}
+	}
+}
+
+func TestDecodeScaledErrors(t *testing.T) {
+	data, err := os.ReadFile("pics/Gray/GrayBaseline.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeWithOptions(bytes.NewReader(data), &Options{Scale: ScaleEighth + 1}); err == nil {
+		t.Fatal("DecodeWithOptions with unknown scale -> expect error")
+	}
+
+	//Буфер должен иметь уменьшенный размер
+	jpeg, err := ReadJPEG(toBufio(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal("ReadJPEG -> error", err.Error())
+	}
+	jpeg.Options.Scale = ScaleHalf
+	if _, err := jpeg.ReadGrayJPEG(CreateGrayMatrix(jpeg.ImageHeight, jpeg.ImageWidth), 0); err == nil {
+		t.Fatal("ReadGrayJPEG with full size buffer -> expect error")
+	}
+}
+
+func BenchmarkDecodeScaled(b *testing.B) {
+	data, err := os.ReadFile(testPics[0])
+	if err != nil {
+		b.Fatal(err)
+	}
+	for scale := ScaleFull; scale <= ScaleEighth; scale++ {
+		b.Run("1/"+strconv.Itoa(1<<scale), func(b *testing.B) {
+			for range b.N {
+				if _, err := DecodeWithOptions(bytes.NewReader(data), &Options{Scale: scale}); err != nil {
+					b.Fatal("DecodeWithOptions -> error", err.Error())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,315 @@
+package decoder
+
+import (
+	"errors"
+	binreader "jpeg/decoder/binReader"
+	"math"
+)
+
+// Перевод отсчетов в sRGB по встроенному профилю ICC с матрицей и кривыми тона (RGB) или кривой тона (GRAY)
+
+// Основные цвета sRGB в XYZ, приведенные к D50, как в профиле sRGB IEC61966-2.1
+var srgbColorants = [3][3]float64{
+	{0.436065674, 0.385147095, 0.143066406},
+	{0.222488403, 0.716873169, 0.060607910},
+	{0.013916016, 0.097076416, 0.714096069},
+}
+
+// Перевод отсчетов изображения в sRGB
+type ColorTransform struct {
+	Gray bool //Профиль в оттенках серого, применяется к GrayImage и Gray16Image
+
+	curves [3]func(float64) float64 //Перевод отсчетов компонент 0-1 в линейные значения
+	matrix [3][3]float64            //Перевод линейных значений в линейные значения sRGB
+}
+
+// Таблицы перевода для глубины отсчетов
+type srgbTables struct {
+	in     [3][]float32 //Линейные значения для каждого отсчета компонент
+	out    []int        //Отсчеты sRGB для равномерно распределенных линейных значений
+	maxVal int          //Максимальное значение отсчета
+}
+
+// Число с фиксированной точкой s15Fixed16 из data по смещению offset
+func iccFixed(data []byte, offset int) float64 {
+	return float64(int32(sliceReader(data, offset, binreader.BIG).GetDWord())) / 65536
+}
+
+// Кривая тона из тега типа curv или para
+func iccCurve(tag []byte) (func(float64) float64, error) {
+	if len(tag) < 12 {
+		return nil, errors.New("ICC transform error: curve tag is too short")
+	}
+	reader := sliceReader(tag, 8, binreader.BIG)
+	switch string(tag[:4]) {
+	case "curv":
+		n := int(reader.GetDWord())
+		if 12+2*int64(n) > int64(len(tag)) {
+			return nil, errors.New("ICC transform error: curve out of bounds")
+		}
+		switch n {
+		case 0:
+			return func(x float64) float64 { return x }, nil
+		case 1:
+			gamma := float64(reader.GetWord()) / 256
+			return func(x float64) float64 { return math.Pow(x, gamma) }, nil
+		}
+		table := make([]float64, n)
+		for i := range table {
+			table[i] = float64(reader.GetWord()) / 0xFFFF
+		}
+		//Линейная интерполяция между значениями таблицы
+		return func(x float64) float64 {
+			pos := min(max(x, 0), 1) * float64(n-1)
+			i := min(int(pos), n-2)
+			return table[i] + (table[i+1]-table[i])*(pos-float64(i))
+		}, nil
+	case "para":
+		kind := int(reader.GetWord())
+		counts := [5]int{1, 3, 4, 5, 7}
+		if kind >= len(counts) || 12+4*int64(counts[kind]) > int64(len(tag)) {
+			return nil, errors.New("ICC transform error: invalid parametric curve")
+		}
+		var p [7]float64 //g, a, b, c, d, e, f
+		p[1] = 1
+		for i := range counts[kind] {
+			p[i] = iccFixed(tag, 12+4*i)
+		}
+		g, a, b, c, d, e, f := p[0], p[1], p[2], p[3], p[4], p[5], p[6]
+		switch kind {
+		case 1:
+			d = -b / a
+		case 2:
+			d, f = -b/a, c
+			e, c = c, 0
+		}
+		//Y = (aX + b)^g + e при X >= d, иначе cX + f
+		return func(x float64) float64 {
+			if x < d {
+				return c*x + f
+			}
+			return math.Pow(max(a*x+b, 0), g) + e
+		}, nil
+	}
+	return nil, errors.New("ICC transform error: unsupported curve type")
+}
+
+// Значение тега XYZ из data
+func iccXYZ(tag []byte) ([3]float64, error) {
+	if len(tag) < 20 || string(tag[:4]) != "XYZ " {
+		return [3]float64{}, errors.New("ICC transform error: invalid XYZ tag")
+	}
+	return [3]float64{iccFixed(tag, 8), iccFixed(tag, 12), iccFixed(tag, 16)}, nil
+}
+
+// Обратная матрица m, false - матрица вырождена
+func invert3(m [3][3]float64) ([3][3]float64, bool) {
+	var res [3][3]float64
+	det := m[0][0]*(m[1][1]*m[2][2]-m[1][2]*m[2][1]) - m[0][1]*(m[1][0]*m[2][2]-m[1][2]*m[2][0]) + m[0][2]*(m[1][0]*m[2][1]-m[1][1]*m[2][0])
+	if math.Abs(det) < 1e-9 {
+		return res, false
+	}
+	for i := range 3 {
+		for j := range 3 {
+			//Алгебраическое дополнение элемента (j, i)
+			r0, r1 := (j+1)%3, (j+2)%3
+			c0, c1 := (i+1)%3, (i+2)%3
+			res[i][j] = (m[r0][c0]*m[r1][c1] - m[r0][c1]*m[r1][c0]) / det
+		}
+	}
+	return res, true
+}
+
+// Создание перевода в sRGB по профилю profile
+// Поддерживаются профили RGB с матрицей и кривыми тона и профили GRAY с кривой тона
+func NewColorTransform(profile *ICCProfile) (*ColorTransform, error) {
+	if profile == nil {
+		return nil, errors.New("ICC transform error: no profile")
+	}
+
+	res := &ColorTransform{}
+	switch profile.ColorSpace {
+	case "GRAY":
+		curve, err := iccCurve(profile.Tag("kTRC"))
+		if err != nil {
+			return nil, err
+		}
+		res.Gray = true
+		res.curves = [3]func(float64) float64{curve, curve, curve}
+		res.matrix = [3][3]float64{{1, 0, 0}, {0, 1, 0}, {0, 0, 1}}
+		return res, nil
+	case "RGB":
+		if profile.PCS != "XYZ" {
+			return nil, errors.New("ICC transform error: matrix profile must have XYZ PCS")
+		}
+	default:
+		return nil, errors.New("ICC transform error: unsupported color space " + profile.ColorSpace)
+	}
+
+	//Столбцы матрицы - координаты основных цветов профиля в XYZ
+	var colorants [3][3]float64
+	for c, prefix := range []string{"r", "g", "b"} {
+		curve, err := iccCurve(profile.Tag(prefix + "TRC"))
+		if err != nil {
+			return nil, err
+		}
+		res.curves[c] = curve
+		xyz, err := iccXYZ(profile.Tag(prefix + "XYZ"))
+		if err != nil {
+			return nil, err
+		}
+		for i := range 3 {
+			colorants[i][c] = xyz[i]
+		}
+	}
+
+	toSRGB, _ := invert3(srgbColorants)
+	for i := range 3 {
+		for j := range 3 {
+			for k := range 3 {
+				res.matrix[i][j] += toSRGB[i][k] * colorants[k][j]
+			}
+		}
+	}
+	return res, nil
+}
+
+// Кодирование линейного значения 0-1 в отсчет sRGB 0-1
+func srgbEncode(val float64) float64 {
+	if val <= 0.0031308 {
+		return 12.92 * val
+	}
+	return 1.055*math.Pow(val, 1/2.4) - 0.055
+}
+
+// Таблицы перевода для отсчетов глубины precision
+func (t *ColorTransform) tables(precision byte) *srgbTables {
+	maxVal := newSampleRange(precision).maxVal
+	res := &srgbTables{maxVal: maxVal}
+	for c := range res.in {
+		if c > 0 && t.Gray {
+			res.in[c] = res.in[0]
+			continue
+		}
+		res.in[c] = make([]float32, maxVal+1)
+		for i := range res.in[c] {
+			res.in[c][i] = float32(t.curves[c](float64(i) / float64(maxVal)))
+		}
+	}
+	//16 линейных значений на отсчет дают ошибку меньше отсчета в темных тонах
+	res.out = make([]int, min(16*(maxVal+1), 1<<16))
+	outMax := float64(len(res.out) - 1)
+	for i := range res.out {
+		res.out[i] = int(srgbEncode(float64(i)/outMax)*float64(maxVal) + 0.5)
+	}
+	return res
+}
+
+// Перевод линейного значения в отсчет sRGB с ограничением по гамме
+func (s *srgbTables) encode(val float32) int {
+	val = min(max(val, 0), 1)
+	return s.out[int(val*float32(len(s.out)-1)+0.5)]
+}
+
+// Перевод отсчетов r, g, b в sRGB
+func (t *ColorTransform) convert(s *srgbTables, r int, g int, b int) (int, int, int) {
+	lin := [3]float32{s.in[0][r], s.in[1][g], s.in[2][b]}
+	var res [3]int
+	for i := range res {
+		m := &t.matrix[i]
+		res[i] = s.encode(float32(m[0])*lin[0] + float32(m[1])*lin[1] + float32(m[2])*lin[2])
+	}
+	return res[0], res[1], res[2]
+}
+
+// Перевод отсчетов в оттенках серого в sRGB через таблицу для всех значений
+func (t *ColorTransform) grayTable(precision byte) []int {
+	maxVal := newSampleRange(precision).maxVal
+	res := make([]int, maxVal+1)
+	for i := range res {
+		lin := min(max(t.curves[0](float64(i)/float64(maxVal)), 0), 1)
+		res[i] = int(srgbEncode(lin)*float64(maxVal) + 0.5)
+	}
+	return res
+}
+
+// Перевод изображения RGB в sRGB на месте
+func (t *ColorTransform) Apply(img Image) {
+	s := t.tables(8)
+	for i := range img {
+		for j := range img[i] {
+			pixel := &img[i][j]
+			r, g, b := t.convert(s, int(pixel.R), int(pixel.G), int(pixel.B))
+			*pixel = Rgb{R: byte(r), G: byte(g), B: byte(b)}
+		}
+	}
+}
+
+// Перевод изображения RGB с отсчетами глубины precision в sRGB на месте
+func (t *ColorTransform) Apply16(img Image16, precision byte) {
+	s := t.tables(precision)
+	for i := range img {
+		for j := range img[i] {
+			pixel := &img[i][j]
+			r, g, b := t.convert(s, int(pixel.R), int(pixel.G), int(pixel.B))
+			*pixel = Rgb16{R: uint16(r), G: uint16(g), B: uint16(b)}
+		}
+	}
+}
+
+// Перевод изображения в оттенках серого в sRGB на месте, профиль должен быть GRAY
+func (t *ColorTransform) ApplyGray(img GrayImage) {
+	table := t.grayTable(8)
+	for i := range img {
+		for j, val := range img[i] {
+			img[i][j] = byte(table[val])
+		}
+	}
+}
+
+// Перевод изображения в оттенках серого с отсчетами глубины precision в sRGB на месте, профиль должен быть GRAY
+func (t *ColorTransform) ApplyGray16(img Gray16Image, precision byte) {
+	table := t.grayTable(precision)
+	for i := range img {
+		for j, val := range img[i] {
+			img[i][j] = uint16(table[val])
+		}
+	}
+}
+
+// Проверка, что перевод меняет 8-битные отсчеты не больше чем на 1, как для профиля sRGB
+func (t *ColorTransform) isIdentity() bool {
+	for i := range 3 {
+		for j := range 3 {
+			want := 0.0
+			if i == j {
+				want = 1
+			}
+			if math.Abs(t.matrix[i][j]-want) > 1e-3 {
+				return false
+			}
+		}
+	}
+	s := t.tables(8)
+	for c := range s.in {
+		for i, lin := range s.in[c] {
+			if d := s.encode(lin) - i; d > 1 || d < -1 {
+				return false
+			}
+		}
+	}
+	return true
+}
+
+// Перевод в sRGB для результата Decode*: nil, если задан Options.KeepColorSpace, профиля нет,
+// он не поддерживается, не подходит к результату (gray - результат в оттенках серого) или не меняет цвета
+func (jpeg *JPEG) srgbTransform(gray bool) *ColorTransform {
+	if jpeg.Options.KeepColorSpace || jpeg.ICC == nil {
+		return nil
+	}
+	t, err := NewColorTransform(jpeg.ICC)
+	if err != nil || t.Gray != gray || t.isIdentity() {
+		return nil
+	}
+	return t
+}
@@ -0,0 +1,344 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"math"
+	"os"
+	"testing"
+)
+
+// Тег тестового профиля
+type testICCTag struct {
+	sig  string
+	data []byte
+}
+
+// Профиль ICC v4 класса mntr с пространством colorSpace, PCS pcs и тегами tags
+func buildTestICC(colorSpace string, pcs string, tags []testICCTag) []byte {
+	res := make([]byte, iccHeaderLen)
+	res[8], res[9] = 4, 0x30
+	copy(res[12:], "mntr")
+	copy(res[16:], (colorSpace + "    ")[:4])
+	copy(res[20:], (pcs + "    ")[:4])
+	copy(res[36:], "acsp")
+	res = binary.BigEndian.AppendUint32(res, uint32(len(tags)))
+	offset := iccHeaderLen + 4 + iccTagLen*len(tags)
+	for _, tag := range tags {
+		res = append(res, tag.sig...)
+		res = binary.BigEndian.AppendUint32(res, uint32(offset))
+		res = binary.BigEndian.AppendUint32(res, uint32(len(tag.data)))
+		offset += len(tag.data)
+	}
+	for _, tag := range tags {
+		res = append(res, tag.data...)
+	}
+	binary.BigEndian.PutUint32(res, uint32(len(res)))
+	return res
+}
+
+// Данные тега типа sig с числами s15Fixed16 vals
+func testFixedTag(sig string, vals ...float64) []byte {
+	res := append([]byte(sig), 0, 0, 0, 0)
+	for _, val := range vals {
+		res = binary.BigEndian.AppendUint32(res, uint32(int32(math.Round(val*65536))))
+	}
+	return res
+}
+
+// Параметрическая кривая типа kind с параметрами params
+func testParaTag(kind uint16, params ...float64) []byte {
+	res := testFixedTag("para", params...)
+	return append(append(res[:8:8], byte(kind>>8), byte(kind), 0, 0), res[8:]...)
+}
+
+// Кривая curv с таблицей vals
+func testCurvTag(vals ...uint16) []byte {
+	res := binary.BigEndian.AppendUint32([]byte("curv\x00\x00\x00\x00"), uint32(len(vals)))
+	for _, val := range vals {
+		res = binary.BigEndian.AppendUint16(res, val)
+	}
+	return res
+}
+
+// Матричный профиль RGB с основными цветами colorants (столбцы XYZ D50) и кривой trc для всех компонент
+func testMatrixICC(colorants [3][3]float64, trc []byte) *ICCProfile {
+	var tags []testICCTag
+	for c, prefix := range []string{"r", "g", "b"} {
+		tags = append(tags,
+			testICCTag{prefix + "XYZ", testFixedTag("XYZ ", colorants[0][c], colorants[1][c], colorants[2][c])},
+			testICCTag{prefix + "TRC", trc})
+	}
+	profile, err := ParseICC(buildTestICC("RGB", "XYZ", tags))
+	if err != nil {
+		panic(err)
+	}
+	return profile
+}
+
+// Кривая sRGB в виде параметрической кривой типа 3
+var srgbParaTag = testParaTag(3, 2.4, 1/1.055, 0.055/1.055, 1/12.92, 0.04045)
+
+// Основные цвета Display P3 и Adobe RGB (1998), приведенные к D50
+var (
+	p3Colorants = [3][3]float64{
+		{0.515102, 0.291965, 0.157153},
+		{0.241182, 0.692236, 0.066582},
+		{-0.001050, 0.041881, 0.784169},
+	}
+	adobeColorants = [3][3]float64{
+		{0.609741, 0.205276, 0.149185},
+		{0.311111, 0.625671, 0.063217},
+		{0.019470, 0.060867, 0.744568},
+	}
+)
+
+// Эталонный перевод отсчета в sRGB через матрицу линейных значений toSRGB для белой точки D65 и кривую decode
+func referenceSRGB(rgb [3]int, toSRGB [3][3]float64, decode func(float64) float64) [3]int {
+	var res [3]int
+	for i := range res {
+		val := 0.0
+		for k := range 3 {
+			val += toSRGB[i][k] * decode(float64(rgb[k])/255)
+		}
+		res[i] = int(math.Round(srgbEncode(min(max(val, 0), 1)) * 255))
+	}
+	return res
+}
+
+// Декодирование кривой sRGB
+func srgbDecode(val float64) float64 {
+	if val <= 0.04045 {
+		return val / 12.92
+	}
+	return math.Pow((val+0.055)/1.055, 2.4)
+}
+
+func TestICCCurve(t *testing.T) {
+	curves := []struct {
+		name string
+		tag  []byte
+		want func(float64) float64
+	}{
+		{"identity", testCurvTag(), func(x float64) float64 { return x }},
+		{"gamma", testCurvTag(563), func(x float64) float64 { return math.Pow(x, 563.0/256) }},
+		{"table", testCurvTag(0, 0x4000, 0xFFFF), func(x float64) float64 {
+			if x < 0.5 {
+				return x * 0x8000 / 0xFFFF
+			}
+			return (0x4000 + (x-0.5)*2*0xBFFF) / 0xFFFF
+		}},
+		{"para 0", testParaTag(0, 1.8), func(x float64) float64 { return math.Pow(x, 1.8) }},
+		{"para 1", testParaTag(1, 2, 2, -0.5), func(x float64) float64 { return math.Pow(max(2*x-0.5, 0), 2) }},
+		{"para 2", testParaTag(2, 2, 2, -0.5, 0.25), func(x float64) float64 { return math.Pow(max(2*x-0.5, 0), 2) + 0.25 }},
+		{"para 3", srgbParaTag, srgbDecode},
+		{"para 4", testParaTag(4, 2, 1, 0, 0.5, 0.5, 0.125, 0.0625), func(x float64) float64 {
+			if x < 0.5 {
+				return 0.5*x + 0.0625
+			}
+			return x*x + 0.125
+		}},
+	}
+	for _, c := range curves {
+		curve, err := iccCurve(c.tag)
+		if err != nil {
+			t.Fatal(c.name, "iccCurve -> error", err.Error())
+		}
+		for i := range 101 {
+			x := float64(i) / 100
+			if got, want := curve(x), c.want(x); math.Abs(got-want) > 1e-4 {
+				t.Fatalf("%s(%f): %f, expect %f", c.name, x, got, want)
+			}
+		}
+	}
+
+	for _, tag := range [][]byte{testCurvTag()[:8], testCurvTag(1, 2)[:14], testParaTag(5, 1), testParaTag(4, 1, 2), testFixedTag("XYZ ", 1, 2, 3)} {
+		if _, err := iccCurve(tag); err == nil {
+			t.Fatal(string(tag[:4]), "iccCurve -> expect error")
+		}
+	}
+}
+
+func TestColorTransform(t *testing.T) {
+	adobeGamma := 563.0 / 256
+	profiles := []struct {
+		name      string
+		profile   *ICCProfile
+		toSRGB    [3][3]float64
+		decode    func(float64) float64
+		wide      [3]int
+		wideSRGB  [3]int
+		maxErrors int
+	}{
+		{"Display P3", testMatrixICC(p3Colorants, srgbParaTag),
+			[3][3]float64{{1.2249401, -0.2249404, 0}, {-0.0420569, 1.0420571, 0}, {-0.0196376, -0.0786361, 1.0982735}},
+			srgbDecode, [3]int{255, 0, 0}, [3]int{255, 0, 0}, 0},
+		{"Adobe RGB", testMatrixICC(adobeColorants, testCurvTag(563)),
+			[3][3]float64{{1.3982832, -0.3982831, 0}, {0, 1, 0}, {0, -0.0429383, 1.0429383}},
+			func(x float64) float64 { return math.Pow(x, adobeGamma) }, [3]int{0, 255, 0}, [3]int{0, 255, 0}, 0},
+	}
+	for _, p := range profiles {
+		transform, err := NewColorTransform(p.profile)
+		if err != nil {
+			t.Fatal(p.name, "NewColorTransform -> error", err.Error())
+		}
+		if transform.Gray || transform.isIdentity() {
+			t.Fatal(p.name, "Expect RGB transform that changes colors")
+		}
+
+		img := CreateRGBMatrix(1, 7)
+		colors := [][3]int{{0, 0, 0}, {255, 255, 255}, {128, 128, 128}, {200, 100, 50}, {30, 160, 220}, {10, 5, 2}, p.wide}
+		for j, c := range colors {
+			img[0][j] = Rgb{R: byte(c[0]), G: byte(c[1]), B: byte(c[2])}
+		}
+		transform.Apply(img)
+		for j, c := range colors {
+			want := referenceSRGB(c, p.toSRGB, p.decode)
+			got := [3]int{int(img[0][j].R), int(img[0][j].G), int(img[0][j].B)}
+			for k := range 3 {
+				if d := got[k] - want[k]; d > 1 || d < -1 {
+					t.Fatal(p.name, c, "Read:", got, "Expect:", want)
+				}
+			}
+		}
+		//Цвет вне охвата sRGB ограничивается
+		if got := img[0][6]; [3]int{int(got.R), int(got.G), int(got.B)} != p.wideSRGB {
+			t.Fatal(p.name, "wide gamut color:", got, "Expect:", p.wideSRGB)
+		}
+
+		//12-битные отсчеты дают тот же результат в пересчете на 8 бит
+		img16 := CreateRGB16Matrix(1, 1)
+		img16[0][0] = Rgb16{R: 200 << 4, G: 100 << 4, B: 50 << 4}
+		transform.Apply16(img16, 12)
+		want := referenceSRGB([3]int{200, 100, 50}, p.toSRGB, p.decode)
+		for k, val := range []uint16{img16[0][0].R, img16[0][0].G, img16[0][0].B} {
+			if d := float64(val)/4095*255 - float64(want[k]); math.Abs(d) > 1 {
+				t.Fatal(p.name, "12-bit:", img16[0][0], "Expect:", want)
+			}
+		}
+	}
+}
+
+func TestColorTransformGray(t *testing.T) {
+	profile, err := ParseICC(buildTestICC("GRAY", "XYZ", []testICCTag{{"kTRC", testCurvTag(256)}}))
+	if err != nil {
+		t.Fatal("ParseICC -> error", err.Error())
+	}
+	transform, err := NewColorTransform(profile)
+	if err != nil {
+		t.Fatal("NewColorTransform -> error", err.Error())
+	}
+	if !transform.Gray {
+		t.Fatal("Expect gray transform")
+	}
+
+	//Линейные отсчеты кодируются кривой sRGB
+	img := GrayImage{{0, 64, 128, 255}}
+	transform.ApplyGray(img)
+	for j, val := range []int{0, 64, 128, 255} {
+		if want := int(math.Round(srgbEncode(float64(val)/255) * 255)); int(img[0][j]) != want {
+			t.Fatal(val, "Read:", img[0][j], "Expect:", want)
+		}
+	}
+	img16 := Gray16Image{{0, 2048, 4095}}
+	transform.ApplyGray16(img16, 12)
+	for j, val := range []int{0, 2048, 4095} {
+		if want := int(math.Round(srgbEncode(float64(val)/4095) * 4095)); int(img16[0][j]) != want {
+			t.Fatal(val, "Read:", img16[0][j], "Expect:", want)
+		}
+	}
+}
+
+func TestColorTransformErrors(t *testing.T) {
+	if _, err := NewColorTransform(nil); err == nil {
+		t.Fatal("NewColorTransform(nil) -> expect error")
+	}
+	trc := testICCTag{"kTRC", testCurvTag()}
+	bad := map[string][]byte{
+		"CMYK":        buildTestICC("CMYK", "Lab", nil),
+		"Lab PCS":     buildTestICC("RGB", "Lab", nil),
+		"no TRC":      buildTestICC("GRAY", "XYZ", nil),
+		"no colorant": buildTestICC("RGB", "XYZ", []testICCTag{{"rTRC", trc.data}, {"gTRC", trc.data}, {"bTRC", trc.data}}),
+	}
+	for name, data := range bad {
+		profile, err := ParseICC(data)
+		if err != nil {
+			t.Fatal(name, "ParseICC -> error", err.Error())
+		}
+		if _, err := NewColorTransform(profile); err == nil {
+			t.Fatal(name, "NewColorTransform -> expect error")
+		}
+	}
+}
+
+func TestDecodeICC(t *testing.T) {
+	data, err := os.ReadFile(testPics[1])
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("Decode -> error", err.Error())
+	}
+
+	profile := testMatrixICC(p3Colorants, srgbParaTag)
+	tagged := withApp(data, APP2, testICCChunk(1, 1, profile.Data))
+	img, err := Decode(bytes.NewReader(tagged))
+	if err != nil {
+		t.Fatal("Decode -> error", err.Error())
+	}
+	jpeg, err := ReadJPEG(toBufio(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal("ReadJPEG -> error", err.Error())
+	}
+	want, err := jpeg.readAll()
+	if err != nil {
+		t.Fatal("ReadBaseJPEG -> error", err.Error())
+	}
+	transform, err := NewColorTransform(profile)
+	if err != nil {
+		t.Fatal("NewColorTransform -> error", err.Error())
+	}
+	transform.Apply(want)
+	compareImages(t, "Display P3", img, ToRGBA(want), 0, 0)
+
+	kept, err := DecodeWithOptions(bytes.NewReader(tagged), &Options{KeepColorSpace: true})
+	if err != nil {
+		t.Fatal("DecodeWithOptions -> error", err.Error())
+	}
+	compareImages(t, "KeepColorSpace", kept, plain, 0, 0)
+
+	//Профиль sRGB не меняет результат, неподдерживаемый профиль пропускается
+	for name, icc := range map[string][]byte{"sRGB": testICCProfile(t), "CMYK": buildTestICC("CMYK", "Lab", nil)} {
+		img, err := Decode(bytes.NewReader(withApp(data, APP2, testICCChunk(1, 1, icc))))
+		if err != nil {
+			t.Fatal(name, "Decode -> error", err.Error())
+		}
+		compareImages(t, name, img, plain, 0, 0)
+	}
+
+	//Профиль GRAY для изображения в оттенках серого
+	data, err = os.ReadFile("pics/Gray/GrayBaseline.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	grayICC := buildTestICC("GRAY", "XYZ", []testICCTag{{"kTRC", testCurvTag(256)}})
+	img, err = Decode(bytes.NewReader(withApp(data, APP2, testICCChunk(1, 1, grayICC))))
+	if err != nil {
+		t.Fatal("Decode -> error", err.Error())
+	}
+	gray, ok := img.(*image.Gray)
+	if !ok {
+		t.Fatalf("got %T, expect *image.Gray", img)
+	}
+	plain, err = Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("Decode -> error", err.Error())
+	}
+	for i, val := range plain.(*image.Gray).Pix {
+		if want := byte(math.Round(srgbEncode(float64(val)/255) * 255)); gray.Pix[i] != want {
+			t.Fatal("Gray pixel", i, "Read:", gray.Pix[i], "Expect:", want)
+		}
+	}
+}
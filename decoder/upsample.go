@@ -0,0 +1,186 @@
+package decoder
+
+import "math"
+
+// Восстановление прореженных компонент с интерполяцией между соседними отсчетами, в том числе из соседних MCU
+
+// Способ восстановления прореженных компонент
+type Upsampling byte
+
+const (
+	UpsampleNearest  Upsampling = iota //Повторение отсчетов
+	UpsampleFancy                      //Треугольный фильтр libjpeg-turbo для h2v1, h1v2 и h2v2, для остальных повторение
+	UpsampleBilinear                   //Билинейная интерполяция, отсчеты расположены в центрах прореженных пикселей
+)
+
+// Отсчеты компоненты в полосе строки MCU вместе с соседними отсчетами для интерполяции
+type samplePlane struct {
+	samples  [][]int    //Отсчеты в диапазоне 0-maxVal
+	row      int        //Строка первого отсчета полосы в компоненте
+	col      int        //Столбец первого отсчета полосы в компоненте
+	height   int        //Количество доступных строк компоненты, за краем повторяется последний отсчет
+	width    int        //Ширина компоненты в отсчетах
+	filter   Upsampling //Способ восстановления
+	scalingX int        //Увеличение по вертикали
+	scalingY int        //Увеличение по горизонтали
+	delta    int        //Сдвиг на половину диапазона
+}
+
+// Сторона блока компоненты comp после ОДКП и ее увеличение по вертикали и горизонтали
+func (jpeg *JPEG) compScaling(comp *component) (int, int, int) {
+	size := jpeg.Options.Scale.unitSize() //Сторона блока MCU в результате
+	compSize := jpeg.compUnitSize(comp)
+	return compSize, int(jpeg.maxV) * size / (int(comp.v) * compSize), int(jpeg.maxH) * size / (int(comp.h) * compSize)
+}
+
+// Размеры компоненты comp в отсчетах после ОДКП со стороной compSize
+func (jpeg *JPEG) compSampleSize(comp *component, compSize int) (int, int) {
+	height := (int(jpeg.ImageHeight)*int(comp.v)*compSize + int(jpeg.maxV)*unitRowCount - 1) / (int(jpeg.maxV) * unitRowCount)
+	width := (int(jpeg.ImageWidth)*int(comp.h)*compSize + int(jpeg.maxH)*unitColCount - 1) / (int(jpeg.maxH) * unitColCount)
+	return height, width
+}
+
+// Способ восстановления компоненты comp
+func (jpeg *JPEG) compUpsampling(comp *component) Upsampling {
+	compSize, scalingX, scalingY := jpeg.compScaling(comp)
+	if scalingX == 1 && scalingY == 1 {
+		return UpsampleNearest
+	}
+	if jpeg.Options.Upsampling != UpsampleFancy {
+		return jpeg.Options.Upsampling
+	}
+	//Как в libjpeg-turbo: только двукратное увеличение, не при уменьшении в 8 раз и для h2 при ширине больше 2 отсчетов
+	_, width := jpeg.compSampleSize(comp, compSize)
+	if jpeg.Options.Scale == ScaleEighth || scalingX > 2 || scalingY > 2 || scalingY == 2 && width <= 2 {
+		return UpsampleNearest
+	}
+	return UpsampleFancy
+}
+
+// Флаг интерполяции между строками MCU: для вычисления строки нужна прочитанная следующая строка
+// Плоскости YCbCr выводятся без восстановления цветности
+func (jpeg *JPEG) contextRows() bool {
+	if jpeg.ycbcr != nil {
+		return false
+	}
+	for i := range jpeg.numOfComps {
+		comp := &jpeg.comps[i]
+		if _, scalingX, _ := jpeg.compScaling(comp); scalingX > 1 && jpeg.compUpsampling(comp) != UpsampleNearest {
+			return true
+		}
+	}
+	return false
+}
+
+// Отсчеты компоненты ch для строки MCU row и столбцов MCU с firstCol до lastCol
+// Используются только первые decoded строк MCU, nil - компонента восстанавливается повторением
+func (jpeg *JPEG) samplePlane(blocks [][]MCU, ch Channel, row int, firstCol int, lastCol int, decoded int) *samplePlane {
+	comp := &jpeg.comps[ch]
+	filter := jpeg.compUpsampling(comp)
+	if filter == UpsampleNearest {
+		return nil
+	}
+
+	compSize, scalingX, scalingY := jpeg.compScaling(comp)
+	height, width := jpeg.compSampleSize(comp, compSize)
+	height = min(height, decoded*int(comp.v)*compSize)
+	rowStart, rowEnd := row*int(comp.v)*compSize, min((row+1)*int(comp.v)*compSize, height)
+	colStart, colEnd := firstCol*int(comp.h)*compSize, min(lastCol*int(comp.h)*compSize, width)
+	//Соседние отсчеты нужны только в направлениях увеличения
+	if scalingX > 1 {
+		rowStart, rowEnd = max(rowStart-1, 0), min(rowEnd+1, height)
+	}
+	if scalingY > 1 {
+		colStart, colEnd = max(colStart-1, 0), min(colEnd+1, width)
+	}
+
+	p := &samplePlane{
+		samples:  make([][]int, rowEnd-rowStart),
+		row:      rowStart,
+		col:      colStart,
+		height:   height,
+		width:    width,
+		filter:   filter,
+		scalingX: scalingX,
+		scalingY: scalingY,
+		delta:    jpeg.samples.delta,
+	}
+	for i := range p.samples {
+		p.samples[i] = make([]int, colEnd-colStart)
+	}
+
+	var unit idctBlock
+	for blockRow := rowStart / compSize; blockRow*compSize < rowEnd; blockRow++ {
+		for blockCol := colStart / compSize; blockCol*compSize < colEnd; blockCol++ {
+			mcuRow, mcuCol := jpeg.blockPos(comp, blockRow, blockCol)
+			jpeg.unitIDCT(blocks[mcuRow][mcuCol].channel(ch), comp, compSize, &unit)
+			for i := max(blockRow*compSize, rowStart); i < min((blockRow+1)*compSize, rowEnd); i++ {
+				for j := max(blockCol*compSize, colStart); j < min((blockCol+1)*compSize, colEnd); j++ {
+					p.samples[i-rowStart][j-colStart] = jpeg.samples.toSample(unit[i-blockRow*compSize][j-blockCol*compSize])
+				}
+			}
+		}
+	}
+	return p
+}
+
+// Отсчет (row, col) компоненты с повторением крайних отсчетов
+func (p *samplePlane) at(row int, col int) int {
+	row = min(max(row, 0), p.height-1)
+	col = min(max(col, 0), p.width-1)
+	return p.samples[row-p.row][col-p.col]
+}
+
+// Значение компоненты в пикселе (row, col) уменьшенного изображения со сдвигом на половину диапазона, как после ОДКП
+func (p *samplePlane) value(row int, col int) float32 {
+	switch p.filter {
+	case UpsampleBilinear:
+		return p.bilinear(row, col) - float32(p.delta)
+	default:
+		return float32(p.fancy(row, col) - p.delta)
+	}
+}
+
+// Треугольный фильтр libjpeg: ближайший отсчет с весом 3/4, соседний в сторону пикселя с весом 1/4
+// Смещение округления чередуется по четности пикселя, как в libjpeg
+func (p *samplePlane) fancy(row int, col int) int {
+	i, j := row/p.scalingX, col/p.scalingY
+	ni, nj := i, j //Соседние строка и столбец
+	if p.scalingX == 2 {
+		ni = i + row%2*2 - 1
+	}
+	if p.scalingY == 2 {
+		nj = j + col%2*2 - 1
+	}
+
+	switch {
+	case p.scalingX == 1: //h2v1
+		return (3*p.at(i, j) + p.at(i, nj) + 1 + col%2) >> 2
+	case p.scalingY == 1: //h1v2
+		return (3*p.at(i, j) + p.at(ni, j) + 1 + row%2) >> 2
+	default: //h2v2
+		cur := 3*p.at(i, j) + p.at(ni, j)
+		next := 3*p.at(i, nj) + p.at(ni, nj)
+		return (3*cur + next + 8 - col%2) >> 4
+	}
+}
+
+// Билинейная интерполяция между четырьмя ближайшими отсчетами
+func (p *samplePlane) bilinear(row int, col int) float32 {
+	y := (float64(row)+0.5)/float64(p.scalingX) - 0.5
+	x := (float64(col)+0.5)/float64(p.scalingY) - 0.5
+	i, j := int(math.Floor(y)), int(math.Floor(x))
+	fy, fx := float32(y-float64(i)), float32(x-float64(j))
+
+	//Без увеличения по направлению соседний отсчет не нужен и может отсутствовать в полосе
+	ni, nj := i, j
+	if fy > 0 {
+		ni++
+	}
+	if fx > 0 {
+		nj++
+	}
+	top := float32(p.at(i, j))*(1-fx) + float32(p.at(i, nj))*fx
+	bottom := float32(p.at(ni, j))*(1-fx) + float32(p.at(ni, nj))*fx
+	return top*(1-fy) + bottom*fy
+}
@@ -0,0 +1,211 @@
+package decoder
+
+import (
+	"bufio"
+	"bytes"
+	"image"
+	"math/rand"
+	"os"
+	"strconv"
+	"testing"
+)
+
+// Файлы с прореживанием h2v1 и h2v2
+var upsamplePics = []string{
+	"pics/Arithmetic/Progressive.jpg",
+	"pics/Arithmetic/Restart.jpg",
+	"pics/Baseline/Suwa.jpg",
+	"pics/ColorSpace/YCCK.jpg",
+	"pics/Progressive/OddProgressive.jpeg",
+}
+
+// Исходный h2v1_fancy_upsample из libjpeg для строки отсчетов in
+func fancyRowReference(in []int) []int {
+	n := len(in)
+	out := make([]int, 2*n)
+	out[0], out[1] = in[0], (in[0]*3+in[1]+2)>>2
+	for i := 1; i < n-1; i++ {
+		out[2*i] = (in[i]*3 + in[i-1] + 1) >> 2
+		out[2*i+1] = (in[i]*3 + in[i+1] + 2) >> 2
+	}
+	out[2*n-2], out[2*n-1] = (in[n-1]*3+in[n-2]+1)>>2, in[n-1]
+	return out
+}
+
+// Исходный h2v2_fancy_upsample из libjpeg для строки отсчетов cur с соседней строкой near
+func fancyRowsReference(cur []int, near []int) []int {
+	n := len(cur)
+	sums := make([]int, n)
+	for i := range cur {
+		sums[i] = cur[i]*3 + near[i]
+	}
+	out := make([]int, 2*n)
+	out[0], out[1] = (sums[0]*4+8)>>4, (sums[0]*3+sums[1]+7)>>4
+	for i := 1; i < n-1; i++ {
+		out[2*i] = (sums[i]*3 + sums[i-1] + 8) >> 4
+		out[2*i+1] = (sums[i]*3 + sums[i+1] + 7) >> 4
+	}
+	out[2*n-2], out[2*n-1] = (sums[n-1]*3+sums[n-2]+8)>>4, (sums[n-1]*4+7)>>4
+	return out
+}
+
+// Полоса случайных отсчетов height x width с увеличением scalingX x scalingY
+func randomPlane(rnd *rand.Rand, height int, width int, filter Upsampling, scalingX int, scalingY int) *samplePlane {
+	p := &samplePlane{height: height, width: width, filter: filter, scalingX: scalingX, scalingY: scalingY}
+	p.samples = make([][]int, height)
+	for i := range p.samples {
+		p.samples[i] = make([]int, width)
+		for j := range p.samples[i] {
+			p.samples[i][j] = rnd.Intn(256)
+		}
+	}
+	return p
+}
+
+func TestUpsampleFancy(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	const height, width = 5, 7
+
+	p := randomPlane(rnd, height, width, UpsampleFancy, 1, 2)
+	for i := range height {
+		for col, want := range fancyRowReference(p.samples[i]) {
+			if got := int(p.value(i, col)); got != want {
+				t.Fatalf("h2v1 (%d, %d): %d, expect %d", i, col, got, want)
+			}
+		}
+	}
+
+	p = randomPlane(rnd, height, width, UpsampleFancy, 2, 2)
+	for i := range height {
+		above, below := p.samples[max(i-1, 0)], p.samples[min(i+1, height-1)]
+		for k, near := range [][]int{above, below} {
+			for col, want := range fancyRowsReference(p.samples[i], near) {
+				if got := int(p.value(2*i+k, col)); got != want {
+					t.Fatalf("h2v2 (%d, %d): %d, expect %d", 2*i+k, col, got, want)
+				}
+			}
+		}
+	}
+
+	//h1v2 из libjpeg-turbo: верхняя строка пары со смещением 1, нижняя со смещением 2
+	p = randomPlane(rnd, height, width, UpsampleFancy, 2, 1)
+	for i := range height {
+		for j := range width {
+			above, below := p.samples[max(i-1, 0)][j], p.samples[min(i+1, height-1)][j]
+			for k, want := range []int{(p.samples[i][j]*3 + above + 1) >> 2, (p.samples[i][j]*3 + below + 2) >> 2} {
+				if got := int(p.value(2*i+k, j)); got != want {
+					t.Fatalf("h1v2 (%d, %d): %d, expect %d", 2*i+k, j, got, want)
+				}
+			}
+		}
+	}
+}
+
+func TestUpsampleBilinear(t *testing.T) {
+	//Линейная функция восстанавливается точно везде, кроме пикселей у краев
+	p := &samplePlane{height: 4, width: 6, filter: UpsampleBilinear, scalingX: 2, scalingY: 4}
+	for i := range p.height {
+		p.samples = append(p.samples, make([]int, p.width))
+		for j := range p.width {
+			p.samples[i][j] = 16*i + 8*j
+		}
+	}
+	for row := 1; row < 2*p.height-1; row++ {
+		for col := 2; col < 4*p.width-2; col++ {
+			//Центр пикселя (row, col) в отсчетах компоненты
+			want := 16*((float32(row)+0.5)/2-0.5) + 8*((float32(col)+0.5)/4-0.5)
+			if got := p.value(row, col); got != want {
+				t.Fatalf("(%d, %d): %f, expect %f", row, col, got, want)
+			}
+		}
+	}
+}
+
+func TestDecodeUpsampling(t *testing.T) {
+	for _, name := range upsamplePics {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		nearest, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(name, "Decode -> error", err.Error())
+		}
+		for _, upsampling := range []Upsampling{UpsampleFancy, UpsampleBilinear} {
+			testName := name + " upsampling " + strconv.Itoa(int(upsampling))
+			want, err := DecodeWithOptions(bytes.NewReader(data), &Options{Upsampling: upsampling, Workers: 1})
+			if err != nil {
+				t.Fatal(testName, "DecodeWithOptions -> error", err.Error())
+			}
+			//Интерполяция меняет только цветность
+			compareImages(t, testName, want, nearest, 255, 4)
+
+			//Соседние строки MCU доступны при параллельном вычислении и в области
+			img, err := DecodeWithOptions(bytes.NewReader(data), &Options{Upsampling: upsampling, Workers: 3})
+			if err != nil {
+				t.Fatal(testName, "DecodeWithOptions -> error", err.Error())
+			}
+			compareImages(t, testName+" workers", img, want, 0, 0)
+
+			crop := image.Rect(15, 15, 50, 33)
+			img, err = DecodeWithOptions(bytes.NewReader(data), &Options{Upsampling: upsampling, Crop: crop})
+			if err != nil {
+				t.Fatal(testName, "DecodeWithOptions -> error", err.Error())
+			}
+			compareImages(t, testName+" crop", img, cropImage(want, crop), 0, 0)
+		}
+	}
+}
+
+func TestReadBaseJPEGUpsampling(t *testing.T) {
+	data, err := os.ReadFile(restartPics[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := DecodeWithOptions(bytes.NewReader(data), &Options{Upsampling: UpsampleFancy})
+	if err != nil {
+		t.Fatal("DecodeWithOptions -> error", err.Error())
+	}
+
+	//Последняя строка каждой порции пересчитывается после чтения следующей
+	for _, workers := range []int{1, 3} {
+		jpeg, err := ReadJPEG(bufio.NewReader(bytes.NewReader(data)))
+		if err != nil {
+			t.Fatal("ReadJPEG -> error", err.Error())
+		}
+		jpeg.Options = Options{Upsampling: UpsampleFancy, Workers: workers}
+		res := CreateRGBMatrix(jpeg.ImageHeight, jpeg.ImageWidth)
+		for done := false; !done; {
+			if done, err = jpeg.ReadBaseJPEG(res, 40); err != nil {
+				t.Fatal("ReadBaseJPEG -> error", err.Error())
+			}
+		}
+		compareImages(t, restartPics[0]+" workers "+strconv.Itoa(workers), ToRGBA(res), want, 0, 0)
+	}
+}
+
+func TestDecodeUpsamplingErrors(t *testing.T) {
+	data, err := os.ReadFile(upsamplePics[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := DecodeWithOptions(bytes.NewReader(data), &Options{Upsampling: UpsampleBilinear + 1}); err == nil {
+		t.Fatal("DecodeWithOptions with unknown upsampling -> expect error")
+	}
+}
+
+func BenchmarkDecodeUpsampling(b *testing.B) {
+	data, err := os.ReadFile(testPics[0])
+	if err != nil {
+		b.Fatal(err)
+	}
+	for _, upsampling := range []Upsampling{UpsampleNearest, UpsampleFancy, UpsampleBilinear} {
+		b.Run(strconv.Itoa(int(upsampling)), func(b *testing.B) {
+			for range b.N {
+				if _, err := DecodeWithOptions(bytes.NewReader(data), &Options{Upsampling: upsampling}); err != nil {
+					b.Fatal("DecodeWithOptions -> error", err.Error())
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,106 @@
+package decoder
+
+import (
+	"errors"
+	binreader "jpeg/decoder/binReader"
+	"regexp"
+)
+
+// Разбор пакетов XMP из сегментов APP1, в том числе расширенного XMP из нескольких частей
+
+const (
+	xmpHeader         = "http://ns.adobe.com/xap/1.0/\x00"       //Начало данных сегмента APP1 с основным XMP
+	xmpExtendedHeader = "http://ns.adobe.com/xmp/extension/\x00" //Начало данных сегмента APP1 с частью расширенного XMP
+	xmpGUIDLen        = 32                                       //Длина GUID расширенного XMP: MD5 в шестнадцатеричном виде
+	xmpChunkStart     = len(xmpExtendedHeader) + xmpGUIDLen + 8  //Начало части после GUID, полной длины и смещения
+)
+
+// GUID расширенного XMP из атрибута или элемента xmpNote:HasExtendedXMP основного пакета
+var xmpExtendedGUID = regexp.MustCompile(`xmpNote:HasExtendedXMP(?:="|>)([0-9A-Fa-f]{32})`)
+
+// Часть расширенного XMP
+type xmpChunk struct {
+	offset uint32 //Смещение части в расширенном XMP
+	data   []byte //Данные части
+}
+
+// Основной пакет XMP из первого сегмента APP1 с заголовком XMP, пустая строка - нет
+func mainXMP(apps []AppSegment) string {
+	for _, app := range apps {
+		if app.Marker == APP1 && len(app.Data) >= len(xmpHeader) && string(app.Data[:len(xmpHeader)]) == xmpHeader {
+			return string(app.Data[len(xmpHeader):])
+		}
+	}
+	return ""
+}
+
+// Сборка расширенного XMP с идентификатором guid из частей в сегментах APP1
+// Пустой guid - единственный идентификатор среди частей. Возвращает пустую строку без ошибки, если частей нет
+func assembleExtendedXMP(apps []AppSegment, guid string) (string, error) {
+	var length uint32
+	var chunks []xmpChunk
+	for _, app := range apps {
+		data := app.Data
+		if app.Marker != APP1 || len(data) < xmpChunkStart || string(data[:len(xmpExtendedHeader)]) != xmpExtendedHeader {
+			continue
+		}
+		chunkGUID := string(data[len(xmpExtendedHeader) : len(xmpExtendedHeader)+xmpGUIDLen])
+		if guid == "" {
+			guid = chunkGUID
+		}
+		if chunkGUID != guid {
+			continue
+		}
+
+		reader := sliceReader(data, len(xmpExtendedHeader)+xmpGUIDLen, binreader.BIG)
+		fullLength, offset := reader.GetDWord(), reader.GetDWord()
+		if chunks == nil {
+			length = fullLength
+		}
+		if fullLength != length {
+			return "", errors.New("XMP reading error: extended XMP length mismatch")
+		}
+		chunk := data[xmpChunkStart:]
+		if int64(offset)+int64(len(chunk)) > int64(length) {
+			return "", errors.New("XMP reading error: extended XMP chunk out of bounds")
+		}
+		chunks = append(chunks, xmpChunk{offset: offset, data: chunk})
+	}
+	if chunks == nil {
+		return "", nil
+	}
+	total := int64(0)
+	for _, chunk := range chunks {
+		total += int64(len(chunk.data))
+	}
+	if total < int64(length) {
+		return "", errors.New("XMP reading error: missing extended XMP chunk")
+	}
+
+	//Части могут идти в любом порядке, но должны покрыть все данные
+	res := make([]byte, length)
+	filled := make([]bool, length)
+	for _, chunk := range chunks {
+		copy(res[chunk.offset:], chunk.data)
+		for i := range chunk.data {
+			filled[int(chunk.offset)+i] = true
+		}
+	}
+	for _, ok := range filled {
+		if !ok {
+			return "", errors.New("XMP reading error: missing extended XMP chunk")
+		}
+	}
+	return string(res), nil
+}
+
+// Чтение основного и расширенного XMP из прочитанных сегментов
+func (jpeg *JPEG) readXMP() {
+	jpeg.XMP = mainXMP(jpeg.apps)
+	guid := ""
+	if match := xmpExtendedGUID.FindStringSubmatch(jpeg.XMP); match != nil {
+		guid = match[1]
+	}
+	//Поврежденный расширенный XMP не мешает декодированию изображения
+	jpeg.ExtendedXMP, _ = assembleExtendedXMP(jpeg.apps, guid)
+}
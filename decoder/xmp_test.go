@@ -0,0 +1,161 @@
+package decoder
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const testXMPGUID = "0123456789ABCDEF0123456789ABCDEF"
+
+// Основной пакет XMP со ссылкой на расширенный XMP guid
+func testXMPSegment(guid string) []byte {
+	packet := `<x:xmpmeta xmlns:x="adobe:ns:meta/"><rdf:RDF><rdf:Description xmpNote:HasExtendedXMP="` + guid + `"/></rdf:RDF></x:xmpmeta>`
+	return append([]byte(xmpHeader), packet...)
+}
+
+// Часть расширенного XMP guid полной длины length по смещению offset
+func testExtendedXMPChunk(guid string, length int, offset int, chunk string) []byte {
+	res := append([]byte(xmpExtendedHeader), guid...)
+	res = binary.BigEndian.AppendUint32(res, uint32(length))
+	res = binary.BigEndian.AppendUint32(res, uint32(offset))
+	return append(res, chunk...)
+}
+
+// Вставка сегмента COM с текстом comment перед маркером marker, номер вхождения маркера index
+func withComment(t *testing.T, data []byte, marker uint16, index int, comment string) []byte {
+	t.Helper()
+	pos := -1
+	for range index + 1 {
+		next := bytes.Index(data[pos+1:], []byte{byte(marker >> 8), byte(marker)})
+		if next < 0 {
+			t.Fatalf("marker %#04x not found", marker)
+		}
+		pos += next + 1
+	}
+	res := append([]byte{}, data[:pos]...)
+	res = append(res, 0xFF, 0xFE, byte((len(comment)+2)>>8), byte(len(comment)+2))
+	res = append(res, comment...)
+	return append(res, data[pos:]...)
+}
+
+func TestReadJPEGComments(t *testing.T) {
+	for name, sof := range map[string]uint16{"pics/Gray/GrayBaseline.jpg": SOF0, "pics/Gray/GrayProgressive.jpg": SOF2} {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		plain, err := Decode(bytes.NewReader(data))
+		if err != nil {
+			t.Fatal(name, "Decode -> error", err.Error())
+		}
+
+		//Комментарии перед заголовком фрейма и перед первым сканом
+		commented := withComment(t, data, sof, 0, "before frame")
+		commented = withComment(t, commented, SOS, 0, "before scan")
+		jpeg, err := ReadJPEG(toBufio(bytes.NewReader(commented)))
+		if err != nil {
+			t.Fatal(name, "ReadJPEG -> error", err.Error())
+		}
+		if want := []string{"before frame"}; !reflect.DeepEqual(jpeg.Comments, want) {
+			t.Fatal(name, "Read:", jpeg.Comments, "Expect:", want)
+		}
+		res := CreateGrayMatrix(jpeg.OutputSize())
+		if _, err := jpeg.ReadGrayJPEG(res, 0); err != nil {
+			t.Fatal(name, "ReadGrayJPEG -> error", err.Error())
+		}
+		if want := []string{"before frame", "before scan"}; !reflect.DeepEqual(jpeg.Comments, want) {
+			t.Fatal(name, "Read:", jpeg.Comments, "Expect:", want)
+		}
+		compareImages(t, name, ToGray(res), plain, 0, 0)
+	}
+
+	//Комментарий между сканами progressive
+	data, err := os.ReadFile("pics/Gray/GrayProgressive.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	plain, err := Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("Decode -> error", err.Error())
+	}
+	img, err := Decode(bytes.NewReader(withComment(t, data, SOS, 2, "between scans")))
+	if err != nil {
+		t.Fatal("Decode -> error", err.Error())
+	}
+	compareImages(t, "between scans", img, plain, 0, 0)
+}
+
+func TestReadJPEGXMP(t *testing.T) {
+	data, err := os.ReadFile("pics/Gray/GrayBaseline.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	extended := strings.Repeat("<rdf:li>extended</rdf:li>", 20)
+	length := len(extended)
+	other := strings.Repeat("F", xmpGUIDLen)
+
+	//Части идут не по порядку вместе с частью другого расширенного XMP
+	tagged := withApp(data, APP1,
+		testExifSegment(binary.LittleEndian),
+		testXMPSegment(testXMPGUID),
+		testExtendedXMPChunk(testXMPGUID, length, 300, extended[300:]),
+		testExtendedXMPChunk(other, 5, 0, "other"),
+		testExtendedXMPChunk(testXMPGUID, length, 0, extended[:300]),
+	)
+	jpeg, err := ReadJPEG(toBufio(bytes.NewReader(tagged)))
+	if err != nil {
+		t.Fatal("ReadJPEG -> error", err.Error())
+	}
+	if want := string(testXMPSegment(testXMPGUID)[len(xmpHeader):]); jpeg.XMP != want {
+		t.Fatal("Read XMP:", jpeg.XMP, "Expect:", want)
+	}
+	if jpeg.ExtendedXMP != extended {
+		t.Fatal("Read extended XMP:", jpeg.ExtendedXMP, "Expect:", extended)
+	}
+	if jpeg.Exif == nil {
+		t.Fatal("ReadJPEG -> expect EXIF next to XMP")
+	}
+
+	//Без ссылки в основном пакете берется единственный расширенный XMP
+	jpeg, err = ReadJPEG(toBufio(bytes.NewReader(withApp(data, APP1, testExtendedXMPChunk(other, 5, 0, "other")))))
+	if err != nil {
+		t.Fatal("ReadJPEG -> error", err.Error())
+	}
+	if jpeg.XMP != "" || jpeg.ExtendedXMP != "other" {
+		t.Fatal("Read:", jpeg.XMP, jpeg.ExtendedXMP, "Expect: empty XMP and extended XMP other")
+	}
+}
+
+func TestReadJPEGXMPErrors(t *testing.T) {
+	data, err := os.ReadFile("pics/Gray/GrayBaseline.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	bad := map[string][][]byte{
+		"missing": {testXMPSegment(testXMPGUID), testExtendedXMPChunk(testXMPGUID, 10, 0, "01234")},
+		"gap": {testXMPSegment(testXMPGUID), testExtendedXMPChunk(testXMPGUID, 10, 0, "01234"),
+			testExtendedXMPChunk(testXMPGUID, 10, 4, "45678")},
+		"length": {testXMPSegment(testXMPGUID), testExtendedXMPChunk(testXMPGUID, 10, 0, "01234"),
+			testExtendedXMPChunk(testXMPGUID, 11, 5, "56789")},
+		"bounds": {testXMPSegment(testXMPGUID), testExtendedXMPChunk(testXMPGUID, 4, 0, "01234")},
+		"huge":   {testXMPSegment(testXMPGUID), testExtendedXMPChunk(testXMPGUID, 1<<31, 0, "01234")},
+	}
+	for name, apps := range bad {
+		broken := withApp(data, APP1, apps...)
+		jpeg, err := ReadJPEG(toBufio(bytes.NewReader(broken)))
+		if err != nil {
+			t.Fatal(name, "ReadJPEG -> error", err.Error())
+		}
+		if jpeg.XMP == "" || jpeg.ExtendedXMP != "" {
+			t.Fatal(name, "Read:", jpeg.XMP, jpeg.ExtendedXMP, "Expect: main XMP without extended XMP")
+		}
+		//Поврежденный расширенный XMP не мешает декодированию
+		if _, err := Decode(bytes.NewReader(broken)); err != nil {
+			t.Fatal(name, "Decode -> error", err.Error())
+		}
+	}
+}
@@ -0,0 +1,84 @@
+package bitwriter
+
+import "bufio"
+
+type BitWriter struct {
+	dst          *bufio.Writer //Приемник для записи
+	isHuffStream bool          //Флаг записи битового потока Хаффмана (для вставки 0x00 после 0xFF)
+	curByte      byte          //Текущее значение байта для побитовой записи
+	bitCount     byte          //Счетчик записанных бит в текущем байте
+}
+
+// Инициализация объекта BitWriter на приемник dst
+func BitWriterInit(dst *bufio.Writer) *BitWriter {
+	var writer BitWriter
+	writer.dst = dst
+	writer.isHuffStream = false
+	writer.curByte = 0
+	writer.bitCount = 0
+	return &writer
+}
+
+// Запуск записи битового потока Хаффмана
+func (b *BitWriter) HuffStreamStart() {
+	b.curByte = 0
+	b.bitCount = 0
+	b.isHuffStream = true
+}
+
+// Завершение битового потока Хаффмана с дополнением последнего байта
+func (b *BitWriter) HuffStreamEnd() {
+	b.BitsAlign()
+	b.isHuffStream = false
+}
+
+// Запись одного байта
+func (b *BitWriter) PutByte(val byte) {
+	b.dst.WriteByte(val)
+	if b.isHuffStream && val == 0xFF {
+		b.dst.WriteByte(0x00)
+	}
+}
+
+// Запись двух байт в порядке big endian
+func (b *BitWriter) PutWord(val uint16) {
+	b.PutByte(byte(val >> 8))
+	b.PutByte(byte(val))
+}
+
+// Запись массива байт
+func (b *BitWriter) PutArray(data []byte) {
+	for _, val := range data {
+		b.PutByte(val)
+	}
+}
+
+// Запись одного бита
+func (b *BitWriter) PutBit(bit byte) {
+	b.curByte = b.curByte<<1 | bit&1
+	b.bitCount++
+	if b.bitCount == 8 {
+		b.PutByte(b.curByte)
+		b.curByte = 0
+		b.bitCount = 0
+	}
+}
+
+// Запись n младших бит val
+func (b *BitWriter) PutBits(val uint16, n byte) {
+	for i := int(n) - 1; i >= 0; i-- {
+		b.PutBit(byte(val >> uint(i)))
+	}
+}
+
+// Дополнение текущего байта единицами
+func (b *BitWriter) BitsAlign() {
+	for b.bitCount != 0 {
+		b.PutBit(1)
+	}
+}
+
+// Запись буферизованных данных в приемник, возвращает первую ошибку записи
+func (b *BitWriter) Flush() error {
+	return b.dst.Flush()
+}
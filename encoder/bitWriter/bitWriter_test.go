@@ -0,0 +1,55 @@
+package bitwriter
+
+import (
+	"bufio"
+	"bytes"
+	"testing"
+)
+
+// Создание BitWriter с записью в buf
+func newWriter(buf *bytes.Buffer) *BitWriter {
+	return BitWriterInit(bufio.NewWriter(buf))
+}
+
+func TestPutWord(t *testing.T) {
+	var buf bytes.Buffer
+	writer := newWriter(&buf)
+	writer.PutWord(0xFFD8)
+	writer.Flush()
+	if !bytes.Equal(buf.Bytes(), []byte{0xFF, 0xD8}) {
+		t.Fatal("Read:", buf.Bytes(), "Expect:", []byte{0xFF, 0xD8})
+	}
+}
+
+func TestPutBits(t *testing.T) {
+	var buf bytes.Buffer
+	writer := newWriter(&buf)
+	writer.HuffStreamStart()
+	writer.PutBits(0b101, 3)
+	writer.PutBits(0x1F, 5)
+	writer.PutBits(0b11, 2)
+	writer.HuffStreamEnd()
+	writer.Flush()
+
+	//0xBF, затем два бита 11 с дополнением единицами
+	expect := []byte{0xBF, 0xFF, 0x00}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Fatal("Read:", buf.Bytes(), "Expect:", expect)
+	}
+}
+
+func TestByteStuffing(t *testing.T) {
+	var buf bytes.Buffer
+	writer := newWriter(&buf)
+	writer.PutByte(0xFF)
+	writer.HuffStreamStart()
+	writer.PutByte(0xFF)
+	writer.HuffStreamEnd()
+	writer.PutByte(0xFF)
+	writer.Flush()
+
+	expect := []byte{0xFF, 0xFF, 0x00, 0xFF}
+	if !bytes.Equal(buf.Bytes(), expect) {
+		t.Fatal("Read:", buf.Bytes(), "Expect:", expect)
+	}
+}
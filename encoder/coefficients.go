@@ -0,0 +1,171 @@
+package encoder
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"jpeg/decoder"
+	bitwriter "jpeg/encoder/bitWriter"
+)
+
+// Запись готовых квантованных коэффициентов ДКП
+
+const maxComps = 4  //Максимальное количество компонент в кадре
+const maxFactor = 4 //Максимальный фактор прореживания компоненты
+
+// Проверка модулей коэффициентов блока unit в порядке зиг-зага по глубине цвета precision (F.1.2)
+func checkUnit(unit []int16, precision byte) error {
+	if len(unit) != sizeOfTable {
+		return errors.New("Encoding error: block must contain 64 coefficients")
+	}
+	dcLimit := 1<<(precision+3) - 1
+	acLimit := 1<<(precision+2) - 1
+	for k, val := range unit {
+		limit := acLimit
+		if k == 0 {
+			limit = dcLimit
+		}
+		if int(val) > limit || int(val) < -limit {
+			return fmt.Errorf("Encoding error: coefficient %d is out of range", val)
+		}
+	}
+	return nil
+}
+
+// Создание кадра по коэффициентам в порядке зиг-зага
+// Компоненты цветности используют общие таблицы Хаффмана, как при кодировании
+func frameFromCoefficients(coefs *decoder.Coefficients) (*frame, error) {
+	if coefs.SamplePrecision != 8 && coefs.SamplePrecision != 12 {
+		return nil, errors.New("Encoding error: unsupported sample precision")
+	}
+	if coefs.ImageHeight == 0 || coefs.ImageWidth == 0 {
+		return nil, errors.New("Encoding error: empty image")
+	}
+	if len(coefs.Comps) == 0 || len(coefs.Comps) > maxComps {
+		return nil, errors.New("Encoding error: invalid number of components")
+	}
+
+	var f frame
+	f.height = coefs.ImageHeight
+	f.width = coefs.ImageWidth
+	f.precision = coefs.SamplePrecision
+	f.maxH, f.maxV = 1, 1
+	for _, comp := range coefs.Comps {
+		if comp.H == 0 || comp.H > maxFactor || comp.V == 0 || comp.V > maxFactor {
+			return nil, errors.New("Encoding error: invalid sampling factors")
+		}
+		f.maxH = max(f.maxH, comp.H)
+		f.maxV = max(f.maxV, comp.V)
+	}
+	//Единственная компонента всегда записывается неинтерливно
+	if len(coefs.Comps) == 1 && (f.maxH != 1 || f.maxV != 1) {
+		return nil, errors.New("Encoding error: single component must have sampling factors 1x1")
+	}
+	f.mcusHeight = (int(f.height) + unitRowCount*int(f.maxV) - 1) / (unitRowCount * int(f.maxV))
+	f.mcusWidth = (int(f.width) + unitColCount*int(f.maxH) - 1) / (unitColCount * int(f.maxH))
+
+	f.quantTables = coefs.QuantTables[:]
+	for _, table := range f.quantTables {
+		if table == nil {
+			continue
+		}
+		if len(table) != sizeOfTable {
+			return nil, errors.New("Encoding error: quant table must contain 64 values")
+		}
+		for _, val := range table {
+			if val == 0 {
+				return nil, errors.New("Encoding error: zero value in quant table")
+			}
+		}
+	}
+
+	f.comps = make([]component, len(coefs.Comps))
+	for i, comp := range coefs.Comps {
+		if int(comp.QuantTableID) >= len(f.quantTables) || f.quantTables[comp.QuantTableID] == nil {
+			return nil, errors.New("Encoding error: component refers to missing quant table")
+		}
+		if len(comp.Blocks) != f.mcusHeight*int(comp.V) {
+			return nil, fmt.Errorf("Encoding error: component %d must have %d rows of blocks", i, f.mcusHeight*int(comp.V))
+		}
+		for _, row := range comp.Blocks {
+			if len(row) != f.mcusWidth*int(comp.H) {
+				return nil, fmt.Errorf("Encoding error: component %d must have %d columns of blocks", i, f.mcusWidth*int(comp.H))
+			}
+			for _, unit := range row {
+				if err := checkUnit(unit, f.precision); err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		f.comps[i] = component{
+			id:           comp.ID,
+			h:            comp.H,
+			v:            comp.V,
+			tableID:      byte(min(i, 1)),
+			quantTableID: comp.QuantTableID,
+			blocks:       comp.Blocks,
+			blocksHeight: compBlocks(int(f.height), comp.V, f.maxV),
+			blocksWidth:  compBlocks(int(f.width), comp.H, f.maxH),
+		}
+	}
+	return &f, nil
+}
+
+// Запись сегментов приложений
+func (f *frame) writeApps(apps []decoder.AppSegment) {
+	for _, app := range apps {
+		f.putSegmentHeader(app.Marker, len(app.Data))
+		f.writer.PutArray(app.Data)
+	}
+}
+
+// Запись кадра со сканами coefs и оптимальными таблицами Хаффмана
+func (f *frame) writeOptimized(w io.Writer, coefs *decoder.Coefficients) error {
+	var scans []Scan
+	if coefs.IsProgressive {
+		for _, scan := range coefs.Scans {
+			scans = append(scans, Scan{Comps: scan.Comps, Ss: scan.Ss, Se: scan.Se, Ah: scan.Ah, Al: scan.Al})
+		}
+		if scans == nil {
+			scans = DefaultScanScript(len(f.comps))
+		}
+		if err := validateScanScript(scans, len(f.comps)); err != nil {
+			return err
+		}
+	}
+
+	f.writer = bitwriter.BitWriterInit(bufio.NewWriter(w))
+	f.writer.PutWord(SOI)
+	f.writeApps(coefs.Apps)
+	f.writeQuantTables()
+	if coefs.IsProgressive {
+		f.writeFrameHeader(SOF2)
+		for _, scan := range scans {
+			f.writeProgressiveScan(scan)
+		}
+	} else {
+		//Baseline допускает только 8-битные отсчеты
+		if f.precision == 8 {
+			f.writeFrameHeader(SOF0)
+		} else {
+			f.writeFrameHeader(SOF1)
+		}
+		f.writeOptimizedBaselineScan()
+	}
+	f.writer.PutWord(EOI)
+	return f.writer.Flush()
+}
+
+// Запись квантованных коэффициентов coefs в JPEG с оптимальными таблицами Хаффмана
+// Прогрессивное изображение записывается по скрипту coefs.Scans, при его отсутствии - по скрипту по умолчанию
+// Сегменты coefs.Apps записываются без изменений
+func WriteCoefficients(w io.Writer, coefs *decoder.Coefficients) error {
+	coefs = coefs.InOrder(decoder.ZigZagOrder)
+	f, err := frameFromCoefficients(coefs)
+	if err != nil {
+		return err
+	}
+	return f.writeOptimized(w, coefs)
+}
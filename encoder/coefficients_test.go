@@ -0,0 +1,67 @@
+package encoder
+
+import (
+	"bytes"
+	stdjpeg "image/jpeg"
+	"jpeg/decoder"
+	"os"
+	"testing"
+)
+
+func TestWriteCoefficients(t *testing.T) {
+	data, err := os.ReadFile(graySource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	coefs := parseCoefficients(t, graySource, data)
+	coefs = coefs.InOrder(decoder.NaturalOrder)
+
+	//Без AC коэффициентов каждый блок заполняется одним значением
+	for _, row := range coefs.Comps[0].Blocks {
+		for _, unit := range row {
+			clear(unit[1:])
+		}
+	}
+	for _, progressive := range []bool{false, true} {
+		coefs.IsProgressive = progressive
+		coefs.Scans = nil
+		var buf bytes.Buffer
+		if err := WriteCoefficients(&buf, coefs); err != nil {
+			t.Fatal("WriteCoefficients -> error", err.Error())
+		}
+		img, err := stdjpeg.Decode(bytes.NewReader(buf.Bytes()))
+		if err != nil {
+			t.Fatal("image/jpeg.Decode -> error", err.Error())
+		}
+		b := img.Bounds()
+		for y := b.Min.Y; y < b.Max.Y; y++ {
+			for x := b.Min.X; x < b.Max.X; x++ {
+				if img.At(x, y) != img.At(x/unitColCount*unitColCount, y/unitRowCount*unitRowCount) {
+					t.Fatalf("Progressive %t: pixel (%d, %d) differs from its block", progressive, x, y)
+				}
+			}
+		}
+	}
+}
+
+func TestWriteCoefficientsErrors(t *testing.T) {
+	data, err := os.ReadFile(graySource)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := map[string]func(c *decoder.Coefficients){
+		"missing row":       func(c *decoder.Coefficients) { c.Comps[0].Blocks = c.Comps[0].Blocks[1:] },
+		"short block":       func(c *decoder.Coefficients) { c.Comps[0].Blocks[0][0] = c.Comps[0].Blocks[0][0][:10] },
+		"large coefficient": func(c *decoder.Coefficients) { c.Comps[0].Blocks[0][0][5] = 2000 },
+		"missing table":     func(c *decoder.Coefficients) { c.Comps[0].QuantTableID = 3 },
+		"sampling":          func(c *decoder.Coefficients) { c.Comps[0].H = 2 },
+		"precision":         func(c *decoder.Coefficients) { c.SamplePrecision = 10 },
+	}
+	for name, spoil := range cases {
+		coefs := parseCoefficients(t, graySource, data)
+		spoil(coefs)
+		if err := WriteCoefficients(&bytes.Buffer{}, coefs); err == nil {
+			t.Fatal(name, "-> expect error")
+		}
+	}
+}
@@ -0,0 +1,446 @@
+package encoder
+
+import (
+	"bufio"
+	"errors"
+	"image"
+	"io"
+	"jpeg/decoder"
+	bitwriter "jpeg/encoder/bitWriter"
+)
+
+// Маркеры записываемых заголовков
+const (
+	SOI  uint16 = 0xFFD8
+	EOI  uint16 = 0xFFD9
+	SOF0 uint16 = 0xFFC0
+	SOF1 uint16 = 0xFFC1
+	SOF2 uint16 = 0xFFC2
+	APP0 uint16 = 0xFFE0
+	DQT  uint16 = 0xFFDB
+	DHT  uint16 = 0xFFC4
+	SOS  uint16 = 0xFFDA
+)
+
+const DefaultQuality = 75 //Качество по умолчанию
+const maxSize = 0xFFFF    //Максимальный размер стороны изображения
+
+// Прореживание цветовых компонент
+type Subsampling byte
+
+const (
+	Subsample420 Subsampling = iota //Цветность в половинном разрешении по обеим осям
+	Subsample422                    //Цветность в половинном разрешении по горизонтали
+	Subsample444                    //Без прореживания
+)
+
+// Параметры кодирования
+type Options struct {
+	Quality     int         //Качество 1-100 по шкале IJG
+	Subsampling Subsampling //Прореживание цветовых компонент
+	Progressive bool        //Прогрессивное кодирование
+	Scans       []Scan      //Скрипт сканов для прогрессивного кодирования, nil - скрипт libjpeg по умолчанию
+}
+
+// Структура цветовой компоненты кадра
+type component struct {
+	id           byte        //Идентификатор компоненты
+	h            byte        //Горизонтальный фактор
+	v            byte        //Вертикальный фактор
+	tableID      byte        //Номер таблиц Хаффмана (0 - яркость, 1 - цветность)
+	quantTableID byte        //Номер таблицы квантования
+	blocks       [][][]int16 //Квантованные коэффициенты блоков в порядке зиг-зага
+	blocksHeight int         //Количество блоков компоненты по высоте (для неинтерливных сканов)
+	blocksWidth  int         //Количество блоков компоненты по ширине (для неинтерливных сканов)
+}
+
+// Структура кадра с квантованными коэффициентами
+type frame struct {
+	height      uint16               //Высота изображения
+	width       uint16               //Ширина изображения
+	precision   byte                 //Глубина цвета в битах на отсчет
+	maxH        byte                 //Максимальный H фактор
+	maxV        byte                 //Максимальный V фактор
+	mcusHeight  int                  //Количество MCU по высоте
+	mcusWidth   int                  //Количество MCU по ширине
+	comps       []component          //Компоненты кадра
+	quantTables [][]uint16           //Таблицы квантования в порядке зиг-зага по номерам, nil для незаданных
+	writer      *bitwriter.BitWriter //Объект для записи файла
+}
+
+// Проверка параметров кодирования, nil заменяется значениями по умолчанию
+func checkOptions(o *Options) (Options, error) {
+	if o == nil {
+		return Options{Quality: DefaultQuality, Subsampling: Subsample420}, nil
+	}
+	if o.Quality < 1 || o.Quality > 100 {
+		return Options{}, errors.New("Encoding error: quality must be in range 1-100")
+	}
+	if o.Subsampling > Subsample444 {
+		return Options{}, errors.New("Encoding error: unknown subsampling")
+	}
+	return *o, nil
+}
+
+// Факторы компоненты яркости для прореживания
+func (s Subsampling) lumaFactors() (byte, byte) {
+	switch s {
+	case Subsample420:
+		return 2, 2
+	case Subsample422:
+		return 2, 1
+	default:
+		return 1, 1
+	}
+}
+
+// Перевод Image в плоскости YCbCr, сдвинутые на 128
+func planesFromImage(img decoder.Image) [][][]float32 {
+	planes := make([][][]float32, 3)
+	for c := range planes {
+		planes[c] = make([][]float32, len(img))
+	}
+	for i := range img {
+		for c := range planes {
+			planes[c][i] = make([]float32, len(img[i]))
+		}
+		for j, px := range img[i] {
+			r, g, b := float32(px.R), float32(px.G), float32(px.B)
+			planes[0][i][j] = 0.299*r + 0.587*g + 0.114*b - 128
+			planes[1][i][j] = -0.168736*r - 0.331264*g + 0.5*b
+			planes[2][i][j] = 0.5*r - 0.418688*g - 0.081312*b
+		}
+	}
+	return planes
+}
+
+// Перевод GrayImage в плоскость яркости, сдвинутую на 128
+func planesFromGray(img decoder.GrayImage) [][][]float32 {
+	plane := make([][]float32, len(img))
+	for i := range img {
+		plane[i] = make([]float32, len(img[i]))
+		for j, val := range img[i] {
+			plane[i][j] = float32(val) - 128
+		}
+	}
+	return [][][]float32{plane}
+}
+
+// Создание кадра по плоскостям компонент исходного разрешения
+func newFrame(planes [][][]float32, o Options) (*frame, error) {
+	if len(planes[0]) == 0 || len(planes[0][0]) == 0 {
+		return nil, errors.New("Encoding error: empty image")
+	}
+	if len(planes[0]) > maxSize || len(planes[0][0]) > maxSize {
+		return nil, errors.New("Encoding error: image is too large")
+	}
+
+	var f frame
+	f.height = uint16(len(planes[0]))
+	f.width = uint16(len(planes[0][0]))
+	f.precision = 8
+	f.maxH, f.maxV = 1, 1
+	if len(planes) > 1 {
+		f.maxH, f.maxV = o.Subsampling.lumaFactors()
+	}
+	f.mcusHeight = (int(f.height) + unitRowCount*int(f.maxV) - 1) / (unitRowCount * int(f.maxV))
+	f.mcusWidth = (int(f.width) + unitColCount*int(f.maxH) - 1) / (unitColCount * int(f.maxH))
+
+	f.quantTables = make([][]uint16, min(len(planes), 2))
+	for i := range f.quantTables {
+		f.quantTables[i] = scaleQuantTable(&baseQuantTables[i], o.Quality)
+	}
+
+	f.comps = make([]component, len(planes))
+	for i := range f.comps {
+		comp := &f.comps[i]
+		comp.id = byte(i + 1)
+		comp.h, comp.v = 1, 1
+		if i == 0 {
+			comp.h, comp.v = f.maxH, f.maxV
+		} else {
+			comp.tableID = 1
+		}
+		comp.quantTableID = comp.tableID
+		f.transformComponent(comp, planes[i])
+	}
+	return &f, nil
+}
+
+// Количество блоков компоненты с фактором factor по стороне size
+func compBlocks(size int, factor byte, maxFactor byte) int {
+	compSize := (size*int(factor) + int(maxFactor) - 1) / int(maxFactor)
+	return (compSize + unitRowCount - 1) / unitRowCount
+}
+
+// Прореживание плоскости компоненты comp, ДКП и квантование ее блоков
+// Плоскость дополняется до целого количества MCU повторением крайних отсчетов
+func (f *frame) transformComponent(comp *component, plane [][]float32) {
+	scaleV := int(f.maxV / comp.v)
+	scaleH := int(f.maxH / comp.h)
+	comp.blocksHeight = compBlocks(int(f.height), comp.v, f.maxV)
+	comp.blocksWidth = compBlocks(int(f.width), comp.h, f.maxH)
+	blocksHeight := f.mcusHeight * int(comp.v)
+	blocksWidth := f.mcusWidth * int(comp.h)
+	quant := f.quantTables[comp.quantTableID]
+
+	//Среднее значение отсчетов, попадающих в отсчет компоненты (i, j)
+	sample := func(i int, j int) float32 {
+		var sum float32
+		for y := range scaleV {
+			row := plane[min(i*scaleV+y, int(f.height)-1)]
+			for x := range scaleH {
+				sum += row[min(j*scaleH+x, int(f.width)-1)]
+			}
+		}
+		return sum / float32(scaleV*scaleH)
+	}
+
+	comp.blocks = make([][][]int16, blocksHeight)
+	var unit [unitRowCount][unitColCount]float32
+	for row := range blocksHeight {
+		comp.blocks[row] = make([][]int16, blocksWidth)
+		for col := range blocksWidth {
+			for x := range unitRowCount {
+				for y := range unitColCount {
+					unit[x][y] = sample(row*unitRowCount+x, col*unitColCount+y)
+				}
+			}
+			comp.blocks[row][col] = ForwardCosin(&unit, quant)
+		}
+	}
+}
+
+// Запись маркера с сегментом длины ln (без учета маркера)
+func (f *frame) putSegmentHeader(marker uint16, ln int) {
+	f.writer.PutWord(marker)
+	f.writer.PutWord(uint16(ln + 2))
+}
+
+// Запись сегмента JFIF APP0
+func (f *frame) writeJFIF() {
+	f.putSegmentHeader(APP0, 14)
+	f.writer.PutArray([]byte("JFIF\x00"))
+	f.writer.PutWord(0x0101) //Версия 1.01
+	f.writer.PutByte(0)      //Плотность без единиц измерения
+	f.writer.PutWord(1)
+	f.writer.PutWord(1)
+	f.writer.PutWord(0) //Без миниатюры
+}
+
+// Точность элементов таблицы квантования: 0 - 8 бит, 1 - 16 бит
+func quantPrecision(table []uint16) byte {
+	for _, val := range table {
+		if val > 0xFF {
+			return 1
+		}
+	}
+	return 0
+}
+
+// Запись таблиц квантования
+func (f *frame) writeQuantTables() {
+	ln := 0
+	for _, table := range f.quantTables {
+		if table != nil {
+			ln += 1 + sizeOfTable*int(quantPrecision(table)+1)
+		}
+	}
+	f.putSegmentHeader(DQT, ln)
+	for i, table := range f.quantTables {
+		if table == nil {
+			continue
+		}
+		pq := quantPrecision(table)
+		f.writer.PutByte(pq<<4 | byte(i))
+		for _, val := range table {
+			if pq == 0 {
+				f.writer.PutByte(byte(val))
+			} else {
+				f.writer.PutWord(val)
+			}
+		}
+	}
+}
+
+// Запись заголовка кадра с маркером marker
+func (f *frame) writeFrameHeader(marker uint16) {
+	f.putSegmentHeader(marker, 6+3*len(f.comps))
+	f.writer.PutByte(f.precision)
+	f.writer.PutWord(f.height)
+	f.writer.PutWord(f.width)
+	f.writer.PutByte(byte(len(f.comps)))
+	for _, comp := range f.comps {
+		f.writer.PutByte(comp.id)
+		f.writer.PutByte(comp.h<<4 | comp.v)
+		f.writer.PutByte(comp.quantTableID)
+	}
+}
+
+// Запись таблицы Хаффмана класса tc с номером th
+func (f *frame) writeHuffTable(tc byte, th byte, spec *huffSpec) {
+	f.putSegmentHeader(DHT, 1+numHuffCodesLen+len(spec.symbols))
+	f.writer.PutByte(tc<<4 | th)
+	f.writer.PutArray(spec.counts[:])
+	f.writer.PutArray(spec.symbols)
+}
+
+// Запись заголовка скана по компонентам comps
+func (f *frame) writeScanHeader(comps []int, ss byte, se byte, ah byte, al byte) {
+	f.putSegmentHeader(SOS, 4+2*len(comps))
+	f.writer.PutByte(byte(len(comps)))
+	for _, i := range comps {
+		f.writer.PutByte(f.comps[i].id)
+		f.writer.PutByte(f.comps[i].tableID<<4 | f.comps[i].tableID)
+	}
+	f.writer.PutByte(ss)
+	f.writer.PutByte(se)
+	f.writer.PutByte(ah<<4 | al)
+}
+
+// Номера таблиц Хаффмана, используемых компонентами кадра
+func (f *frame) huffTableIDs() []byte {
+	if len(f.comps) > 1 {
+		return []byte{0, 1}
+	}
+	return []byte{0}
+}
+
+// Обход блоков компонент comps в порядке интерливного скана
+func (f *frame) walkMCUs(comps []int, visit func(unit []int16, i int)) {
+	for mcuRow := range f.mcusHeight {
+		for mcuCol := range f.mcusWidth {
+			for _, i := range comps {
+				comp := &f.comps[i]
+				for curV := range int(comp.v) {
+					for curH := range int(comp.h) {
+						visit(comp.blocks[mcuRow*int(comp.v)+curV][mcuCol*int(comp.h)+curH], i)
+					}
+				}
+			}
+		}
+	}
+}
+
+// Номера всех компонент кадра
+func (f *frame) allComps() []int {
+	comps := make([]int, len(f.comps))
+	for i := range comps {
+		comps[i] = i
+	}
+	return comps
+}
+
+// Запись интерливного скана со всеми коэффициентами таблицами Хаффмана по номерам таблиц
+func (f *frame) writeBaselineScan(dcTables [2]*huffEncoder, acTables [2]*huffEncoder) {
+	comps := f.allComps()
+	f.writeScanHeader(comps, 0, sizeOfTable-1, 0, 0)
+
+	prev := make([]int, len(f.comps)) //Предыдущие значения DC для дельта кодирования
+	f.writer.HuffStreamStart()
+	f.walkMCUs(comps, func(unit []int16, i int) {
+		id := f.comps[i].tableID
+		dcTables[id].putDC(f.writer, int(unit[0])-prev[i])
+		prev[i] = int(unit[0])
+		acTables[id].putAC(f.writer, unit, 1, sizeOfTable-1)
+	})
+	f.writer.HuffStreamEnd()
+}
+
+// Запись файла: baseline или progressive по параметрам o
+func (f *frame) write(w io.Writer, o Options) error {
+	var scans []Scan
+	if o.Progressive {
+		scans = o.Scans
+		if scans == nil {
+			scans = DefaultScanScript(len(f.comps))
+		}
+		if err := validateScanScript(scans, len(f.comps)); err != nil {
+			return err
+		}
+	}
+
+	f.writer = bitwriter.BitWriterInit(bufio.NewWriter(w))
+	f.writer.PutWord(SOI)
+	f.writeJFIF()
+	f.writeQuantTables()
+	if o.Progressive {
+		f.writeFrameHeader(SOF2)
+		for _, scan := range scans {
+			f.writeProgressiveScan(scan)
+		}
+	} else {
+		f.writeFrameHeader(SOF0)
+		var dcTables, acTables [2]*huffEncoder
+		for _, id := range f.huffTableIDs() {
+			f.writeHuffTable(0, id, &stdDCSpecs[id])
+			f.writeHuffTable(1, id, &stdACSpecs[id])
+			dcTables[id] = makeHuffEncoder(&stdDCSpecs[id])
+			acTables[id] = makeHuffEncoder(&stdACSpecs[id])
+		}
+		f.writeBaselineScan(dcTables, acTables)
+	}
+	f.writer.PutWord(EOI)
+	return f.writer.Flush()
+}
+
+// Кодирование изображения RGB в JPEG, o = nil - baseline с параметрами по умолчанию
+func EncodeImage(w io.Writer, img decoder.Image, o *Options) error {
+	opts, err := checkOptions(o)
+	if err != nil {
+		return err
+	}
+	f, err := newFrame(planesFromImage(img), opts)
+	if err != nil {
+		return err
+	}
+	return f.write(w, opts)
+}
+
+// Кодирование изображения в оттенках серого в JPEG с одной компонентой
+func EncodeGray(w io.Writer, img decoder.GrayImage, o *Options) error {
+	opts, err := checkOptions(o)
+	if err != nil {
+		return err
+	}
+	f, err := newFrame(planesFromGray(img), opts)
+	if err != nil {
+		return err
+	}
+	return f.write(w, opts)
+}
+
+// Кодирование image.Image в JPEG
+// *image.Gray кодируется одной компонентой, остальные изображения переводятся в RGB
+func Encode(w io.Writer, img image.Image, o *Options) error {
+	if b := img.Bounds(); b.Dx() > maxSize || b.Dy() > maxSize {
+		return errors.New("Encoding error: image is too large")
+	}
+	if gray, ok := img.(*image.Gray); ok {
+		return EncodeGray(w, grayFromImage(gray), o)
+	}
+	return EncodeImage(w, rgbFromImage(img), o)
+}
+
+// Перевод image.Image в Image
+func rgbFromImage(img image.Image) decoder.Image {
+	b := img.Bounds()
+	res := decoder.CreateRGBMatrix(uint16(b.Dy()), uint16(b.Dx()))
+	for i := range res {
+		for j := range res[i] {
+			r, g, bl, _ := img.At(b.Min.X+j, b.Min.Y+i).RGBA()
+			res[i][j] = decoder.Rgb{R: byte(r >> 8), G: byte(g >> 8), B: byte(bl >> 8)}
+		}
+	}
+	return res
+}
+
+// Перевод *image.Gray в GrayImage
+func grayFromImage(img *image.Gray) decoder.GrayImage {
+	b := img.Bounds()
+	res := decoder.CreateGrayMatrix(uint16(b.Dy()), uint16(b.Dx()))
+	for i := range res {
+		copy(res[i], img.Pix[i*img.Stride:i*img.Stride+len(res[i])])
+	}
+	return res
+}
@@ -0,0 +1,196 @@
+package encoder
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	stdjpeg "image/jpeg"
+	"jpeg/decoder"
+	"math"
+	"os"
+	"testing"
+)
+
+// Файлы, изображения из которых кодируются в тестах
+const (
+	colorSource = "../decoder/pics/Arithmetic/SequentialHuffman.jpg"
+	graySource  = "../decoder/pics/Gray/GrayBaseline.jpg"
+)
+
+// Чтение исходного изображения эталонным декодером
+func readSource(t *testing.T, name string) image.Image {
+	t.Helper()
+	file, err := os.Open(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+
+	img, err := stdjpeg.Decode(file)
+	if err != nil {
+		t.Fatal("image/jpeg.Decode -> error", err.Error())
+	}
+	return img
+}
+
+// PSNR по каналам RGB между двумя изображениями одного размера
+func psnr(got image.Image, want image.Image) float64 {
+	b := want.Bounds()
+	var sum float64
+	for y := b.Min.Y; y < b.Max.Y; y++ {
+		for x := b.Min.X; x < b.Max.X; x++ {
+			r1, g1, b1, _ := got.At(x, y).RGBA()
+			r2, g2, b2, _ := want.At(x, y).RGBA()
+			for _, d := range [3]float64{float64(r1>>8) - float64(r2>>8), float64(g1>>8) - float64(g2>>8), float64(b1>>8) - float64(b2>>8)} {
+				sum += d * d
+			}
+		}
+	}
+	mse := sum / float64(3*b.Dx()*b.Dy())
+	return 10 * math.Log10(255*255/mse)
+}
+
+// Декодирование результата эталонным декодером и нашим, проверка качества
+func checkEncoded(t *testing.T, name string, data []byte, src image.Image, minPSNR float64) {
+	t.Helper()
+	std, err := stdjpeg.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(name, "image/jpeg.Decode -> error", err.Error())
+	}
+	if std.Bounds() != src.Bounds() {
+		t.Fatalf("%s: bounds %v, expect %v", name, std.Bounds(), src.Bounds())
+	}
+	if val := psnr(std, src); val < minPSNR {
+		t.Fatalf("%s: PSNR %f, expect at least %f", name, val, minPSNR)
+	}
+
+	own, err := decoder.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(name, "decoder.Decode -> error", err.Error())
+	}
+	if val := psnr(own, std); val < 40 {
+		t.Fatalf("%s: decoders differ, PSNR %f", name, val)
+	}
+}
+
+func TestEncodeSubsampling(t *testing.T) {
+	src := readSource(t, colorSource)
+	names := map[Subsampling]string{Subsample420: "4:2:0", Subsample422: "4:2:2", Subsample444: "4:4:4"}
+	for sub, name := range names {
+		var buf bytes.Buffer
+		if err := Encode(&buf, src, &Options{Quality: 90, Subsampling: sub}); err != nil {
+			t.Fatal(name, "Encode -> error", err.Error())
+		}
+		checkEncoded(t, name, buf.Bytes(), src, 30)
+	}
+}
+
+func TestEncodeGray(t *testing.T) {
+	src := readSource(t, graySource)
+	var buf bytes.Buffer
+	if err := Encode(&buf, src, nil); err != nil {
+		t.Fatal("Encode -> error", err.Error())
+	}
+	checkEncoded(t, "gray", buf.Bytes(), src, 30)
+
+	cfg, err := stdjpeg.DecodeConfig(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal("image/jpeg.DecodeConfig -> error", err.Error())
+	}
+	if cfg.ColorModel != color.GrayModel {
+		t.Fatal("Read color model:", cfg.ColorModel, "Expect: gray")
+	}
+}
+
+func TestEncodeImage(t *testing.T) {
+	//Изображение нечетного размера, не кратного MCU
+	img := decoder.CreateRGBMatrix(13, 21)
+	for i := range img {
+		for j := range img[i] {
+			img[i][j] = decoder.Rgb{R: byte(i * 19), G: byte(j * 12), B: byte((i + j) * 7)}
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := EncodeImage(&buf, img, &Options{Quality: 100, Subsampling: Subsample444}); err != nil {
+		t.Fatal("EncodeImage -> error", err.Error())
+	}
+	checkEncoded(t, "image", buf.Bytes(), decoder.ToRGBA(img), 40)
+}
+
+func TestEncodeQuality(t *testing.T) {
+	src := readSource(t, colorSource)
+	sizes := make([]int, 0, 3)
+	for _, quality := range []int{10, 50, 95} {
+		var buf bytes.Buffer
+		if err := Encode(&buf, src, &Options{Quality: quality}); err != nil {
+			t.Fatal("Encode -> error", err.Error())
+		}
+		sizes = append(sizes, buf.Len())
+	}
+	if sizes[0] >= sizes[1] || sizes[1] >= sizes[2] {
+		t.Fatal("File sizes are not increasing with quality:", sizes)
+	}
+
+	for _, quality := range []int{0, 101} {
+		if err := Encode(&bytes.Buffer{}, src, &Options{Quality: quality}); err == nil {
+			t.Fatal("Encode with quality", quality, "-> expect error")
+		}
+	}
+}
+
+func TestEncodeProgressive(t *testing.T) {
+	src := readSource(t, colorSource)
+	names := map[Subsampling]string{Subsample420: "4:2:0", Subsample422: "4:2:2", Subsample444: "4:4:4"}
+	for sub, name := range names {
+		var buf bytes.Buffer
+		if err := Encode(&buf, src, &Options{Quality: 90, Subsampling: sub, Progressive: true}); err != nil {
+			t.Fatal(name, "Encode -> error", err.Error())
+		}
+		checkEncoded(t, name, buf.Bytes(), src, 30)
+	}
+
+	gray := readSource(t, graySource)
+	var buf bytes.Buffer
+	if err := Encode(&buf, gray, &Options{Quality: 90, Progressive: true}); err != nil {
+		t.Fatal("gray Encode -> error", err.Error())
+	}
+	checkEncoded(t, "gray", buf.Bytes(), gray, 30)
+}
+
+func TestEncodeScanScript(t *testing.T) {
+	src := readSource(t, colorSource)
+	//DC каждой компоненты отдельным сканом, спектральная селекция и уточнение AC яркости
+	scans := []Scan{
+		{Comps: []int{0}, Al: 1},
+		{Comps: []int{1}},
+		{Comps: []int{2}},
+		{Comps: []int{0}, Ss: 1, Se: 9, Al: 2},
+		{Comps: []int{0}, Ss: 10, Se: 63, Al: 2},
+		{Comps: []int{1}, Ss: 1, Se: 63},
+		{Comps: []int{2}, Ss: 1, Se: 63},
+		{Comps: []int{0}, Ah: 1},
+		{Comps: []int{0}, Ss: 1, Se: 63, Ah: 2, Al: 1},
+		{Comps: []int{0}, Ss: 1, Se: 63, Ah: 1},
+	}
+	var buf bytes.Buffer
+	if err := Encode(&buf, src, &Options{Quality: 90, Progressive: true, Scans: scans}); err != nil {
+		t.Fatal("Encode -> error", err.Error())
+	}
+	checkEncoded(t, "script", buf.Bytes(), src, 30)
+
+	invalid := map[string][]Scan{
+		"empty":         {},
+		"no chroma DC":  {{Comps: []int{0}}},
+		"AC before DC":  {{Comps: []int{0}, Ss: 1, Se: 63}, {Comps: []int{0, 1, 2}}},
+		"interleave AC": {{Comps: []int{0, 1, 2}}, {Comps: []int{0, 1}, Ss: 1, Se: 63}},
+		"bad refine":    {{Comps: []int{0, 1, 2}, Al: 1}, {Comps: []int{0, 1, 2}, Ah: 2, Al: 1}},
+		"bad order":     {{Comps: []int{2, 1, 0}}},
+	}
+	for name, script := range invalid {
+		err := Encode(&bytes.Buffer{}, src, &Options{Progressive: true, Scans: script})
+		if err == nil {
+			t.Fatal(name, "-> expect error")
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package encoder
+
+import "math"
+
+// Таблица с коэффициентами в ДКП: C(u) * cos((2x + 1) * u * pi / 16)
+var dctTable [8][8]float64
+
+func init() {
+	for u := range unitRowCount {
+		c := 1.0
+		if u == 0 {
+			c = math.Sqrt2 / 2
+		}
+		for x := range unitColCount {
+			dctTable[u][x] = c * math.Cos(float64((2*x+1)*u)*math.Pi/16)
+		}
+	}
+}
+
+// Прямое дискретно-косинусное преобразование блока со сдвинутыми на 128 отсчетами
+// Вычисляется по строкам, затем по столбцам
+func fdctCalc(unit *[unitRowCount][unitColCount]float32) [unitRowCount][unitColCount]float64 {
+	var rows [unitRowCount][unitColCount]float64
+	for x := range unitRowCount {
+		for v := range unitColCount {
+			sum := 0.0
+			for y := range unitColCount {
+				sum += float64(unit[x][y]) * dctTable[v][y]
+			}
+			rows[x][v] = sum
+		}
+	}
+
+	var res [unitRowCount][unitColCount]float64
+	for u := range unitRowCount {
+		for v := range unitColCount {
+			sum := 0.0
+			for x := range unitRowCount {
+				sum += rows[x][v] * dctTable[u][x]
+			}
+			res[u][v] = 0.25 * sum
+		}
+	}
+	return res
+}
+
+// Прямое ДКП и квантование блока, результат в порядке зиг-зага
+func ForwardCosin(unit *[unitRowCount][unitColCount]float32, quantTable []uint16) []int16 {
+	coefs := fdctCalc(unit)
+	res := make([]int16, sizeOfTable)
+	for u := range unitRowCount {
+		for v := range unitColCount {
+			k := zigZagTable[u][v]
+			res[k] = int16(math.Round(coefs[u][v] / float64(quantTable[k])))
+		}
+	}
+	return res
+}
@@ -0,0 +1,197 @@
+package encoder
+
+import (
+	bitwriter "jpeg/encoder/bitWriter"
+	"math/bits"
+)
+
+// Код Хаффмана символа
+type huffCode struct {
+	code uint16 //Значение кода
+	size byte   //Длина кода, 0 если символа нет в таблице
+}
+
+// Таблица кодов Хаффмана по символам
+type huffEncoder [256]huffCode
+
+// Восстановление канонических кодов по описанию таблицы
+func makeHuffEncoder(spec *huffSpec) *huffEncoder {
+	var res huffEncoder
+	var code uint16
+	k := 0
+	for i, count := range spec.counts {
+		for range count {
+			res[spec.symbols[k]] = huffCode{code: code, size: byte(i + 1)}
+			code++
+			k++
+		}
+		code <<= 1
+	}
+	return &res
+}
+
+// Запись символа sym
+func (h *huffEncoder) putSymbol(writer *bitwriter.BitWriter, sym byte) {
+	writer.PutBits(h[sym].code, h[sym].size)
+}
+
+// Категория значения: количество бит в модуле
+func category(val int) byte {
+	if val < 0 {
+		val = -val
+	}
+	return byte(bits.Len(uint(val)))
+}
+
+// Запись дополнительных бит значения val категории size
+// Для отрицательных значений записывается val - 1 в дополнительном коде
+func putValue(writer *bitwriter.BitWriter, val int, size byte) {
+	if val < 0 {
+		val--
+	}
+	writer.PutBits(uint16(val)&(1<<size-1), size)
+}
+
+// Запись разности DC
+func (h *huffEncoder) putDC(writer *bitwriter.BitWriter, diff int) {
+	size := category(diff)
+	h.putSymbol(writer, size)
+	putValue(writer, diff, size)
+}
+
+// Запись AC коэффициентов unit[start:end+1] с кодированием длин серий нулей
+func (h *huffEncoder) putAC(writer *bitwriter.BitWriter, unit []int16, start byte, end byte) {
+	run := byte(0)
+	for k := start; k <= end; k++ {
+		if unit[k] == 0 {
+			run++
+			continue
+		}
+		//Серия из 16 нулей кодируется символом ZRL
+		for ; run > 15; run -= 16 {
+			h.putSymbol(writer, 0xF0)
+		}
+		size := category(int(unit[k]))
+		h.putSymbol(writer, run<<4|size)
+		putValue(writer, int(unit[k]), size)
+		run = 0
+	}
+	if run > 0 {
+		h.putSymbol(writer, 0x00) //EOB
+	}
+}
+
+// Построение оптимальной таблицы Хаффмана с длиной кодов не больше 16 по частотам символов (K.2)
+// Код из одних единиц не назначается ни одному символу
+func optimalHuffSpec(freqs *[numOfSymbols]int) *huffSpec {
+	//Дополнительный символ резервирует код из одних единиц
+	var freq [numOfSymbols + 1]int
+	copy(freq[:], freqs[:])
+	freq[numOfSymbols] = 1
+
+	var codeSize [numOfSymbols + 1]int
+	var others [numOfSymbols + 1]int
+	for i := range others {
+		others[i] = -1
+	}
+
+	//Наименее частый символ, при равенстве - с большим номером
+	leastFrequent := func(skip int) int {
+		res := -1
+		for i, val := range freq {
+			if val != 0 && i != skip && (res < 0 || val <= freq[res]) {
+				res = i
+			}
+		}
+		return res
+	}
+
+	for {
+		c1 := leastFrequent(-1)
+		c2 := leastFrequent(c1)
+		if c2 < 0 {
+			break
+		}
+
+		freq[c1] += freq[c2]
+		freq[c2] = 0
+		codeSize[c1]++
+		for others[c1] >= 0 {
+			c1 = others[c1]
+			codeSize[c1]++
+		}
+		others[c1] = c2
+		codeSize[c2]++
+		for others[c2] >= 0 {
+			c2 = others[c2]
+			codeSize[c2]++
+		}
+	}
+
+	var counts [numOfSymbols + 2]int
+	for _, size := range codeSize {
+		if size != 0 {
+			counts[size]++
+		}
+	}
+
+	//Ограничение длины кодов 16 битами
+	for i := len(counts) - 1; i > numHuffCodesLen; i-- {
+		for counts[i] > 0 {
+			j := i - 2
+			for counts[j] == 0 {
+				j--
+			}
+			counts[i] -= 2
+			counts[i-1]++
+			counts[j+1] += 2
+			counts[j]--
+		}
+	}
+
+	//Удаление зарезервированного кода
+	i := numHuffCodesLen
+	for i > 0 && counts[i] == 0 {
+		i--
+	}
+	if i > 0 {
+		counts[i]--
+	}
+
+	var res huffSpec
+	for size := 1; size <= numHuffCodesLen; size++ {
+		res.counts[size-1] = byte(counts[size])
+	}
+	for size := 1; size <= len(counts)-1; size++ {
+		for sym := range numOfSymbols {
+			if codeSize[sym] == size {
+				res.symbols = append(res.symbols, byte(sym))
+			}
+		}
+	}
+	return &res
+}
+
+// Подсчет частоты символа разности DC
+func countDC(freqs *[numOfSymbols]int, diff int) {
+	freqs[category(diff)]++
+}
+
+// Подсчет частот символов AC коэффициентов unit[start:end+1], записываемых putAC
+func countAC(freqs *[numOfSymbols]int, unit []int16, start byte, end byte) {
+	run := byte(0)
+	for k := start; k <= end; k++ {
+		if unit[k] == 0 {
+			run++
+			continue
+		}
+		for ; run > 15; run -= 16 {
+			freqs[0xF0]++
+		}
+		freqs[run<<4|category(int(unit[k]))]++
+		run = 0
+	}
+	if run > 0 {
+		freqs[0x00]++
+	}
+}
@@ -0,0 +1,58 @@
+package encoder
+
+import (
+	"bufio"
+	"io"
+	"jpeg/decoder"
+)
+
+// Оптимизация таблиц Хаффмана существующих файлов без изменения коэффициентов
+
+// Подсчет частот символов интерливного скана со всеми коэффициентами по номерам таблиц
+func (f *frame) countBaselineSymbols() (*[2][numOfSymbols]int, *[2][numOfSymbols]int) {
+	var dcFreqs, acFreqs [2][numOfSymbols]int
+	prev := make([]int, len(f.comps))
+	f.walkMCUs(f.allComps(), func(unit []int16, i int) {
+		id := f.comps[i].tableID
+		countDC(&dcFreqs[id], int(unit[0])-prev[i])
+		prev[i] = int(unit[0])
+		countAC(&acFreqs[id], unit, 1, sizeOfTable-1)
+	})
+	return &dcFreqs, &acFreqs
+}
+
+// Запись интерливного скана со всеми коэффициентами и оптимальными таблицами Хаффмана
+func (f *frame) writeOptimizedBaselineScan() {
+	dcFreqs, acFreqs := f.countBaselineSymbols()
+	var dcTables, acTables [2]*huffEncoder
+	for _, id := range f.huffTableIDs() {
+		dcSpec := optimalHuffSpec(&dcFreqs[id])
+		acSpec := optimalHuffSpec(&acFreqs[id])
+		f.writeHuffTable(0, id, dcSpec)
+		f.writeHuffTable(1, id, acSpec)
+		dcTables[id] = makeHuffEncoder(dcSpec)
+		acTables[id] = makeHuffEncoder(acSpec)
+	}
+	f.writeBaselineScan(dcTables, acTables)
+}
+
+// Чтение коэффициентов JPEG из r в порядке зиг-зага
+func readCoefficients(r io.Reader) (*decoder.Coefficients, error) {
+	jpeg, err := decoder.ReadJPEG(bufio.NewReader(r))
+	if err != nil {
+		return nil, err
+	}
+	return jpeg.ReadCoefficients(decoder.ZigZagOrder)
+}
+
+// Перезапись JPEG из r в w с оптимальными таблицами Хаффмана
+// Коэффициенты, таблицы квантования, сканы прогрессивного изображения и сегменты приложений сохраняются,
+// поэтому пиксели результата совпадают с исходными. Арифметическое кодирование заменяется кодированием Хаффмана,
+// интервалы перезапуска не записываются
+func Optimize(w io.Writer, r io.Reader) error {
+	coefs, err := readCoefficients(r)
+	if err != nil {
+		return err
+	}
+	return WriteCoefficients(w, coefs)
+}
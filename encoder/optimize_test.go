@@ -0,0 +1,85 @@
+package encoder
+
+import (
+	"bufio"
+	"bytes"
+	stdjpeg "image/jpeg"
+	"jpeg/decoder"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+)
+
+// Чтение коэффициентов файла нашим декодером
+func parseCoefficients(t *testing.T, name string, data []byte) *decoder.Coefficients {
+	t.Helper()
+	jpeg, err := decoder.ReadJPEG(bufio.NewReader(bytes.NewReader(data)))
+	if err != nil {
+		t.Fatal(name, "ReadJPEG -> error", err.Error())
+	}
+	coefs, err := jpeg.ReadCoefficients(decoder.ZigZagOrder)
+	if err != nil {
+		t.Fatal(name, "ReadCoefficients -> error", err.Error())
+	}
+	return coefs
+}
+
+func TestOptimize(t *testing.T) {
+	files := []string{
+		"../decoder/pics/Baseline/Suwa.jpg",
+		"../decoder/pics/Progressive/OddProgressive.jpeg",
+	}
+	for _, dir := range []string{"Arithmetic", "ColorSpace", "Gray"} {
+		names, _ := filepath.Glob("../decoder/pics/" + dir + "/*.jpg")
+		files = append(files, names...)
+	}
+
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var buf bytes.Buffer
+		if err := Optimize(&buf, bytes.NewReader(data)); err != nil {
+			t.Fatal(name, "Optimize -> error", err.Error())
+		}
+		//Результат должен читаться эталонным декодером, если он читает исходный файл
+		if _, err := stdjpeg.Decode(bytes.NewReader(data)); err == nil {
+			if _, err := stdjpeg.Decode(bytes.NewReader(buf.Bytes())); err != nil {
+				t.Fatal(name, "image/jpeg.Decode -> error", err.Error())
+			}
+		}
+
+		src := parseCoefficients(t, name, data)
+		res := parseCoefficients(t, name, buf.Bytes())
+		if res.IsProgressive != src.IsProgressive || len(res.Scans) != len(src.Scans) {
+			t.Fatal(name, "scans differ")
+		}
+		for c := range src.Comps {
+			for row := range src.Comps[c].Blocks {
+				for col := range src.Comps[c].Blocks[row] {
+					if !slices.Equal(res.Comps[c].Blocks[row][col], src.Comps[c].Blocks[row][col]) {
+						t.Fatalf("%s: component %d block (%d, %d) differs", name, c, row, col)
+					}
+				}
+			}
+		}
+	}
+}
+
+func TestOptimizeSize(t *testing.T) {
+	//Файл со стандартными таблицами приложения K
+	name := "../decoder/pics/Baseline/Suwa.jpg"
+	data, err := os.ReadFile(name)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var buf bytes.Buffer
+	if err := Optimize(&buf, bytes.NewReader(data)); err != nil {
+		t.Fatal("Optimize -> error", err.Error())
+	}
+	if buf.Len() >= len(data) {
+		t.Fatal("Optimized size:", buf.Len(), "Source size:", len(data))
+	}
+}
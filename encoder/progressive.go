@@ -0,0 +1,332 @@
+package encoder
+
+import (
+	"errors"
+	"fmt"
+	bitwriter "jpeg/encoder/bitWriter"
+)
+
+// Прогрессивное кодирование (ITU T.81, приложение G)
+
+const maxScanComps = 4      //Максимальное количество компонент в скане
+const maxApprox = 13        //Максимальный бит successive approximation
+const maxEndOfBand = 0x7FFF //Максимальная длина серии EOB
+
+// Описание одного скана прогрессивного кодирования
+type Scan struct {
+	Comps []int //Номера компонент в кадре (0 - Y, 1 - Cb, 2 - Cr)
+	Ss    byte  //Начало spectral selection
+	Se    byte  //Конец spectral selection
+	Ah    byte  //Предыдущий бит successive approximation (0 для первого скана коэффициентов)
+	Al    byte  //Текущий бит successive approximation
+}
+
+// Скан DC всех компонент
+func dcScan(numOfComps int, ah byte, al byte) Scan {
+	comps := make([]int, numOfComps)
+	for i := range comps {
+		comps[i] = i
+	}
+	return Scan{Comps: comps, Ss: 0, Se: 0, Ah: ah, Al: al}
+}
+
+// Скрипт сканов libjpeg по умолчанию (jpeg_simple_progression) для numOfComps компонент
+func DefaultScanScript(numOfComps int) []Scan {
+	if numOfComps == 3 {
+		return []Scan{
+			dcScan(3, 0, 1),
+			{Comps: []int{0}, Ss: 1, Se: 5, Ah: 0, Al: 2},
+			{Comps: []int{2}, Ss: 1, Se: 63, Ah: 0, Al: 1},
+			{Comps: []int{1}, Ss: 1, Se: 63, Ah: 0, Al: 1},
+			{Comps: []int{0}, Ss: 6, Se: 63, Ah: 0, Al: 2},
+			{Comps: []int{0}, Ss: 1, Se: 63, Ah: 2, Al: 1},
+			dcScan(3, 1, 0),
+			{Comps: []int{2}, Ss: 1, Se: 63, Ah: 1, Al: 0},
+			{Comps: []int{1}, Ss: 1, Se: 63, Ah: 1, Al: 0},
+			{Comps: []int{0}, Ss: 1, Se: 63, Ah: 1, Al: 0},
+		}
+	}
+
+	res := []Scan{dcScan(numOfComps, 0, 1)}
+	acScans := func(ss byte, se byte, ah byte, al byte) {
+		for i := range numOfComps {
+			res = append(res, Scan{Comps: []int{i}, Ss: ss, Se: se, Ah: ah, Al: al})
+		}
+	}
+	acScans(1, 5, 0, 2)
+	acScans(6, 63, 0, 2)
+	acScans(1, 63, 2, 1)
+	res = append(res, dcScan(numOfComps, 1, 0))
+	acScans(1, 63, 1, 0)
+	return res
+}
+
+// Проверка скрипта сканов по правилам G.1.1.1
+func validateScanScript(scans []Scan, numOfComps int) error {
+	if len(scans) == 0 {
+		return errors.New("Encoding error: empty scan script")
+	}
+
+	//Последний переданный бит каждого коэффициента компоненты, -1 если коэффициент не передавался
+	lastBit := make([][sizeOfTable]int, numOfComps)
+	for i := range lastBit {
+		for k := range lastBit[i] {
+			lastBit[i][k] = -1
+		}
+	}
+
+	for n, scan := range scans {
+		if len(scan.Comps) == 0 || len(scan.Comps) > maxScanComps {
+			return fmt.Errorf("Encoding error: scan %d: invalid number of components", n)
+		}
+		if scan.Ss > scan.Se || scan.Se > sizeOfTable-1 || (scan.Ss == 0 && scan.Se != 0) {
+			return fmt.Errorf("Encoding error: scan %d: invalid spectral selection %d-%d", n, scan.Ss, scan.Se)
+		}
+		if scan.Ss != 0 && len(scan.Comps) != 1 {
+			return fmt.Errorf("Encoding error: scan %d: AC scan must contain one component", n)
+		}
+		if scan.Al > maxApprox || (scan.Ah != 0 && scan.Ah != scan.Al+1) {
+			return fmt.Errorf("Encoding error: scan %d: invalid successive approximation %d-%d", n, scan.Ah, scan.Al)
+		}
+
+		for k, i := range scan.Comps {
+			if i < 0 || i >= numOfComps {
+				return fmt.Errorf("Encoding error: scan %d: unknown component %d", n, i)
+			}
+			for _, prevComp := range scan.Comps[:k] {
+				if prevComp >= i {
+					return fmt.Errorf("Encoding error: scan %d: components must be in increasing order", n)
+				}
+			}
+			if scan.Ss != 0 && lastBit[i][0] < 0 {
+				return fmt.Errorf("Encoding error: scan %d: AC scan before DC scan of component %d", n, i)
+			}
+			for coef := scan.Ss; coef <= scan.Se; coef++ {
+				last := lastBit[i][coef]
+				if (last < 0 && scan.Ah != 0) || (last >= 0 && int(scan.Ah) != last) {
+					return fmt.Errorf("Encoding error: scan %d: successive approximation does not continue previous scans", n)
+				}
+				lastBit[i][coef] = int(scan.Al)
+			}
+		}
+	}
+
+	for i := range lastBit {
+		if lastBit[i][0] < 0 {
+			return fmt.Errorf("Encoding error: DC of component %d is not coded", i)
+		}
+	}
+	return nil
+}
+
+// Состояние записи одного прогрессивного скана
+// Скан проходится дважды: подсчет частот символов для таблиц Хаффмана и запись
+type progressiveEncoder struct {
+	writer   *bitwriter.BitWriter //Объект для записи, nil при подсчете частот
+	freqs    [2][numOfSymbols]int //Частоты символов по номерам таблиц
+	tables   [2]*huffEncoder      //Таблицы Хаффмана по номерам таблиц
+	prev     []int                //Предыдущие значения DC для дельта кодирования
+	endRun   int                  //Длина текущей серии EOB
+	corrBits []byte               //Биты уточнения блоков в серии EOB
+}
+
+// Запись символа sym таблицы tableID или подсчет его частоты
+func (e *progressiveEncoder) putSymbol(tableID byte, sym byte) {
+	if e.writer == nil {
+		e.freqs[tableID][sym]++
+		return
+	}
+	e.tables[tableID].putSymbol(e.writer, sym)
+}
+
+// Запись n младших бит val
+func (e *progressiveEncoder) putBits(val uint16, n byte) {
+	if e.writer != nil {
+		e.writer.PutBits(val, n)
+	}
+}
+
+// Запись значения val с категорией: символ (run << 4 | size) и дополнительные биты
+func (e *progressiveEncoder) putRunValue(tableID byte, run byte, val int) {
+	size := category(val)
+	e.putSymbol(tableID, run<<4|size)
+	if val < 0 {
+		val--
+	}
+	e.putBits(uint16(val)&(1<<size-1), size)
+}
+
+// Запись битов уточнения
+func (e *progressiveEncoder) putCorrBits(bits []byte) {
+	for _, bit := range bits {
+		e.putBits(uint16(bit), 1)
+	}
+}
+
+// Запись накопленной серии EOB и битов уточнения ее блоков
+func (e *progressiveEncoder) flushEndRun(tableID byte) {
+	if e.endRun == 0 {
+		return
+	}
+	size := category(e.endRun) - 1
+	e.putSymbol(tableID, size<<4)
+	e.putBits(uint16(e.endRun)&(1<<size-1), size)
+	e.endRun = 0
+
+	e.putCorrBits(e.corrBits)
+	e.corrBits = e.corrBits[:0]
+}
+
+// Учет блока, закончившегося EOB
+func (e *progressiveEncoder) addEndOfBand(tableID byte) {
+	e.endRun++
+	if e.endRun == maxEndOfBand {
+		e.flushEndRun(tableID)
+	}
+}
+
+// Первое чтение DC: разность значений, сдвинутых на al
+func (e *progressiveEncoder) encodeDCFirst(unit []int16, i int, tableID byte, al byte) {
+	val := int(unit[0]) >> al
+	e.putRunValue(tableID, 0, val-e.prev[i])
+	e.prev[i] = val
+}
+
+// Первое чтение AC: коэффициенты unit[ss:se+1], сдвинутые на al, с сериями EOB
+func (e *progressiveEncoder) encodeACFirst(unit []int16, tableID byte, ss byte, se byte, al byte) {
+	run := byte(0)
+	for k := ss; k <= se; k++ {
+		val := int(unit[k])
+		if val < 0 {
+			val = -(-val >> al)
+		} else {
+			val >>= al
+		}
+		if val == 0 {
+			run++
+			continue
+		}
+
+		e.flushEndRun(tableID)
+		for ; run > 15; run -= 16 {
+			e.putSymbol(tableID, 0xF0)
+		}
+		e.putRunValue(tableID, run, val)
+		run = 0
+	}
+	if run > 0 {
+		e.addEndOfBand(tableID)
+	}
+}
+
+// Уточнение AC: новые коэффициенты с модулем 1 и биты уточнения уже ненулевых коэффициентов
+func (e *progressiveEncoder) encodeACRefine(unit []int16, tableID byte, ss byte, se byte, al byte) {
+	//Модули коэффициентов с точностью al и последний новый ненулевой коэффициент
+	var abs [sizeOfTable]int
+	last := -1
+	for k := ss; k <= se; k++ {
+		abs[k] = max(int(unit[k]), -int(unit[k])) >> al
+		if abs[k] == 1 {
+			last = int(k)
+		}
+	}
+
+	run := byte(0)
+	var bits []byte //Биты уточнения с последнего записанного символа
+	for k := ss; k <= se; k++ {
+		if abs[k] == 0 {
+			run++
+			continue
+		}
+		//Серии нулей перед последним новым коэффициентом, после него они входят в EOB
+		for run > 15 && int(k) <= last {
+			e.flushEndRun(tableID)
+			e.putSymbol(tableID, 0xF0)
+			run -= 16
+			e.putCorrBits(bits)
+			bits = bits[:0]
+		}
+		if abs[k] > 1 {
+			bits = append(bits, byte(abs[k]&1))
+			continue
+		}
+
+		e.flushEndRun(tableID)
+		e.putSymbol(tableID, run<<4|1)
+		if unit[k] < 0 {
+			e.putBits(0, 1)
+		} else {
+			e.putBits(1, 1)
+		}
+		e.putCorrBits(bits)
+		bits = bits[:0]
+		run = 0
+	}
+
+	if run > 0 || len(bits) > 0 {
+		e.corrBits = append(e.corrBits, bits...)
+		e.addEndOfBand(tableID)
+	}
+}
+
+// Кодирование блока unit компоненты i в соответствии со сканом scan
+func (e *progressiveEncoder) encodeUnit(unit []int16, i int, tableID byte, scan *Scan) {
+	switch {
+	case scan.Ss == 0 && scan.Ah == 0:
+		e.encodeDCFirst(unit, i, tableID, scan.Al)
+	case scan.Ss == 0:
+		e.putBits(uint16(unit[0]>>scan.Al)&1, 1)
+	case scan.Ah == 0:
+		e.encodeACFirst(unit, tableID, scan.Ss, scan.Se, scan.Al)
+	default:
+		e.encodeACRefine(unit, tableID, scan.Ss, scan.Se, scan.Al)
+	}
+}
+
+// Проход по блокам скана в порядке записи
+// Скан из одной компоненты неинтерливный: обходятся только блоки, покрывающие изображение
+func (f *frame) encodeScan(e *progressiveEncoder, scan *Scan) {
+	e.prev = make([]int, len(f.comps))
+	if len(scan.Comps) == 1 {
+		i := scan.Comps[0]
+		comp := &f.comps[i]
+		for row := range comp.blocksHeight {
+			for col := range comp.blocksWidth {
+				e.encodeUnit(comp.blocks[row][col], i, comp.tableID, scan)
+			}
+		}
+	} else {
+		f.walkMCUs(scan.Comps, func(unit []int16, i int) {
+			e.encodeUnit(unit, i, f.comps[i].tableID, scan)
+		})
+	}
+	e.flushEndRun(f.comps[scan.Comps[0]].tableID)
+}
+
+// Запись прогрессивного скана с оптимальными таблицами Хаффмана
+func (f *frame) writeProgressiveScan(scan Scan) {
+	var e progressiveEncoder
+	//Уточнение DC записывается без кодов Хаффмана
+	if scan.Ss != 0 || scan.Ah == 0 {
+		f.encodeScan(&e, &scan)
+
+		var tc byte //Класс таблицы: 0 - DC, 1 - AC
+		if scan.Ss != 0 {
+			tc = 1
+		}
+		for _, i := range scan.Comps {
+			id := f.comps[i].tableID
+			if e.tables[id] == nil {
+				spec := optimalHuffSpec(&e.freqs[id])
+				f.writeHuffTable(tc, id, spec)
+				e.tables[id] = makeHuffEncoder(spec)
+			}
+		}
+	}
+
+	f.writeScanHeader(scan.Comps, scan.Ss, scan.Se, scan.Ah, scan.Al)
+	e.writer = f.writer
+	f.writer.HuffStreamStart()
+	f.encodeScan(&e, &scan)
+	f.writer.HuffStreamEnd()
+}
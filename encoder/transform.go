@@ -0,0 +1,199 @@
+package encoder
+
+import (
+	"errors"
+	"image"
+	"io"
+	"jpeg/decoder"
+)
+
+// Преобразования без потерь над квантованными коэффициентами (аналог jpegtran)
+
+// Геометрическое преобразование изображения
+type Transform byte
+
+const (
+	TransformNone  Transform = iota //Без преобразования
+	FlipHorizontal                  //Отражение слева направо
+	FlipVertical                    //Отражение сверху вниз
+	Transpose                       //Отражение относительно главной диагонали
+	Transverse                      //Отражение относительно побочной диагонали
+	Rotate90                        //Поворот на 90 градусов по часовой стрелке
+	Rotate180                       //Поворот на 180 градусов
+	Rotate270                       //Поворот на 270 градусов по часовой стрелке
+)
+
+// Параметры преобразования
+type TransformOptions struct {
+	Transform Transform       //Геометрическое преобразование
+	Crop      image.Rectangle //Обрезка в координатах результата преобразования, пустая - без обрезки
+}
+
+// Преобразование как последовательность: транспонирование, затем отражения в координатах результата
+type geometry struct {
+	transpose bool //Транспонирование
+	flipH     bool //Отражение слева направо
+	flipV     bool //Отражение сверху вниз
+}
+
+// Разложение преобразования на транспонирование и отражения
+func (t Transform) geometry() (geometry, error) {
+	switch t {
+	case TransformNone:
+		return geometry{}, nil
+	case FlipHorizontal:
+		return geometry{flipH: true}, nil
+	case FlipVertical:
+		return geometry{flipV: true}, nil
+	case Transpose:
+		return geometry{transpose: true}, nil
+	case Transverse:
+		return geometry{transpose: true, flipH: true, flipV: true}, nil
+	case Rotate90:
+		return geometry{transpose: true, flipH: true}, nil
+	case Rotate180:
+		return geometry{flipH: true, flipV: true}, nil
+	case Rotate270:
+		return geometry{transpose: true, flipV: true}, nil
+	default:
+		return geometry{}, errors.New("Encoding error: unknown transform")
+	}
+}
+
+// Преобразование блока unit в порядке зиг-зага
+// Отражение меняет знак коэффициентов с нечетной частотой по оси отражения
+func (g geometry) transformUnit(unit []int16) []int16 {
+	res := make([]int16, sizeOfTable)
+	for u := range unitRowCount {
+		for v := range unitColCount {
+			val := unit[zigZagTable[u][v]]
+			row, col := u, v
+			if g.transpose {
+				row, col = v, u
+			}
+			if (g.flipH && col%2 == 1) != (g.flipV && row%2 == 1) {
+				val = -val
+			}
+			res[zigZagTable[row][col]] = val
+		}
+	}
+	return res
+}
+
+// Транспонирование таблицы квантования в порядке зиг-зага
+func transposeQuantTable(table []uint16) []uint16 {
+	if table == nil {
+		return nil
+	}
+	res := make([]uint16, sizeOfTable)
+	for u := range unitRowCount {
+		for v := range unitColCount {
+			res[zigZagTable[v][u]] = table[zigZagTable[u][v]]
+		}
+	}
+	return res
+}
+
+// Применение преобразования и обрезки к коэффициентам изображения
+// Неполные MCU у краев, которые после отражения оказались бы внутри изображения, отбрасываются
+// Левый верхний угол обрезки должен быть кратен размеру MCU результата
+func transformCoefficients(coefs *decoder.Coefficients, o TransformOptions) (*decoder.Coefficients, error) {
+	g, err := o.Transform.geometry()
+	if err != nil {
+		return nil, err
+	}
+
+	var maxH, maxV byte = 1, 1
+	for _, comp := range coefs.Comps {
+		maxH = max(maxH, comp.H)
+		maxV = max(maxV, comp.V)
+	}
+	height, width := int(coefs.ImageHeight), int(coefs.ImageWidth)
+	if g.transpose {
+		height, width = width, height
+		maxH, maxV = maxV, maxH
+	}
+	mcuHeight := unitRowCount * int(maxV)
+	mcuWidth := unitColCount * int(maxH)
+	if g.flipV {
+		height = height / mcuHeight * mcuHeight
+	}
+	if g.flipH {
+		width = width / mcuWidth * mcuWidth
+	}
+	if height == 0 || width == 0 {
+		return nil, errors.New("Encoding error: image is smaller than MCU")
+	}
+
+	crop := o.Crop
+	if crop.Empty() {
+		crop = image.Rect(0, 0, width, height)
+	}
+	if !crop.In(image.Rect(0, 0, width, height)) {
+		return nil, errors.New("Encoding error: crop is out of image bounds")
+	}
+	if crop.Min.X%mcuWidth != 0 || crop.Min.Y%mcuHeight != 0 {
+		return nil, errors.New("Encoding error: crop offset is not aligned to MCU")
+	}
+
+	res := *coefs
+	res.ImageHeight = uint16(crop.Dy())
+	res.ImageWidth = uint16(crop.Dx())
+	if g.transpose {
+		for i, table := range coefs.QuantTables {
+			res.QuantTables[i] = transposeQuantTable(table)
+		}
+	}
+
+	mcusHeight := (crop.Dy() + mcuHeight - 1) / mcuHeight
+	mcusWidth := (crop.Dx() + mcuWidth - 1) / mcuWidth
+	res.Comps = make([]decoder.CompCoefficients, len(coefs.Comps))
+	for i, src := range coefs.Comps {
+		comp := src
+		if g.transpose {
+			comp.H, comp.V = src.V, src.H
+		}
+		comp.BlocksHeight = compBlocks(crop.Dy(), comp.V, maxV)
+		comp.BlocksWidth = compBlocks(crop.Dx(), comp.H, maxH)
+
+		//Смещение обрезки и количество блоков отражаемой области в блоках компоненты
+		rowOffset := crop.Min.Y / mcuHeight * int(comp.V)
+		colOffset := crop.Min.X / mcuWidth * int(comp.H)
+		rows := height / mcuHeight * int(comp.V)
+		cols := width / mcuWidth * int(comp.H)
+
+		comp.Blocks = make([][][]int16, mcusHeight*int(comp.V))
+		for row := range comp.Blocks {
+			comp.Blocks[row] = make([][]int16, mcusWidth*int(comp.H))
+			for col := range comp.Blocks[row] {
+				srcRow, srcCol := row+rowOffset, col+colOffset
+				if g.flipV {
+					srcRow = rows - 1 - srcRow
+				}
+				if g.flipH {
+					srcCol = cols - 1 - srcCol
+				}
+				if g.transpose {
+					srcRow, srcCol = srcCol, srcRow
+				}
+				comp.Blocks[row][col] = g.transformUnit(src.Blocks[srcRow][srcCol])
+			}
+		}
+		res.Comps[i] = comp
+	}
+	return &res, nil
+}
+
+// Преобразование JPEG из r без перекодирования с записью в w
+// Сохраняется режим кодирования исходного файла (baseline или progressive), таблицы Хаффмана оптимизируются
+func TransformJPEG(w io.Writer, r io.Reader, o TransformOptions) error {
+	coefs, err := readCoefficients(r)
+	if err != nil {
+		return err
+	}
+	coefs, err = transformCoefficients(coefs, o)
+	if err != nil {
+		return err
+	}
+	return WriteCoefficients(w, coefs)
+}
@@ -0,0 +1,133 @@
+package encoder
+
+import (
+	"bytes"
+	"image"
+	stdjpeg "image/jpeg"
+	"jpeg/decoder"
+	"testing"
+)
+
+// Тестовое изображение размером height x width с плавными градиентами
+func gradientImage(height uint16, width uint16) decoder.Image {
+	img := decoder.CreateRGBMatrix(height, width)
+	for i := range img {
+		for j := range img[i] {
+			img[i][j] = decoder.Rgb{R: byte(i * 3), G: byte(j * 2), B: byte((i + 2*j) % 256)}
+		}
+	}
+	return img
+}
+
+// Преобразование изображения по пикселям для сравнения
+func transformPixels(img image.Image, g geometry) *image.RGBA {
+	b := img.Bounds()
+	height, width := b.Dy(), b.Dx()
+	if g.transpose {
+		height, width = width, height
+	}
+	res := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := range height {
+		for x := range width {
+			srcX, srcY := x, y
+			if g.flipH {
+				srcX = width - 1 - x
+			}
+			if g.flipV {
+				srcY = height - 1 - y
+			}
+			if g.transpose {
+				srcX, srcY = srcY, srcX
+			}
+			res.Set(x, y, img.At(b.Min.X+srcX, b.Min.Y+srcY))
+		}
+	}
+	return res
+}
+
+func TestTransform(t *testing.T) {
+	//Размеры кратны MCU, чтобы преобразования не обрезали изображение
+	img := gradientImage(48, 64)
+	for _, progressive := range []bool{false, true} {
+		for _, sub := range []Subsampling{Subsample420, Subsample422, Subsample444} {
+			var src bytes.Buffer
+			if err := EncodeImage(&src, img, &Options{Quality: 90, Subsampling: sub, Progressive: progressive}); err != nil {
+				t.Fatal("EncodeImage -> error", err.Error())
+			}
+			srcImg, err := stdjpeg.Decode(bytes.NewReader(src.Bytes()))
+			if err != nil {
+				t.Fatal("image/jpeg.Decode -> error", err.Error())
+			}
+
+			for tr := TransformNone; tr <= Rotate270; tr++ {
+				var buf bytes.Buffer
+				if err := TransformJPEG(&buf, bytes.NewReader(src.Bytes()), TransformOptions{Transform: tr}); err != nil {
+					t.Fatal("TransformJPEG -> error", err.Error())
+				}
+				res, err := stdjpeg.Decode(bytes.NewReader(buf.Bytes()))
+				if err != nil {
+					t.Fatal("image/jpeg.Decode -> error", err.Error())
+				}
+				g, _ := tr.geometry()
+				want := transformPixels(srcImg, g)
+				if res.Bounds() != want.Bounds() {
+					t.Fatalf("transform %d: bounds %v, expect %v", tr, res.Bounds(), want.Bounds())
+				}
+				if val := psnr(res, want); val < 45 {
+					t.Fatalf("transform %d, subsampling %d, progressive %t: PSNR %f", tr, sub, progressive, val)
+				}
+			}
+		}
+	}
+}
+
+func TestTransformCrop(t *testing.T) {
+	//Неполные MCU справа и снизу
+	img := gradientImage(45, 70)
+	var src bytes.Buffer
+	if err := EncodeImage(&src, img, &Options{Quality: 90, Subsampling: Subsample420}); err != nil {
+		t.Fatal("EncodeImage -> error", err.Error())
+	}
+	srcImg, err := stdjpeg.Decode(bytes.NewReader(src.Bytes()))
+	if err != nil {
+		t.Fatal("image/jpeg.Decode -> error", err.Error())
+	}
+
+	//Неполные MCU, попадающие внутрь после поворота, отбрасываются
+	var buf bytes.Buffer
+	if err := TransformJPEG(&buf, bytes.NewReader(src.Bytes()), TransformOptions{Transform: Rotate180}); err != nil {
+		t.Fatal("TransformJPEG -> error", err.Error())
+	}
+	cfg, err := stdjpeg.DecodeConfig(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal("image/jpeg.DecodeConfig -> error", err.Error())
+	}
+	if cfg.Width != 64 || cfg.Height != 32 {
+		t.Fatal("Rotated size:", cfg.Width, cfg.Height, "Expect: 64 32")
+	}
+
+	crop := image.Rect(16, 16, 69, 45)
+	buf.Reset()
+	if err := TransformJPEG(&buf, bytes.NewReader(src.Bytes()), TransformOptions{Crop: crop}); err != nil {
+		t.Fatal("TransformJPEG -> error", err.Error())
+	}
+	res, err := stdjpeg.Decode(bytes.NewReader(buf.Bytes()))
+	if err != nil {
+		t.Fatal("image/jpeg.Decode -> error", err.Error())
+	}
+	want := transformPixels(srcImg.(interface {
+		SubImage(image.Rectangle) image.Image
+	}).SubImage(crop), geometry{})
+	if res.Bounds() != want.Bounds() {
+		t.Fatalf("Cropped bounds %v, expect %v", res.Bounds(), want.Bounds())
+	}
+	if val := psnr(res, want); val < 45 {
+		t.Fatal("Cropped PSNR", val)
+	}
+
+	for _, bad := range []image.Rectangle{image.Rect(8, 0, 32, 32), image.Rect(0, 0, 80, 32)} {
+		if err := TransformJPEG(&bytes.Buffer{}, bytes.NewReader(src.Bytes()), TransformOptions{Crop: bad}); err == nil {
+			t.Fatal("Crop", bad, "-> expect error")
+		}
+	}
+}
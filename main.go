@@ -2,6 +2,7 @@ package main
 
 import (
 	"bufio"
+	"flag"
 	"jpeg/decoder"
 	"log"
 	"os"
@@ -10,6 +11,12 @@ import (
 	"strings"
 )
 
+// Поворот результата по тегу Orientation из EXIF, по умолчанию выключен
+var autoOrient = flag.Bool("orient", false, "поворачивать изображение по тегу Orientation из EXIF")
+
+// Перевод результата в sRGB по встроенному профилю ICC, по умолчанию цвета остаются исходными
+var toSRGB = flag.Bool("srgb", false, "переводить изображение в sRGB по встроенному профилю ICC")
+
 // Создает директорию по указанному пути и названию
 // filePath - полный путь, включая имя файла (например: /home/user/newdir/file.txt)
 func CreateDir(basePath string, dirName string) string {
@@ -161,6 +168,7 @@ func Common(files []string) {
 	for i := 1; i < len(files); i++ {
 		file, _ := os.Open(files[i])
 		jpeg, _ := decoder.ReadJPEG(bufio.NewReader(file))
+		jpeg.Options.AutoOrient = *autoOrient
 
 		res := decoder.CreateRGBMatrix(jpeg.ImageHeight, jpeg.ImageWidth)
 
@@ -174,20 +182,29 @@ func Common(files []string) {
 			log.Fatal(err.Error())
 		}
 
+		//Перевод в sRGB по встроенному профилю ICC
+		if *toSRGB {
+			if transform, err := decoder.NewColorTransform(jpeg.ICC); err == nil && !transform.Gray {
+				transform.Apply(res)
+			}
+		}
+
 		filename, _ := decoder.JpegNameToBmp(files[i], 0)
-		decoder.EncodeBMP(res, filename)
+		decoder.EncodeBMP(decoder.Orient(res, jpeg.Orientation()), filename)
 	}
 }
 
 func main() {
-	if len(os.Args) < 2 {
+	flag.Parse()
+	if flag.NArg() < 1 {
 		log.Print("Введите путь к файлу в параметрах\n")
 		return
 	}
 
-	Common(os.Args)
-	for i := 1; i < len(os.Args); i++ {
-		// ProgressiveSequence(os.Args[i])
-		// BaselineSequence(os.Args[i])
+	args := append([]string{os.Args[0]}, flag.Args()...)
+	Common(args)
+	for i := 1; i < len(args); i++ {
+		// ProgressiveSequence(args[i])
+		// BaselineSequence(args[i])
 	}
 }
@@ -0,0 +1,46 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"jpeg/decoder"
+	"os"
+	"testing"
+)
+
+// Проверка регистрации декодера в пакете image
+// Тесты пакета decoder используют image/jpeg, который регистрирует тот же формат раньше,
+// поэтому проверка находится в пакете, не подключающем image/jpeg
+func TestImageDecode(t *testing.T) {
+	data, err := os.ReadFile("decoder/pics/Baseline/Aika.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	img, format, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("image.Decode -> error", err.Error())
+	}
+	if format != "jpeg" {
+		t.Fatal("Read:", format, "Expect: jpeg")
+	}
+	want, err := decoder.DecodeWithOptions(bytes.NewReader(data), nil)
+	if err != nil {
+		t.Fatal("DecodeWithOptions -> error", err.Error())
+	}
+	got, ok := img.(*image.RGBA)
+	if !ok {
+		t.Fatalf("got %T, expect *image.RGBA", img)
+	}
+	if got.Bounds() != want.Bounds() || !bytes.Equal(got.Pix, want.(*image.RGBA).Pix) {
+		t.Fatal("image.Decode -> result differs from DecodeWithOptions")
+	}
+
+	cfg, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal("image.DecodeConfig -> error", err.Error())
+	}
+	if wantCfg, err := decoder.DecodeConfig(bytes.NewReader(data)); err != nil || format != "jpeg" || cfg != wantCfg {
+		t.Fatal("image.DecodeConfig -> result differs from DecodeConfig")
+	}
+}